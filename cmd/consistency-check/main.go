@@ -0,0 +1,59 @@
+// Command consistency-check finds receipts and expenses that don't agree, such as receipts whose
+// expense was never created or expenses left pointing to deleted receipts. It only reports them
+// unless -repair is given.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"receipt-mgmt/db"
+	"receipt-mgmt/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func main() {
+	repair := flag.Bool("repair", false, "repair the issues found instead of only reporting them")
+	flag.Parse()
+
+	DB, err := db.ConnectDatabase()
+	if err != nil {
+		log.Fatalf("Database connection error: %v", err)
+	}
+	if err := models.CheckExpensePolicies(); err != nil {
+		log.Fatalf("Configuration error: %v", err)
+	}
+
+	issues, err := models.FindConsistencyIssues(DB)
+	if err != nil {
+		log.Fatalf("Consistency check failed: %v", err)
+	}
+	log.Printf("Expense policy: on_delete=%s, on_update=%s", models.ExpenseDeletePolicy(), models.ExpenseUpdatePolicy())
+
+	repaired := 0
+	for _, issue := range issues {
+		fmt.Printf("%-24s user=%s receipt=%s expense=%s reference=%s: %s\n", issue.Kind, issue.UserID, idOrDash(issue.ReceiptID), idOrDash(issue.ExpenseID), idOrDash(issue.ReferenceID), issue.Detail)
+		if !*repair {
+			continue
+		}
+		if err := models.RepairConsistencyIssue(DB, issue); err != nil {
+			log.Printf("Failed to repair %s: %v", issue.Kind, err)
+			continue
+		}
+		repaired++
+	}
+
+	if *repair {
+		log.Printf("Found %d issues, repaired %d", len(issues), repaired)
+	} else {
+		log.Printf("Found %d issues, run with -repair to fix them", len(issues))
+	}
+}
+
+func idOrDash(id *uuid.UUID) string {
+	if id == nil {
+		return "-"
+	}
+	return id.String()
+}
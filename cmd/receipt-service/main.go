@@ -4,6 +4,7 @@ import (
 	"log"
 	"os"
 	"receipt-mgmt/db"
+	"receipt-mgmt/internal/models"
 	"receipt-mgmt/internal/routes"
 
 	"github.com/gin-gonic/gin"
@@ -14,12 +15,53 @@ func main() {
 	if _, err := db.ConnectDatabase(); err != nil {
 		log.Fatalf("Database connection error: %v", err)
 	}
+	if err := models.CheckExpensePolicies(); err != nil {
+		log.Fatalf("Configuration error: %v", err)
+	}
+
+	// Create or update the tables owned by this service
+	if err := db.Migrate(
+		&models.Receipt{},
+		&models.ReceiptItem{},
+		&models.ReceiptTax{},
+		&models.Merchant{},
+		&models.MerchantAlias{},
+		&models.PaymentAccount{},
+		&models.ReceiptCorrection{},
+		&models.MerchantCategoryPreference{},
+		&models.Rule{},
+		&models.ReceiptSplit{},
+		&models.StatementImport{},
+		&models.StatementTransaction{},
+		&models.RecurringSeries{},
+		&models.Budget{},
+		&models.BudgetAlert{},
+	); err != nil {
+		log.Fatalf("Database migration error: %v", err)
+	}
+	if err := models.IndexReceiptSearch(); err != nil {
+		log.Fatalf("Search index error: %v", err)
+	}
+	if err := models.IndexItemNames(); err != nil {
+		log.Fatalf("Item index error: %v", err)
+	}
 	
 	// Initialize Gin engine
 	server := gin.Default()
 
 	// Register routes
 	routes.ReceiptRoutes(server)
+	routes.ItemRoutes(server)
+	routes.TaxRoutes(server)
+	routes.MerchantRoutes(server)
+	routes.PaymentAccountRoutes(server)
+	routes.CategoryRoutes(server)
+	routes.RuleRoutes(server)
+	routes.ExpenseRoutes(server)
+	routes.StatementRoutes(server)
+	routes.RecurringRoutes(server)
+	routes.BudgetRoutes(server)
+	routes.AnalyticsRoutes(server)
 	routes.AddHealthCheckRoute(server)
 	// Check for environment variable port
 	port := os.Getenv("PORT")
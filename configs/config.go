@@ -21,6 +21,17 @@ type Config struct {
 		Secret           string `mapstructure:"secret"`
 		ExpirationHours  int    `mapstructure:"expiration_hours"`
 	} `mapstructure:"jwt"`
+	FX struct {
+		Provider     string `mapstructure:"provider"`      // Name of the exchange rate provider (default: file)
+		RatesFile    string `mapstructure:"rates_file"`    // CSV table used by the file provider
+		BaseCurrency string `mapstructure:"base_currency"` // Currency rates are triangulated through (default: CAD)
+	} `mapstructure:"fx"`
+	Receipts struct {
+		ExpensePolicy struct {
+			OnDelete string `mapstructure:"on_delete"` // delete, unlink or keep the expense of a deleted receipt (default: delete)
+			OnUpdate string `mapstructure:"on_update"` // sync, unlink or keep the expense of an updated receipt (default: sync)
+		} `mapstructure:"expense_policy"`
+	} `mapstructure:"receipts"`
 }
 
 type AzureConfig struct {
@@ -70,6 +81,11 @@ func LoadConfig() *Config {
 	viper.BindEnv("database.sslmode", "DB_SSLMODE")
 	viper.BindEnv("jwt.secret", "JWT_SECRET")
 	viper.BindEnv("jwt.expiration_hours", "JWT_EXPIRATION_HOURS")
+	viper.BindEnv("fx.provider", "FX_PROVIDER")
+	viper.BindEnv("fx.rates_file", "FX_RATES_FILE")
+	viper.BindEnv("fx.base_currency", "FX_BASE_CURRENCY")
+	viper.BindEnv("receipts.expense_policy.on_delete", "RECEIPTS_EXPENSE_POLICY_ON_DELETE")
+	viper.BindEnv("receipts.expense_policy.on_update", "RECEIPTS_EXPENSE_POLICY_ON_UPDATE")
 
 	// Add Azure bindings
 	viper.BindEnv("azure.computer_vision.key", "AZURE_COMPUTER_VISION_KEY")
@@ -1 +1,20 @@
-package db
\ No newline at end of file
+package db
+
+import (
+	"fmt"
+	"log"
+)
+
+// Migrate creates or updates the tables backing the given models
+func Migrate(models ...interface{}) error {
+	if DB == nil {
+		return fmt.Errorf("database is not connected")
+	}
+
+	if err := DB.AutoMigrate(models...); err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	log.Println("Database migrated successfully")
+	return nil
+}
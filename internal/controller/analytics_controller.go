@@ -0,0 +1,207 @@
+package controller
+
+import (
+	"net/http"
+	"receipt-mgmt/internal/models"
+	"receipt-mgmt/utils"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultTopMerchants = 10
+	maxTopMerchants     = 100
+)
+
+var currencyCodePattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// GetSpendingSummary returns the spending, refund, tax and discount totals and the average basket
+func GetSpendingSummary(c *gin.Context) {
+	r, receipts, ok := loadAnalytics(c)
+	if !ok {
+		return
+	}
+	utils.SendResponse(c, http.StatusOK, "Spending summary retrieved successfully", models.SummarizeSpending(receipts, r), nil)
+}
+
+// GetSpendingByCategory returns the net spending per category, largest first
+func GetSpendingByCategory(c *gin.Context) {
+	r, receipts, ok := loadAnalytics(c)
+	if !ok {
+		return
+	}
+	sendAnalytics(c, "Category spending retrieved successfully", r, "categories", models.SpendingByCategory(receipts, r))
+}
+
+// GetSpendingByMerchant returns the net spending at the top merchants, largest first
+func GetSpendingByMerchant(c *gin.Context) {
+	userID, r, ok := bindAnalyticsRange(c)
+	if !ok {
+		return
+	}
+	limit := utils.ParseQueryInt(c, "limit", defaultTopMerchants)
+	if limit < 1 || limit > maxTopMerchants {
+		limit = defaultTopMerchants
+	}
+	merchants, err := models.SpendingByMerchant(userID, r, limit)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to load merchant spending", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	sendAnalytics(c, "Merchant spending retrieved successfully", r, "merchants", merchants)
+}
+
+// GetSpendingByMonth returns the spending of every month in the range
+func GetSpendingByMonth(c *gin.Context) {
+	r, receipts, ok := loadAnalytics(c)
+	if !ok {
+		return
+	}
+	sendAnalytics(c, "Monthly spending retrieved successfully", r, "months", models.SpendingByMonth(receipts, r))
+}
+
+// GetSpendingPatterns returns the spending by day of the week and hour of the day
+func GetSpendingPatterns(c *gin.Context) {
+	r, receipts, ok := loadAnalytics(c)
+	if !ok {
+		return
+	}
+	sendAnalytics(c, "Spending patterns retrieved successfully", r, "patterns", models.SpendingPatternsOf(receipts, r))
+}
+
+// CompareSpending compares the range with the one of the same length before it, or with the
+// compare_from and compare_to range
+func CompareSpending(c *gin.Context) {
+	r, receipts, ok := loadAnalytics(c)
+	if !ok {
+		return
+	}
+
+	previousRange := r.Previous()
+	if c.Query("compare_from") != "" || c.Query("compare_to") != "" {
+		from, ok := analyticsDate(c, "compare_from", time.Time{})
+		if !ok {
+			return
+		}
+		to, ok := analyticsDate(c, "compare_to", time.Time{})
+		if !ok {
+			return
+		}
+		if from.IsZero() || to.IsZero() || to.Before(from) {
+			utils.SendResponse(c, http.StatusBadRequest, "compare_from and compare_to must both be set, compare_from first", nil, nil)
+			return
+		}
+		previousRange = models.AnalyticsRange{From: from, To: to, Currency: r.Currency}
+	}
+
+	userID, _ := c.Get("userId")
+	previous, err := models.GetAnalyticsReceipts(userID.(uuid.UUID), previousRange)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to load receipts", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Spending comparison retrieved successfully",
+		models.CompareSpending(receipts, r, previous, previousRange), nil)
+}
+
+func sendAnalytics(c *gin.Context, message string, r models.AnalyticsRange, key string, data interface{}) {
+	utils.SendResponse(c, http.StatusOK, message, gin.H{
+		"from":     r.From.Format("2006-01-02"),
+		"to":       r.To.Format("2006-01-02"),
+		"currency": r.Currency,
+		key:        data,
+	}, nil)
+}
+
+// loadAnalytics reads the range and loads the user's receipts in it, sending the error response
+// itself when it can't
+func loadAnalytics(c *gin.Context) (models.AnalyticsRange, []models.AnalyticsReceipt, bool) {
+	userID, r, ok := bindAnalyticsRange(c)
+	if !ok {
+		return r, nil, false
+	}
+
+	receipts, err := models.GetAnalyticsReceipts(userID, r)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to load receipts", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return r, nil, false
+	}
+	return r, receipts, true
+}
+
+// bindAnalyticsRange reads the from, to and currency parameters, sending the error response itself
+// when they are invalid. The range defaults to the last twelve months, this one included, and the
+// currency to the user's.
+func bindAnalyticsRange(c *gin.Context) (uuid.UUID, models.AnalyticsRange, bool) {
+	r := models.AnalyticsRange{}
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return uuid.Nil, r, false
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	var ok bool
+	if r.To, ok = analyticsDate(c, "to", today); !ok {
+		return uuid.Nil, r, false
+	}
+	if r.From, ok = analyticsDate(c, "from", time.Date(r.To.Year(), r.To.Month()-11, 1, 0, 0, 0, 0, time.UTC)); !ok {
+		return uuid.Nil, r, false
+	}
+	if r.To.Before(r.From) {
+		utils.SendResponse(c, http.StatusBadRequest, "from must not be after to", nil, nil)
+		return uuid.Nil, r, false
+	}
+
+	if r.Currency, ok = queryCurrency(c, userID.(uuid.UUID)); !ok {
+		return uuid.Nil, r, false
+	}
+	return userID.(uuid.UUID), r, true
+}
+
+// queryCurrency reads the currency query parameter, the user's currency by default, sending the
+// error response itself when it can't
+func queryCurrency(c *gin.Context, userID uuid.UUID) (string, bool) {
+	currency := strings.ToUpper(strings.TrimSpace(c.Query("currency")))
+	if currency == "" {
+		userCurrency, err := models.GetUserCurrency(userID)
+		if err != nil {
+			utils.SendResponse(c, http.StatusInternalServerError, "Failed to load user currency", nil, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return "", false
+		}
+		return userCurrency, true
+	}
+	if !currencyCodePattern.MatchString(currency) {
+		utils.SendResponse(c, http.StatusBadRequest, "currency must be a three-letter code", nil, nil)
+		return "", false
+	}
+	return currency, true
+}
+
+// analyticsDate reads a YYYY-MM-DD query parameter, sending the error response itself when invalid
+func analyticsDate(c *gin.Context, key string, defaultValue time.Time) (time.Time, bool) {
+	value := c.Query(key)
+	if value == "" {
+		return defaultValue, true
+	}
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, key+" must be in YYYY-MM-DD format", nil, nil)
+		return time.Time{}, false
+	}
+	return date, true
+}
@@ -0,0 +1,300 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"receipt-mgmt/internal/models"
+	"receipt-mgmt/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// budgetRequest is the payload for creating or updating a budget; omitted fields are left unchanged on update
+type budgetRequest struct {
+	CategoryID *uuid.UUID `json:"category_id"`
+	Period     *string    `json:"period"`
+	Amount     *float64   `json:"amount"`
+	Rollover   *string    `json:"rollover"`
+	StartDate  *string    `json:"start_date"` // YYYY-MM-DD
+}
+
+// applyTo validates the request and copies it onto the budget, sending the error response itself when invalid
+func (r budgetRequest) applyTo(c *gin.Context, budget *models.Budget) bool {
+	if r.CategoryID != nil {
+		isValid, err := models.IsCategoryIDValid(r.CategoryID.String(), budget.UserID)
+		if err != nil {
+			utils.SendResponse(c, http.StatusInternalServerError, "Failed to check category", nil, map[string]interface{}{"error": err.Error()})
+			return false
+		}
+		if !isValid {
+			utils.SendResponse(c, http.StatusBadRequest, "Invalid category_id", nil, nil)
+			return false
+		}
+		budget.CategoryID = *r.CategoryID
+	}
+	if r.Period != nil {
+		budget.Period = strings.ToLower(strings.TrimSpace(*r.Period))
+	}
+	if r.Amount != nil {
+		budget.Amount = float64(int64(*r.Amount*100+0.5)) / 100
+	}
+	if r.Rollover != nil {
+		budget.Rollover = strings.ToLower(strings.TrimSpace(*r.Rollover))
+	}
+	if r.StartDate != nil {
+		startDate, err := time.Parse("2006-01-02", *r.StartDate)
+		if err != nil {
+			utils.SendResponse(c, http.StatusBadRequest, "start_date must be in YYYY-MM-DD format", nil, nil)
+			return false
+		}
+		budget.StartDate = startDate
+	}
+
+	if budget.CategoryID == uuid.Nil {
+		utils.SendResponse(c, http.StatusBadRequest, "category_id is required", nil, nil)
+		return false
+	}
+	if err := budget.Validate(); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid budget", nil, map[string]interface{}{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// GetBudgets lists the user's budgets with their progress in the current period, or in the period
+// holding the date query parameter
+func GetBudgets(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return
+	}
+
+	date, ok := budgetDate(c)
+	if !ok {
+		return
+	}
+
+	progress, err := models.GetBudgetsProgress(userID.(uuid.UUID), date)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to fetch budgets", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Budgets retrieved successfully", progress, nil)
+}
+
+// GetBudgetByID returns a budget with its spent and remaining amounts
+func GetBudgetByID(c *gin.Context) {
+	budget, ok := loadBudget(c)
+	if !ok {
+		return
+	}
+	date, ok := budgetDate(c)
+	if !ok {
+		return
+	}
+
+	sendBudgetProgress(c, http.StatusOK, "Budget retrieved successfully", budget, date)
+}
+
+// CreateBudget adds a spending limit for one of the user's categories
+func CreateBudget(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return
+	}
+
+	var request budgetRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid request body", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	today := time.Now()
+	budget := models.Budget{
+		BudgetID:  uuid.New(),
+		UserID:    userID.(uuid.UUID),
+		Period:    models.BudgetMonthly,
+		Rollover:  models.RolloverNone,
+		StartDate: time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC),
+	}
+	if !request.applyTo(c, &budget) {
+		return
+	}
+
+	if err := models.SaveBudget(&budget); err != nil {
+		sendBudgetSaveError(c, "Failed to create budget", err)
+		return
+	}
+
+	sendBudgetProgress(c, http.StatusCreated, "Budget created successfully", &budget, time.Now())
+}
+
+// UpdateBudget edits one of the user's budgets
+func UpdateBudget(c *gin.Context) {
+	budget, ok := loadBudget(c)
+	if !ok {
+		return
+	}
+
+	var request budgetRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid request body", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if !request.applyTo(c, budget) {
+		return
+	}
+
+	if err := models.SaveBudget(budget); err != nil {
+		sendBudgetSaveError(c, "Failed to update budget", err)
+		return
+	}
+
+	sendBudgetProgress(c, http.StatusOK, "Budget updated successfully", budget, time.Now())
+}
+
+// DeleteBudget removes one of the user's budgets and its alerts
+func DeleteBudget(c *gin.Context) {
+	budget, ok := loadBudget(c)
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteBudget(budget); err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to delete budget", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Budget deleted successfully", nil, nil)
+}
+
+// GetBudgetAlerts lists the threshold alerts raised for the user's budgets; unacknowledged=true
+// keeps only the ones not yet seen
+func GetBudgetAlerts(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return
+	}
+
+	unacknowledgedOnly := false
+	if value := c.Query("unacknowledged"); value != "" {
+		var err error
+		if unacknowledgedOnly, err = strconv.ParseBool(value); err != nil {
+			utils.SendResponse(c, http.StatusBadRequest, "Invalid unacknowledged value", nil, nil)
+			return
+		}
+	}
+
+	alerts, err := models.GetBudgetAlerts(userID.(uuid.UUID), unacknowledgedOnly)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to fetch budget alerts", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Budget alerts retrieved successfully", alerts, nil)
+}
+
+// AcknowledgeBudgetAlert marks one of the user's budget alerts as seen
+func AcknowledgeBudgetAlert(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return
+	}
+
+	alertID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid budget alert ID", nil, nil)
+		return
+	}
+
+	alert, err := models.AcknowledgeBudgetAlert(alertID, userID.(uuid.UUID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.SendResponse(c, http.StatusNotFound, "Budget alert not found", nil, nil)
+		} else {
+			utils.SendResponse(c, http.StatusInternalServerError, "Failed to acknowledge budget alert", nil, map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Budget alert acknowledged successfully", alert, nil)
+}
+
+// sendBudgetProgress responds with the budget's progress in the period holding the date
+func sendBudgetProgress(c *gin.Context, status int, message string, budget *models.Budget, date time.Time) {
+	progress, err := models.GetBudgetProgress(budget, date)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to compute budget progress", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	utils.SendResponse(c, status, message, progress, nil)
+}
+
+// sendBudgetSaveError reports a failed save, as a conflict when the category already has a budget for the period
+func sendBudgetSaveError(c *gin.Context, message string, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, models.ErrBudgetExists) {
+		status = http.StatusConflict
+	}
+	utils.SendResponse(c, status, message, nil, map[string]interface{}{"error": err.Error()})
+}
+
+// budgetDate reads the optional date query parameter, today by default
+func budgetDate(c *gin.Context) (time.Time, bool) {
+	value := c.Query("date")
+	if value == "" {
+		return time.Now(), true
+	}
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "date must be in YYYY-MM-DD format", nil, nil)
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+// loadBudget fetches the user's budget in the URL, sending the error response itself when it can't
+func loadBudget(c *gin.Context) (*models.Budget, bool) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return nil, false
+	}
+
+	budgetID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid budget ID", nil, nil)
+		return nil, false
+	}
+
+	budget, err := models.GetBudgetByID(budgetID, userID.(uuid.UUID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.SendResponse(c, http.StatusNotFound, "Budget not found", nil, nil)
+		} else {
+			utils.SendResponse(c, http.StatusInternalServerError, "Failed to fetch budget", nil, map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		return nil, false
+	}
+	return budget, true
+}
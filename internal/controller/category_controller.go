@@ -0,0 +1,292 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"receipt-mgmt/db"
+	"receipt-mgmt/internal/models"
+	"receipt-mgmt/internal/services"
+	"receipt-mgmt/utils"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var colorCodePattern = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+
+// categoryRequest is the payload for creating or updating a category; omitted fields are left unchanged on update
+type categoryRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	ColorCode   *string `json:"color_code"`
+}
+
+// applyTo validates the request and copies it onto the category, sending the error response itself when invalid
+func (r categoryRequest) applyTo(c *gin.Context, category *models.Category) bool {
+	if r.Name != nil {
+		name := strings.TrimSpace(*r.Name)
+		if name == "" || len(name) > 50 {
+			utils.SendResponse(c, http.StatusBadRequest, "name must be between 1 and 50 characters", nil, nil)
+			return false
+		}
+		category.Name = name
+	}
+	if r.Description != nil {
+		category.Description = strings.TrimSpace(*r.Description)
+	}
+	if r.ColorCode != nil {
+		if *r.ColorCode != "" && !colorCodePattern.MatchString(*r.ColorCode) {
+			utils.SendResponse(c, http.StatusBadRequest, "color_code must look like #RRGGBB", nil, nil)
+			return false
+		}
+		category.ColorCode = strings.ToUpper(*r.ColorCode)
+	}
+	return true
+}
+
+// GetCategories lists the default categories and the user's own
+func GetCategories(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return
+	}
+
+	categories, err := models.GetUserCategories(userID.(uuid.UUID))
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to fetch categories", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Categories retrieved successfully", categories, nil)
+}
+
+// GetCategoryByID returns a default category or one of the user's own
+func GetCategoryByID(c *gin.Context) {
+	category, ok := loadCategory(c)
+	if !ok {
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Category retrieved successfully", category, nil)
+}
+
+// CreateCategory adds a user-defined category
+func CreateCategory(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return
+	}
+
+	var request categoryRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid request body", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if request.Name == nil {
+		utils.SendResponse(c, http.StatusBadRequest, "name is required", nil, nil)
+		return
+	}
+
+	owner := userID.(uuid.UUID)
+	category := models.Category{ID: uuid.New(), UserID: &owner}
+	if !request.applyTo(c, &category) {
+		return
+	}
+
+	if err := models.SaveCategory(&category); err != nil {
+		sendCategorySaveError(c, "Failed to create category", err)
+		return
+	}
+
+	utils.SendResponse(c, http.StatusCreated, "Category created successfully", category, nil)
+}
+
+// UpdateCategory edits one of the user's own categories; default categories are read-only
+func UpdateCategory(c *gin.Context) {
+	category, ok := loadOwnedCategory(c)
+	if !ok {
+		return
+	}
+
+	var request categoryRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid request body", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if !request.applyTo(c, category) {
+		return
+	}
+
+	if err := models.SaveCategory(category); err != nil {
+		sendCategorySaveError(c, "Failed to update category", err)
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Category updated successfully", category, nil)
+}
+
+// DeleteCategory deletes one of the user's own categories, moving its receipts and expenses to the
+// category given by reassign_to or to the "Uncategorized" fallback
+func DeleteCategory(c *gin.Context) {
+	category, ok := loadOwnedCategory(c)
+	if !ok {
+		return
+	}
+
+	var fallbackID *uuid.UUID
+	if reassignTo := c.Query("reassign_to"); reassignTo != "" {
+		parsedID, err := uuid.Parse(reassignTo)
+		if err != nil {
+			utils.SendResponse(c, http.StatusBadRequest, "Invalid reassign_to category ID", nil, nil)
+			return
+		}
+		fallbackID = &parsedID
+	}
+
+	fallback, err := models.DeleteCategory(category, fallbackID)
+	if err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Failed to delete category", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Category deleted successfully", gin.H{
+		"reassigned_to": fallback,
+	}, nil)
+}
+
+// sendCategorySaveError reports a failed save, as a conflict when the name is already used
+func sendCategorySaveError(c *gin.Context, message string, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, models.ErrCategoryNameTaken) {
+		status = http.StatusConflict
+	}
+	utils.SendResponse(c, status, message, nil, map[string]interface{}{"error": err.Error()})
+}
+
+// loadCategory fetches the category in the URL if the user can see it, sending the error response itself when it can't
+func loadCategory(c *gin.Context) (*models.Category, bool) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return nil, false
+	}
+
+	categoryID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid category ID", nil, nil)
+		return nil, false
+	}
+
+	category, err := models.GetCategoryByID(db.GetDBInstance(), categoryID, userID.(uuid.UUID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.SendResponse(c, http.StatusNotFound, "Category not found", nil, nil)
+		} else {
+			utils.SendResponse(c, http.StatusInternalServerError, "Failed to fetch category", nil, map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		return nil, false
+	}
+	return category, true
+}
+
+// loadOwnedCategory fetches the category in the URL and checks it belongs to the user
+func loadOwnedCategory(c *gin.Context) (*models.Category, bool) {
+	category, ok := loadCategory(c)
+	if !ok {
+		return nil, false
+	}
+
+	userID, _ := c.Get("userId")
+	if !category.IsOwnedBy(userID.(uuid.UUID)) {
+		utils.SendResponse(c, http.StatusForbidden, "Default categories can't be modified", nil, nil)
+		return nil, false
+	}
+	return category, true
+}
+
+// GetReceiptCategorySuggestions ranks the categories for a receipt, best first
+func GetReceiptCategorySuggestions(c *gin.Context) {
+	receipt, ok := loadUserReceipt(c)
+	if !ok {
+		return
+	}
+
+	items, err := models.GetItemsByReceiptID(receipt.ReceiptID, receipt.UserID)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to fetch receipt items", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	itemNames := make([]string, 0, len(items))
+	for _, item := range items {
+		itemNames = append(itemNames, item.Name)
+	}
+
+	suggestions, err := models.SuggestReceiptCategories(receipt, itemNames)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to suggest categories", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Category suggestions retrieved successfully", suggestions, nil)
+}
+
+// AcceptReceiptCategory confirms the category suggested for a receipt so future receipts from the merchant follow it
+func AcceptReceiptCategory(c *gin.Context) {
+	receipt, ok := loadUserReceipt(c)
+	if !ok {
+		return
+	}
+	if !receipt.CategorySuggested {
+		utils.SendResponse(c, http.StatusBadRequest, "Receipt category is not a pending suggestion", nil, nil)
+		return
+	}
+
+	if err := models.AcceptSuggestedCategory(receipt); err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to accept category", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Category accepted successfully", receipt, nil)
+}
+
+// suggestReceiptCategory files a new receipt under the best suggested category, falling back to
+// "Uncategorized" when nothing points to one
+func suggestReceiptCategory(receipt *models.Receipt, lineItems []services.ReceiptLineItem) error {
+	itemNames := make([]string, 0, len(lineItems))
+	for _, item := range lineItems {
+		itemNames = append(itemNames, item.Name)
+	}
+
+	suggestions, err := models.SuggestReceiptCategories(receipt, itemNames)
+	if err != nil {
+		return err
+	}
+	if len(suggestions) == 0 {
+		fallback, err := models.FallbackCategory(db.GetDBInstance(), receipt.UserID)
+		if err != nil {
+			return err
+		}
+		suggestions = []models.CategorySuggestion{{CategoryID: fallback.ID, Name: fallback.Name}}
+	}
+
+	receipt.CategoryID = suggestions[0].CategoryID
+	receipt.CategorySuggested = true
+	receipt.CategoryConfidence = suggestions[0].Confidence
+	receipt.CategorySuggestions = suggestions
+	return nil
+}
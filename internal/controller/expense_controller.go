@@ -0,0 +1,229 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"receipt-mgmt/internal/models"
+	"receipt-mgmt/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// expenseRequest is the payload for updating an expense; omitted fields are left unchanged
+type expenseRequest struct {
+	Amount      *float64   `json:"amount"`
+	Date        *string    `json:"date"` // YYYY-MM-DD or RFC 3339
+	Description *string    `json:"description"`
+	CategoryID  *uuid.UUID `json:"category_id"`
+}
+
+// GetExpenses lists the user's expenses, latest first. With expand=receipt each expense embeds a
+// summary of its receipt.
+func GetExpenses(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return
+	}
+
+	filter := models.ExpenseFilter{
+		From:   c.Query("from"),
+		To:     c.Query("to"),
+		Search: strings.TrimSpace(c.Query("q")),
+	}
+	for _, date := range []string{filter.From, filter.To} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			utils.SendResponse(c, http.StatusBadRequest, "from and to must be in YYYY-MM-DD format", nil, nil)
+			return
+		}
+	}
+	for param, dest := range map[string]**uuid.UUID{"category_id": &filter.CategoryID, "receipt_id": &filter.ReceiptID} {
+		if value := c.Query(param); value != "" {
+			parsedID, err := uuid.Parse(value)
+			if err != nil {
+				utils.SendResponse(c, http.StatusBadRequest, "Invalid "+param, nil, nil)
+				return
+			}
+			*dest = &parsedID
+		}
+	}
+	for param, dest := range map[string]**float64{"min_amount": &filter.MinAmount, "max_amount": &filter.MaxAmount} {
+		if value := c.Query(param); value != "" {
+			amount, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				utils.SendResponse(c, http.StatusBadRequest, "Invalid "+param, nil, nil)
+				return
+			}
+			*dest = &amount
+		}
+	}
+	if linked := c.Query("linked"); linked != "" {
+		parsedLinked, err := strconv.ParseBool(linked)
+		if err != nil {
+			utils.SendResponse(c, http.StatusBadRequest, "Invalid linked value", nil, nil)
+			return
+		}
+		filter.Linked = &parsedLinked
+	}
+
+	expenses, err := models.GetUserExpenses(userID.(uuid.UUID), filter)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to fetch expenses", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if !expandReceipt(c) {
+		utils.SendResponse(c, http.StatusOK, "Expenses retrieved successfully", expenses, nil)
+		return
+	}
+	expanded, err := models.WithReceipts(userID.(uuid.UUID), expenses)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to fetch expense receipts", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	utils.SendResponse(c, http.StatusOK, "Expenses retrieved successfully", expanded, nil)
+}
+
+// GetExpenseByID returns one of the user's expenses, with its receipt summary when expand=receipt
+func GetExpenseByID(c *gin.Context) {
+	expense, ok := loadExpense(c)
+	if !ok {
+		return
+	}
+
+	if !expandReceipt(c) {
+		utils.SendResponse(c, http.StatusOK, "Expense retrieved successfully", expense, nil)
+		return
+	}
+	expanded, err := models.WithReceipts(expense.UserID, []models.Expense{*expense})
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to fetch expense receipt", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	utils.SendResponse(c, http.StatusOK, "Expense retrieved successfully", expanded[0], nil)
+}
+
+// UpdateExpense edits one of the user's expenses. The amount and date of an expense created from a
+// receipt follow the receipt and are corrected there; a new category also applies to the receipt.
+func UpdateExpense(c *gin.Context) {
+	expense, ok := loadExpense(c)
+	if !ok {
+		return
+	}
+
+	var request expenseRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid request body", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	changes := models.ExpenseChanges{Amount: request.Amount, CategoryID: request.CategoryID}
+	if request.Description != nil {
+		description := strings.TrimSpace(*request.Description)
+		changes.Description = &description
+	}
+	if request.Date != nil {
+		date, err := time.Parse("2006-01-02", *request.Date)
+		if err != nil {
+			if date, err = time.Parse(time.RFC3339, *request.Date); err != nil {
+				utils.SendResponse(c, http.StatusBadRequest, "date must be in YYYY-MM-DD or RFC 3339 format", nil, nil)
+				return
+			}
+		}
+		changes.Date = &date
+	}
+	if request.CategoryID != nil {
+		isValid, err := models.IsCategoryIDValid(request.CategoryID.String(), expense.UserID)
+		if err != nil {
+			utils.SendResponse(c, http.StatusInternalServerError, "Failed to check category", nil, map[string]interface{}{"error": err.Error()})
+			return
+		}
+		if !isValid {
+			utils.SendResponse(c, http.StatusBadRequest, "Invalid category_id", nil, nil)
+			return
+		}
+	}
+
+	if err := models.UpdateExpense(expense, changes); err != nil {
+		sendExpenseChangeError(c, "Failed to update expense", err)
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Expense updated successfully", expense, nil)
+}
+
+// DeleteExpense deletes one of the user's expenses; expenses created from a receipt go with the receipt
+func DeleteExpense(c *gin.Context) {
+	expense, ok := loadExpense(c)
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteExpense(expense); err != nil {
+		sendExpenseChangeError(c, "Failed to delete expense", err)
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Expense deleted successfully", nil, nil)
+}
+
+// sendExpenseChangeError reports a failed change, as a conflict when it has to be made on the receipt
+func sendExpenseChangeError(c *gin.Context, message string, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, models.ErrExpenseLinked) {
+		status = http.StatusConflict
+	}
+	utils.SendResponse(c, status, message, nil, map[string]interface{}{"error": err.Error()})
+}
+
+// expandReceipt reports whether the request asked for the receipt summary
+func expandReceipt(c *gin.Context) bool {
+	for _, field := range strings.Split(c.Query("expand"), ",") {
+		if strings.TrimSpace(field) == "receipt" {
+			return true
+		}
+	}
+	return false
+}
+
+// loadExpense fetches the user's expense in the URL, sending the error response itself when it can't
+func loadExpense(c *gin.Context) (*models.Expense, bool) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return nil, false
+	}
+
+	expenseID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid expense ID", nil, nil)
+		return nil, false
+	}
+
+	expense, err := models.GetExpenseByID(expenseID, userID.(uuid.UUID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.SendResponse(c, http.StatusNotFound, "Expense not found", nil, nil)
+		} else {
+			utils.SendResponse(c, http.StatusInternalServerError, "Failed to fetch expense", nil, map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		return nil, false
+	}
+	return expense, true
+}
@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"net/http"
+	"receipt-mgmt/db"
+	"receipt-mgmt/internal/models"
+	"receipt-mgmt/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// GetReceiptExpenseMatches lists the manual expenses that may have been logged for the receipt, best match first
+func GetReceiptExpenseMatches(c *gin.Context) {
+	receipt, ok := loadUserReceipt(c)
+	if !ok {
+		return
+	}
+
+	candidates, err := models.FindExpenseMatches(db.GetDBInstance(), receipt)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to match expenses", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Expense matches retrieved successfully", candidates, nil)
+}
+
+// LinkReceiptExpense links one of the user's manual expenses to the receipt, replacing the expense created on upload
+func LinkReceiptExpense(c *gin.Context) {
+	receipt, ok := loadUserReceipt(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		ExpenseID uuid.UUID `json:"expense_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid request body", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	expense, err := models.LinkReceiptExpense(receipt, request.ExpenseID)
+	if err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Failed to link expense", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Expense linked successfully", expense, nil)
+}
@@ -0,0 +1,385 @@
+package controller
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"receipt-mgmt/db"
+	"receipt-mgmt/internal/models"
+	"receipt-mgmt/internal/services"
+	"receipt-mgmt/utils"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// GetReceiptItems returns the line items of a single receipt
+func GetReceiptItems(c *gin.Context) {
+	receipt, ok := loadUserReceipt(c)
+	if !ok {
+		return
+	}
+
+	items, err := models.GetItemsByReceiptID(receipt.ReceiptID, receipt.UserID)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to fetch receipt items", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Receipt items retrieved successfully", items, nil)
+}
+
+// receiptItemRequest is the payload for adding or editing a line item
+type receiptItemRequest struct {
+	Name        *string  `json:"name"`
+	ProductCode *string  `json:"product_code"`
+	Quantity    *float64 `json:"quantity"`
+	UnitPrice   *float64 `json:"unit_price"`
+	TotalPrice  *float64 `json:"total_price"`
+	Discount    *float64 `json:"discount"`
+}
+
+// applyTo copies the provided fields onto the item, deriving the total when it isn't given
+func (r receiptItemRequest) applyTo(item *models.ReceiptItem) error {
+	if r.Name != nil {
+		item.Name = strings.TrimSpace(*r.Name)
+		item.NormalizedName = models.NormalizeItemName(item.Name)
+	}
+	if r.ProductCode != nil {
+		item.ProductCode = strings.TrimSpace(*r.ProductCode)
+	}
+	if r.Quantity != nil {
+		if *r.Quantity <= 0 {
+			return errors.New("quantity must be greater than zero")
+		}
+		item.Quantity = *r.Quantity
+	}
+	if r.UnitPrice != nil {
+		item.UnitPrice = *r.UnitPrice
+	}
+	if r.Discount != nil {
+		item.Discount = math.Abs(*r.Discount)
+	}
+
+	if r.TotalPrice != nil {
+		item.TotalPrice = *r.TotalPrice
+	} else if r.Quantity != nil || r.UnitPrice != nil || r.Discount != nil {
+		item.TotalPrice = math.Round((item.UnitPrice*item.Quantity-item.Discount)*100) / 100
+	}
+
+	// Keep the unit price in step when only the total was provided
+	if r.UnitPrice == nil && r.TotalPrice != nil && item.Quantity > 0 {
+		item.UnitPrice = math.Round((item.TotalPrice+item.Discount)/item.Quantity*100) / 100
+	}
+	return nil
+}
+
+// CreateReceiptItem adds a missing line item to a receipt
+func CreateReceiptItem(c *gin.Context) {
+	receipt, ok := loadUserReceipt(c)
+	if !ok {
+		return
+	}
+
+	var request receiptItemRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid request body", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if request.Name == nil || strings.TrimSpace(*request.Name) == "" {
+		utils.SendResponse(c, http.StatusBadRequest, "name is required", nil, nil)
+		return
+	}
+	if request.TotalPrice == nil && request.UnitPrice == nil {
+		utils.SendResponse(c, http.StatusBadRequest, "total_price or unit_price is required", nil, nil)
+		return
+	}
+
+	// User-entered items are fully trusted
+	item := models.ReceiptItem{
+		ItemID:     uuid.New(),
+		ReceiptID:  receipt.ReceiptID,
+		UserID:     receipt.UserID,
+		Quantity:   1,
+		Confidence: 1,
+	}
+	if err := request.applyTo(&item); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, err.Error(), nil, nil)
+		return
+	}
+
+	err := models.ApplyItemChange(receipt, func(tx *gorm.DB) error {
+		lineNumber, err := models.NextItemLineNumber(tx, receipt.ReceiptID)
+		if err != nil {
+			return err
+		}
+		item.LineNumber = lineNumber
+		return tx.Create(&item).Error
+	})
+	if err != nil {
+		sendItemChangeError(c, "Failed to add receipt item", err)
+		return
+	}
+
+	utils.SendResponse(c, http.StatusCreated, "Receipt item added successfully", receipt, nil)
+}
+
+// UpdateReceiptItem corrects the fields of an existing line item
+func UpdateReceiptItem(c *gin.Context) {
+	receipt, ok := loadUserReceipt(c)
+	if !ok {
+		return
+	}
+
+	item, ok := findReceiptItem(c, receipt)
+	if !ok {
+		return
+	}
+
+	var request receiptItemRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid request body", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if err := request.applyTo(&item); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, err.Error(), nil, nil)
+		return
+	}
+	item.Confidence = 1
+
+	err := models.ApplyItemChange(receipt, func(tx *gorm.DB) error {
+		return tx.Save(&item).Error
+	})
+	if err != nil {
+		sendItemChangeError(c, "Failed to update receipt item", err)
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Receipt item updated successfully", receipt, nil)
+}
+
+// DeleteReceiptItem removes a line item the OCR picked up by mistake
+func DeleteReceiptItem(c *gin.Context) {
+	receipt, ok := loadUserReceipt(c)
+	if !ok {
+		return
+	}
+
+	item, ok := findReceiptItem(c, receipt)
+	if !ok {
+		return
+	}
+
+	err := models.ApplyItemChange(receipt, func(tx *gorm.DB) error {
+		return tx.Delete(&item).Error
+	})
+	if err != nil {
+		sendItemChangeError(c, "Failed to delete receipt item", err)
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Receipt item deleted successfully", receipt, nil)
+}
+
+// sendItemChangeError reports a failed item change, as a conflict when the receipt's split is in the way
+func sendItemChangeError(c *gin.Context, message string, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, models.ErrItemInSplit) || errors.Is(err, models.ErrSplitOutdated) {
+		status = http.StatusConflict
+	}
+	utils.SendResponse(c, status, message, nil, map[string]interface{}{"error": err.Error()})
+}
+
+// SearchItems returns the user's line items across receipts matching the query filters
+func SearchItems(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return
+	}
+
+	filter := models.ItemFilter{
+		Name:        c.Query("name"),
+		ProductCode: c.Query("product_code"),
+		Merchant:    c.Query("merchant"),
+		FromDate:    c.Query("from"),
+		ToDate:      c.Query("to"),
+	}
+
+	items, err := models.FindItems(userID.(uuid.UUID), filter)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to fetch items", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Items retrieved successfully", items, nil)
+}
+
+// GetItemPriceHistory returns the price of an item over time, per kg or L when every purchase has a size
+func GetItemPriceHistory(c *gin.Context) {
+	userID, query, ok := bindItemPriceQuery(c)
+	if !ok {
+		return
+	}
+
+	history, err := models.GetItemPriceHistory(userID, query)
+	if err != nil {
+		sendItemPriceError(c, err)
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Item price history retrieved successfully", history, nil)
+}
+
+// CompareItemPrices returns the price of an item at each merchant it was bought from, cheapest first
+func CompareItemPrices(c *gin.Context) {
+	userID, query, ok := bindItemPriceQuery(c)
+	if !ok {
+		return
+	}
+
+	comparison, err := models.CompareItemPrices(userID, query)
+	if err != nil {
+		sendItemPriceError(c, err)
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Item prices compared successfully", comparison, nil)
+}
+
+// bindItemPriceQuery reads the item, date range and currency of a price query, sending the error
+// response itself when they are invalid
+func bindItemPriceQuery(c *gin.Context) (uuid.UUID, models.ItemPriceQuery, bool) {
+	query := models.ItemPriceQuery{
+		Name:        c.Query("name"),
+		ProductCode: c.Query("product_code"),
+		From:        c.Query("from"),
+		To:          c.Query("to"),
+	}
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return uuid.Nil, query, false
+	}
+
+	if itemID := c.Query("item_id"); itemID != "" {
+		parsedItemID, err := uuid.Parse(itemID)
+		if err != nil {
+			utils.SendResponse(c, http.StatusBadRequest, "Invalid item_id", nil, nil)
+			return uuid.Nil, query, false
+		}
+		query.ItemID = &parsedItemID
+	}
+	if query.ItemID == nil && models.NormalizeItemName(query.Name) == "" && strings.TrimSpace(query.ProductCode) == "" {
+		utils.SendResponse(c, http.StatusBadRequest, "name, product_code or item_id is required", nil, nil)
+		return uuid.Nil, query, false
+	}
+	for _, date := range []struct{ key, value string }{{"from", query.From}, {"to", query.To}} {
+		if date.value == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", date.value); err != nil {
+			utils.SendResponse(c, http.StatusBadRequest, date.key+" must be in YYYY-MM-DD format", nil, nil)
+			return uuid.Nil, query, false
+		}
+	}
+
+	var ok bool
+	if query.Currency, ok = queryCurrency(c, userID.(uuid.UUID)); !ok {
+		return uuid.Nil, query, false
+	}
+	return userID.(uuid.UUID), query, true
+}
+
+// sendItemPriceError reports a failed price query, as not found when the item_id isn't one of the user's items
+func sendItemPriceError(c *gin.Context, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		utils.SendResponse(c, http.StatusNotFound, "Item not found", nil, nil)
+		return
+	}
+	utils.SendResponse(c, http.StatusInternalServerError, "Failed to fetch item prices", nil, map[string]interface{}{
+		"error": err.Error(),
+	})
+}
+
+// buildReceiptItems converts the parsed line items into item rows for the given receipt
+func buildReceiptItems(receiptID, userID uuid.UUID, lineItems []services.ReceiptLineItem) []models.ReceiptItem {
+	items := make([]models.ReceiptItem, 0, len(lineItems))
+	for i, lineItem := range lineItems {
+		items = append(items, models.ReceiptItem{
+			ItemID:         uuid.New(),
+			ReceiptID:      receiptID,
+			UserID:         userID,
+			LineNumber:     i + 1,
+			Name:           lineItem.Name,
+			NormalizedName: models.NormalizeItemName(lineItem.Name),
+			ProductCode:    lineItem.ProductCode,
+			Quantity:       lineItem.Quantity,
+			UnitPrice:      lineItem.UnitPrice,
+			TotalPrice:     lineItem.TotalPrice,
+			Discount:       lineItem.Discount,
+			Confidence:     lineItem.Confidence,
+		})
+	}
+	return items
+}
+
+// loadUserReceipt fetches the receipt named in the URL for the authenticated user,
+// sending the error response itself when it can't
+func loadUserReceipt(c *gin.Context) (*models.Receipt, bool) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return nil, false
+	}
+
+	receiptID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid receipt ID", nil, nil)
+		return nil, false
+	}
+
+	receipt, err := models.GetReceiptByID(receiptID, userID.(uuid.UUID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.SendResponse(c, http.StatusNotFound, "Receipt not found", nil, nil)
+		} else {
+			utils.SendResponse(c, http.StatusInternalServerError, "Failed to fetch receipt", nil, map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		return nil, false
+	}
+	return &receipt, true
+}
+
+// findReceiptItem fetches the item named in the URL from the given receipt
+func findReceiptItem(c *gin.Context, receipt *models.Receipt) (models.ReceiptItem, bool) {
+	var item models.ReceiptItem
+
+	itemID, err := uuid.Parse(c.Param("itemId"))
+	if err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid item ID", nil, nil)
+		return item, false
+	}
+
+	DB := db.GetDBInstance()
+	if err := DB.Where("item_id = ? AND receipt_id = ?", itemID, receipt.ReceiptID).First(&item).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.SendResponse(c, http.StatusNotFound, "Receipt item not found", nil, nil)
+		} else {
+			utils.SendResponse(c, http.StatusInternalServerError, "Failed to fetch receipt item", nil, map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		return item, false
+	}
+	return item, true
+}
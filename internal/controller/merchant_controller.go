@@ -0,0 +1,246 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"receipt-mgmt/db"
+	"receipt-mgmt/internal/models"
+	"receipt-mgmt/utils"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// GetMerchants lists the canonical merchants the user's receipts resolve to
+func GetMerchants(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return
+	}
+
+	merchants, err := models.GetUserMerchants(userID.(uuid.UUID), c.Query("q"))
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to fetch merchants", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Merchants retrieved successfully", merchants, nil)
+}
+
+// GetMerchantByID returns a merchant with the aliases that apply to the user
+func GetMerchantByID(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return
+	}
+
+	merchant, ok := loadMerchant(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	aliases, err := models.GetMerchantAliases(merchant.MerchantID, userID.(uuid.UUID))
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to fetch merchant aliases", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Merchant retrieved successfully", gin.H{
+		"merchant": merchant,
+		"aliases":  aliases,
+	}, nil)
+}
+
+// merchantAliasRequest is the payload for adding a user alias to a merchant
+type merchantAliasRequest struct {
+	Pattern string `json:"pattern" binding:"required"`
+	IsRegex bool   `json:"is_regex"`
+}
+
+// AddMerchantAlias maps a name or pattern to the merchant for the authenticated user
+func AddMerchantAlias(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return
+	}
+
+	merchant, ok := loadMerchant(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var request merchantAliasRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid request body", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	alias, err := models.AddUserAlias(db.GetDBInstance(), userID.(uuid.UUID), merchant.MerchantID, request.Pattern, request.IsRegex)
+	if err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Failed to add merchant alias", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusCreated, "Merchant alias added successfully", alias, nil)
+}
+
+// DeleteMerchantAlias removes one of the user's own aliases
+func DeleteMerchantAlias(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return
+	}
+
+	aliasID, err := uuid.Parse(c.Param("aliasId"))
+	if err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid alias ID", nil, nil)
+		return
+	}
+
+	// Global aliases can't be removed by users
+	result := db.GetDBInstance().Where("alias_id = ? AND merchant_id = ? AND user_id = ?", aliasID, c.Param("id"), userID).
+		Delete(&models.MerchantAlias{})
+	if result.Error != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to delete merchant alias", nil, map[string]interface{}{"error": result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		utils.SendResponse(c, http.StatusNotFound, "Merchant alias not found", nil, nil)
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Merchant alias deleted successfully", nil, nil)
+}
+
+// mergeMerchantsRequest is the payload for merging merchants into another one
+type mergeMerchantsRequest struct {
+	MerchantIDs []uuid.UUID `json:"merchant_ids" binding:"required,min=1"`
+}
+
+// MergeMerchants folds the given merchants into the one in the URL for the authenticated user
+func MergeMerchants(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return
+	}
+
+	target, ok := loadMerchant(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var request mergeMerchantsRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid request body", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	if err := models.MergeMerchants(userID.(uuid.UUID), target.MerchantID, request.MerchantIDs); err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to merge merchants", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Merchants merged successfully", target, nil)
+}
+
+// correctMerchantRequest is the payload for correcting the merchant of a receipt
+type correctMerchantRequest struct {
+	MerchantID *uuid.UUID `json:"merchant_id"`
+	Name       string     `json:"name"`
+}
+
+// CorrectReceiptMerchant points a receipt at the right merchant and remembers the printed
+// name as a user alias so future receipts from the same store resolve correctly
+func CorrectReceiptMerchant(c *gin.Context) {
+	receipt, ok := loadUserReceipt(c)
+	if !ok {
+		return
+	}
+
+	var request correctMerchantRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid request body", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if request.MerchantID == nil && strings.TrimSpace(request.Name) == "" {
+		utils.SendResponse(c, http.StatusBadRequest, "merchant_id or name is required", nil, nil)
+		return
+	}
+
+	DB := db.GetDBInstance()
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		merchant, err := correctMerchant(tx, receipt, request.MerchantID, request.Name)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.Receipt{}).Where("receipt_id = ?", receipt.ReceiptID).
+			Update("merchant_id", merchant.MerchantID).Error
+	})
+	if err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Failed to correct merchant", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Receipt merchant corrected successfully", receipt, nil)
+}
+
+// correctMerchant resolves the merchant the user picked and learns the receipt's printed
+// name as a user alias for it
+func correctMerchant(tx *gorm.DB, receipt *models.Receipt, merchantID *uuid.UUID, name string) (*models.Merchant, error) {
+	var merchant *models.Merchant
+	var err error
+	if merchantID != nil {
+		merchant, err = models.GetMerchantByID(tx, *merchantID)
+	} else {
+		merchant, err = models.ResolveMerchant(tx, receipt.UserID, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if merchant == nil {
+		return nil, errors.New("merchant name is not usable")
+	}
+
+	// Learn the printed name so the next receipt from this store resolves the same way
+	if models.NormalizeMerchantName(receipt.Merchant) != "" && models.NormalizeMerchantName(receipt.Merchant) != merchant.NormalizedName {
+		if _, err := models.AddUserAlias(tx, receipt.UserID, merchant.MerchantID, receipt.Merchant, false); err != nil {
+			return nil, err
+		}
+	}
+
+	receipt.MerchantID = &merchant.MerchantID
+	return merchant, nil
+}
+
+// loadMerchant fetches the merchant with the given ID, sending the error response itself when it can't
+func loadMerchant(c *gin.Context, id string) (*models.Merchant, bool) {
+	merchantID, err := uuid.Parse(id)
+	if err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid merchant ID", nil, nil)
+		return nil, false
+	}
+
+	merchant, err := models.GetMerchantByID(db.GetDBInstance(), merchantID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.SendResponse(c, http.StatusNotFound, "Merchant not found", nil, nil)
+		} else {
+			utils.SendResponse(c, http.StatusInternalServerError, "Failed to fetch merchant", nil, map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		return nil, false
+	}
+	return merchant, true
+}
@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"receipt-mgmt/db"
+	"receipt-mgmt/internal/models"
+	"receipt-mgmt/utils"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var lastFourPattern = regexp.MustCompile(`^\d{4}$`)
+
+// paymentAccountRequest is the payload for creating or updating a payment account
+type paymentAccountRequest struct {
+	Name      string `json:"name" binding:"required"`
+	CardBrand string `json:"card_brand"`
+	LastFour  string `json:"last_four" binding:"required"`
+}
+
+// GetPaymentAccounts lists the authenticated user's payment accounts
+func GetPaymentAccounts(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return
+	}
+
+	accounts, err := models.GetPaymentAccounts(userID.(uuid.UUID))
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to fetch payment accounts", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Payment accounts retrieved successfully", accounts, nil)
+}
+
+// CreatePaymentAccount names a card and links the user's receipts paid with it
+func CreatePaymentAccount(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return
+	}
+
+	var request paymentAccountRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid request body", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	account := models.PaymentAccount{
+		AccountID: uuid.New(),
+		UserID:    userID.(uuid.UUID),
+	}
+	if !request.applyTo(c, &account) {
+		return
+	}
+
+	if err := models.SavePaymentAccount(&account); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Failed to create payment account", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusCreated, "Payment account created successfully", account, nil)
+}
+
+// UpdatePaymentAccount renames an account or changes the card it matches
+func UpdatePaymentAccount(c *gin.Context) {
+	account, ok := loadPaymentAccount(c)
+	if !ok {
+		return
+	}
+
+	var request paymentAccountRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid request body", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if !request.applyTo(c, account) {
+		return
+	}
+
+	if err := models.SavePaymentAccount(account); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Failed to update payment account", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Payment account updated successfully", account, nil)
+}
+
+// DeletePaymentAccount removes an account; its receipts keep their card details
+func DeletePaymentAccount(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return
+	}
+
+	accountID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid payment account ID", nil, nil)
+		return
+	}
+
+	deleted, err := models.DeletePaymentAccount(accountID, userID.(uuid.UUID))
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to delete payment account", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !deleted {
+		utils.SendResponse(c, http.StatusNotFound, "Payment account not found", nil, nil)
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Payment account deleted successfully", nil, nil)
+}
+
+// applyTo validates the request and copies it onto the account, sending the error response itself when invalid
+func (r paymentAccountRequest) applyTo(c *gin.Context, account *models.PaymentAccount) bool {
+	if !lastFourPattern.MatchString(r.LastFour) {
+		utils.SendResponse(c, http.StatusBadRequest, "last_four must be exactly four digits", nil, nil)
+		return false
+	}
+
+	account.Name = strings.TrimSpace(r.Name)
+	account.CardBrand = strings.ToUpper(strings.TrimSpace(r.CardBrand))
+	account.LastFour = r.LastFour
+	return true
+}
+
+// loadPaymentAccount fetches the user's account from the URL, sending the error response itself when it can't
+func loadPaymentAccount(c *gin.Context) (*models.PaymentAccount, bool) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return nil, false
+	}
+
+	accountID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid payment account ID", nil, nil)
+		return nil, false
+	}
+
+	var account models.PaymentAccount
+	err = db.GetDBInstance().Where("account_id = ? AND user_id = ?", accountID, userID).First(&account).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.SendResponse(c, http.StatusNotFound, "Payment account not found", nil, nil)
+		} else {
+			utils.SendResponse(c, http.StatusInternalServerError, "Failed to fetch payment account", nil, map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		return nil, false
+	}
+	return &account, true
+}
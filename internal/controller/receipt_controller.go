@@ -4,12 +4,15 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"receipt-mgmt/db"
 	"receipt-mgmt/internal/common"
 	"receipt-mgmt/internal/models"
 	"receipt-mgmt/internal/services"
 	"receipt-mgmt/utils"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -40,21 +43,26 @@ func UploadReceipt(c *gin.Context) {
 	}
 	defer file.Close()
 
-	// Get the category_id from the form
+	// Get the optional category_id from the form; a category is suggested when it is missing
 	categoryID := c.PostForm("category_id")
-	if categoryID == "" {
-		utils.SendResponse(c, http.StatusBadRequest, "category_id is required", nil, nil)
-		return
-	}
 
 	// Validate category_id
-	isValid, err := models.IsCategoryIDValid(categoryID)
-	if err != nil {
-		utils.SendResponse(c, http.StatusInternalServerError, fmt.Sprintf("Error checking category: %v", err), nil, nil)
-		return
+	if categoryID != "" {
+		isValid, err := models.IsCategoryIDValid(categoryID, userID.(uuid.UUID))
+		if err != nil {
+			utils.SendResponse(c, http.StatusInternalServerError, fmt.Sprintf("Error checking category: %v", err), nil, nil)
+			return
+		}
+		if !isValid {
+			utils.SendResponse(c, http.StatusBadRequest, "Invalid category_id", nil, nil)
+			return
+		}
 	}
-	if !isValid {
-		utils.SendResponse(c, http.StatusBadRequest, "Invalid category_id", nil, nil)
+
+	// Optional locale hint, detected from the receipt text when not given
+	locale := c.PostForm("locale")
+	if locale != "" && services.NormalizeLocale(locale) == "" {
+		utils.SendResponse(c, http.StatusBadRequest, "Unsupported locale, expected en-CA or fr-CA", nil, nil)
 		return
 	}
 
@@ -117,17 +125,20 @@ func UploadReceipt(c *gin.Context) {
   }
 
 	// Step 3: Return extracted details Parse the receipt information
-  parsedReceiptDetails, err := services.ParseReceiptInformation(receiptDetails)
+  parsedReceiptDetails, err := services.ParseReceiptInformation(receiptDetails, locale)
   if err != nil {
     utils.SendResponse(c, http.StatusInternalServerError, fmt.Sprintf("Failed to parse receipt details: %v", err), nil, nil)
     return
   }
 
 	// Convert to uuid.UUID
-	parsedCategoryID, err := uuid.Parse(categoryID)
-	if err != nil {
-		utils.SendResponse(c, http.StatusBadRequest, "Invalid category ID", nil, nil)
-		return
+	var parsedCategoryID uuid.UUID
+	if categoryID != "" {
+		parsedCategoryID, err = uuid.Parse(categoryID)
+		if err != nil {
+			utils.SendResponse(c, http.StatusBadRequest, "Invalid category ID", nil, nil)
+			return
+		}
 	}
 	
   // Prepare Receipt Model
@@ -136,88 +147,145 @@ func UploadReceipt(c *gin.Context) {
 		UserID:          userID.(uuid.UUID),
 		CategoryID: 		 parsedCategoryID,	
 		Image:           fileBytes, 	// Store the actual image as byte array
-		Status:          "completed",
+		Status:          models.ReceiptStatusCompleted,
+		Type:            models.ReceiptTypePurchase,
+		ReceiptNumber:   parsedReceiptDetails.ReceiptNumber,
 		TotalAmount:     parsedReceiptDetails.TotalAmount,
 		Merchant:        parsedReceiptDetails.Merchant,
+		MerchantAddress: parsedReceiptDetails.MerchantDetails.Address,
+		MerchantStreet:  parsedReceiptDetails.MerchantDetails.Street,
+		MerchantCity:    parsedReceiptDetails.MerchantDetails.City,
+		MerchantProvince: parsedReceiptDetails.MerchantDetails.Province,
+		MerchantPostalCode: parsedReceiptDetails.MerchantDetails.PostalCode,
+		MerchantPhone:   parsedReceiptDetails.MerchantDetails.Phone,
+		StoreNumber:     parsedReceiptDetails.MerchantDetails.StoreNumber,
 		ScannedDate:     time.Now(),
 		TransactionDate: parsedReceiptDetails.TransactionDate, // Extracted from receipt
 		TransactionTime: parsedReceiptDetails.TransactionTime, // Extracted from receipt
+		Locale:          parsedReceiptDetails.Locale,
 		Tax:             parsedReceiptDetails.Tax,
+		PaymentMethod:   parsedReceiptDetails.Payment.Method,
+		CardBrand:       parsedReceiptDetails.Payment.CardBrand,
+		CardLastFour:    parsedReceiptDetails.Payment.CardLastFour,
+		CashTendered:    parsedReceiptDetails.Payment.CashTendered,
+		ChangeDue:       parsedReceiptDetails.Payment.ChangeDue,
 		Discounts:       parsedReceiptDetails.Discounts,
+		Subtotal:        parsedReceiptDetails.Subtotal,
+		Tip:             parsedReceiptDetails.Tip,
 		Items:           parsedReceiptDetails.Items, // Assuming items are in JSON format
+		OCRText:         services.MaskCardNumbers(strings.Join(parsedReceiptDetails.TextLines, "\n")), // Searchable, never with a full card number
 		FileHash: 			 fileHash,			
 	}
-
-	// Save Receipt and Associated Items
-	if err := models.CreateReceipt(&receipt); err != nil {
-		utils.SendResponse(c, http.StatusInternalServerError, "Failed to save receipt", nil, map[string]interface{}{
-			"error": err.Error(), // Include detailed error message
+	receipt.LineItems = buildReceiptItems(receipt.ReceiptID, receipt.UserID, parsedReceiptDetails.LineItems)
+	// Record the receipt currency and convert the total into the user's currency
+	if err := convertReceiptAmount(&receipt, parsedReceiptDetails.Currency); err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to convert receipt amount", nil, map[string]interface{}{
+			"error": err.Error(),
 		})
 		return
 	}
 
-	// Parse TransactionDate from string to time.Time
-	var combinedDateTime time.Time
+	// Resolve the printed merchant name to its canonical merchant
+	merchant, err := models.ResolveMerchant(db.GetDBInstance(), receipt.UserID, receipt.Merchant)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to resolve merchant", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	if merchant != nil {
+		receipt.MerchantID = &merchant.MerchantID
+	}
 
-	// Handle missing TransactionDate or TransactionTime
-	if parsedReceiptDetails.TransactionDate == "" && parsedReceiptDetails.TransactionTime == "" {
-		// Fallback to current date and time
-		combinedDateTime = time.Now()
-	} else {
-		// Parse TransactionDate if available
-		transactionDate := time.Now()
-		if parsedReceiptDetails.TransactionDate != "" {
-			transactionDate, err = time.Parse("2006-01-02", parsedReceiptDetails.TransactionDate)
-			if err != nil {
-				utils.SendResponse(c, http.StatusBadRequest, fmt.Sprintf("Invalid transaction date: %v", err), nil, nil)
-				return
-			}
+	// Suggest a category when none was chosen; a chosen one is learned for this merchant when the receipt is saved
+	if categoryID == "" {
+		if err := suggestReceiptCategory(&receipt, parsedReceiptDetails.LineItems); err != nil {
+			utils.SendResponse(c, http.StatusInternalServerError, "Failed to suggest a category", nil, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
 		}
+	}
 
-		// Parse TransactionTime if available
-		if parsedReceiptDetails.TransactionTime != "" {
-			transactionTime, err := time.Parse("15:04:05", parsedReceiptDetails.TransactionTime)
-			if err != nil {
-					utils.SendResponse(c, http.StatusBadRequest, fmt.Sprintf("Invalid transaction time: %v", err), nil, nil)
-					return
-			}
-	
-			// Combine date and time
-			combinedDateTime = time.Date(
-					transactionDate.Year(), transactionDate.Month(), transactionDate.Day(),
-					transactionTime.Hour(), transactionTime.Minute(), transactionTime.Second(),
-					0, time.UTC,
-			)
-		} else {
-				// Use the transaction date with default time (midnight)
-				combinedDateTime = time.Date(
-						transactionDate.Year(), transactionDate.Month(), transactionDate.Day(),
-						0, 0, 0, 0, time.UTC,
-				)
+	// Link a refund to the purchase it returns
+	if parsedReceiptDetails.IsRefund {
+		receipt.Type = models.ReceiptTypeRefund
+		original, err := models.FindOriginalReceipt(db.GetDBInstance(), &receipt, parsedReceiptDetails.OriginalReceiptNumber)
+		if err != nil {
+			utils.SendResponse(c, http.StatusInternalServerError, "Failed to match original receipt", nil, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		if original != nil {
+			receipt.OriginalReceiptID = &original.ReceiptID
 		}
-	
 	}
 
-	// Create expense with fallback or parsed date
-	expense := models.Expense{
-		ExpenseID:   uuid.New(),
-		UserID:      receipt.UserID,
-		CategoryID:  receipt.CategoryID,
-		Amount:      receipt.TotalAmount,
-		Date:        combinedDateTime, // Always valid
-		Description: fmt.Sprintf("Expense from receipt: %s", receipt.Merchant),
-		ReceiptID:   &receipt.ReceiptID, // Link to the receipt
+	// Link the card to one of the user's named payment accounts
+	account, err := models.FindPaymentAccount(db.GetDBInstance(), receipt.UserID, receipt.CardBrand, receipt.CardLastFour)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to match payment account", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	if account != nil {
+		receipt.PaymentAccountID = &account.AccountID
 	}
 
-	if err := models.CreateExpense(&expense); err != nil {
-		utils.SendResponse(c, http.StatusInternalServerError, "Failed to save expense", nil, map[string]interface{}{
+	// Run the user's categorization and tagging rules
+	if err := applyReceiptRules(&receipt); err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to apply rules", nil, map[string]interface{}{
 			"error": err.Error(),
 		})
 		return
 	}
 
+	receipt.Taxes = buildReceiptTaxes(receipt.ReceiptID, receipt.UserID, parsedReceiptDetails.Taxes)
+	receipt.Reconcile(receipt.LineItems)
+
+	// Link an expense the user already logged by hand instead of creating a duplicate
+	candidates, err := models.FindExpenseMatches(db.GetDBInstance(), &receipt)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to match expenses", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	var linkExpenseID *uuid.UUID
+	message := "Receipt processed successfully"
+	if match := models.AutoLinkCandidate(candidates); match != nil {
+		linkExpenseID = &match.Expense.ExpenseID
+		message = "Receipt processed and linked to an existing expense"
+	} else {
+		receipt.ExpenseCandidates = candidates
+	}
+
+	// Save the receipt, its items and its expense as one unit of work
+	if _, err := models.CreateReceiptWithExpense(&receipt, linkExpenseID, categoryID != ""); err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to save receipt", nil, map[string]interface{}{
+			"error": err.Error(), // Include detailed error message
+		})
+		return
+	}
+
+	// Raise the budget alerts the new expense triggers
+	alerts, err := models.CheckBudgetThresholds(&receipt)
+	if err != nil {
+		log.Printf("Failed to check budgets for receipt %s: %v", receipt.ReceiptID, err)
+	}
+	receipt.BudgetAlerts = alerts
+
+	// Keep the user's recurring charges at this merchant up to date with the new purchase
+	if receipt.MerchantID != nil {
+		if err := models.DetectMerchantRecurringSeries(receipt.UserID, *receipt.MerchantID); err != nil {
+			log.Printf("Failed to update recurring series for user %s: %v", receipt.UserID, err)
+		}
+	}
+
 	// Respond with success
-	utils.SendResponse(c, http.StatusOK, "Receipt processed successfully", receipt, nil)
+	utils.SendResponse(c, http.StatusOK, message, receipt, nil)
 }
 
 // Get all receipts
@@ -228,15 +296,131 @@ func GetAllReceipts(c *gin.Context) {
 			return
 	}
 
-	receipts, err := models.GetReceiptsByUserID(userID.(uuid.UUID))
+	filter, ok := bindReceiptListFilter(c)
+	if !ok {
+			return
+	}
+
+	// Sorting and paging: page/limit, or cursor for stable walks through a changing list
+	page := models.ReceiptPageRequest{
+		Sort:  c.DefaultQuery("sort", "transaction_date"),
+		Order: strings.ToLower(c.DefaultQuery("order", "desc")),
+		Page:  utils.ParseQueryInt(c, "page", 1),
+		Limit: utils.ParseQueryInt(c, "limit", defaultReceiptPageSize),
+	}
+	if !models.ValidReceiptSort(page.Sort) {
+			utils.SendResponse(c, http.StatusBadRequest, "sort must be transaction_date, amount or created_at", nil, nil)
+			return
+	}
+	if page.Order != "asc" && page.Order != "desc" {
+			utils.SendResponse(c, http.StatusBadRequest, "order must be asc or desc", nil, nil)
+			return
+	}
+	if page.Page < 1 {
+			page.Page = 1
+	}
+	if page.Limit < 1 {
+			page.Limit = defaultReceiptPageSize
+	} else if page.Limit > maxReceiptPageSize {
+			page.Limit = maxReceiptPageSize
+	}
+	if cursor, ok := c.GetQuery("cursor"); ok {
+			page.Cursor = &cursor
+	}
+
+	receipts, result, err := models.GetReceiptsByUserID(userID.(uuid.UUID), filter, page)
 	if err != nil {
+			if errors.Is(err, models.ErrInvalidCursor) {
+					utils.SendResponse(c, http.StatusBadRequest, "Invalid cursor", nil, nil)
+					return
+			}
 			utils.SendResponse(c, http.StatusInternalServerError, "Failed to fetch receipts", nil, map[string]interface{}{
 					"error": err.Error(),
 			})
 			return
 	}
 
-	utils.SendResponse(c, http.StatusOK, "Receipts retrieved successfully", receipts, nil)
+	pagination := utils.CalculatePagination(result.TotalCount, page.Page, page.Limit)
+	if page.Cursor != nil {
+			utils.SendPaginatedResponse(c, http.StatusOK, "Receipts retrieved successfully", receipts, pagination.WithCursor(result.NextCursor))
+			return
+	}
+	utils.SendPaginatedResponse(c, http.StatusOK, "Receipts retrieved successfully", receipts, pagination)
+}
+
+const (
+	defaultReceiptPageSize = 20
+	maxReceiptPageSize     = 100
+)
+
+// bindReceiptListFilter reads the filters shared by the receipt list and search, sending the
+// error response itself when one is invalid
+func bindReceiptListFilter(c *gin.Context) (models.ReceiptFilter, bool) {
+	// Optional filters on the merchant's location and branch
+	filter := models.ReceiptFilter{
+		MerchantCity:       c.Query("city"),
+		MerchantProvince:   c.Query("province"),
+		MerchantPostalCode: c.Query("postal_code"),
+		MerchantPhone:      services.NormalizePhoneNumber(c.Query("phone")),
+		StoreNumber:        c.Query("store_number"),
+		Type:               c.Query("type"),
+		PaymentMethod:      c.Query("payment_method"),
+		CardBrand:          c.Query("card_brand"),
+		CardLastFour:       c.Query("card_last_four"),
+		Tag:                c.Query("tag"),
+	}
+	if flagged := c.Query("flagged"); flagged != "" {
+		parsedFlagged, err := strconv.ParseBool(flagged)
+		if err != nil {
+			utils.SendResponse(c, http.StatusBadRequest, "Invalid flagged value", nil, nil)
+			return filter, false
+		}
+		filter.Flagged = &parsedFlagged
+	}
+	if accountID := c.Query("payment_account_id"); accountID != "" {
+		parsedAccountID, err := uuid.Parse(accountID)
+		if err != nil {
+			utils.SendResponse(c, http.StatusBadRequest, "Invalid payment_account_id", nil, nil)
+			return filter, false
+		}
+		filter.PaymentAccountID = &parsedAccountID
+	}
+
+	// Date, merchant, category, amount and status
+	for _, key := range []string{"from", "to"} {
+		if value := c.Query(key); value != "" {
+			if _, err := time.Parse("2006-01-02", value); err != nil {
+				utils.SendResponse(c, http.StatusBadRequest, key+" must be in YYYY-MM-DD format", nil, nil)
+				return filter, false
+			}
+		}
+	}
+	filter.From = c.Query("from")
+	filter.To = c.Query("to")
+	filter.Merchant = strings.TrimSpace(c.Query("merchant"))
+	filter.Status = c.Query("status")
+
+	for key, target := range map[string]**uuid.UUID{"merchant_id": &filter.MerchantID, "category_id": &filter.CategoryID} {
+		if value := c.Query(key); value != "" {
+			id, err := uuid.Parse(value)
+			if err != nil {
+				utils.SendResponse(c, http.StatusBadRequest, "Invalid "+key, nil, nil)
+				return filter, false
+			}
+			*target = &id
+		}
+	}
+	for key, target := range map[string]**float64{"min_amount": &filter.MinAmount, "max_amount": &filter.MaxAmount} {
+		if value := c.Query(key); value != "" {
+			amount, err := strconv.ParseFloat(value, 64)
+			if err != nil || amount < 0 {
+				utils.SendResponse(c, http.StatusBadRequest, "Invalid "+key, nil, nil)
+				return filter, false
+			}
+			*target = &amount
+		}
+	}
+	return filter, true
 }
 
 // Get single Receipts
@@ -261,7 +445,9 @@ func GetReceiptByID(c *gin.Context) {
 	// Check if the receipt exists for the user in the database
 	DB := db.GetDBInstance()
 	var receipt models.Receipt
-	err = DB.Where("receipt_id = ? AND user_id = ?", receiptID, userID).First(&receipt).Error
+	err = DB.Preload("LineItems", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order("line_number ASC")
+	}).Preload("Taxes").Where("receipt_id = ? AND user_id = ?", receiptID, userID).First(&receipt).Error
 	if err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 					utils.SendResponse(c, http.StatusNotFound, "Receipt not found", nil, nil)
@@ -278,40 +464,59 @@ func GetReceiptByID(c *gin.Context) {
 }
 
 
-// DeleteReceipt deletes a receipt by its ID permanently
+// DeleteReceipt deletes one of the user's receipts, handling its expenses by the configured on_delete policy
 func DeleteReceipt(c *gin.Context) {
-	// Get the receipt ID from the URL parameter
-	receiptIDStr := c.Param("id")
-	receiptID, err := uuid.Parse(receiptIDStr)
-	if err != nil {
-		// Return bad request if ID format is invalid
-		utils.SendResponse(c, http.StatusBadRequest, "Invalid receipt ID format", nil, err)
-		return
-	}
-
-	// Get DB instance
-	DB := db.GetDBInstance()
-
-	// Check if the receipt exists for the user and is not deleted (no soft delete)
-	var receipt models.Receipt
-	if err := DB.Where("receipt_id = ?", receiptID).First(&receipt).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			// Return not found if receipt does not exist
-			utils.SendResponse(c, http.StatusNotFound, "Receipt not found", nil, nil)
-		} else {
-			// Return internal server error if fetching receipt fails
-			utils.SendResponse(c, http.StatusInternalServerError, "Failed to check receipt", nil, map[string]interface{}{"error": err.Error()})
-		}
+	receipt, ok := loadUserReceipt(c)
+	if !ok {
 		return
 	}
 
-	// Perform the actual permanent deletion (remove the receipt from the database)
-	if err := DB.Unscoped().Delete(&receipt).Error; err != nil {
+	if err := models.DeleteReceipt(receipt); err != nil {
 		// Return internal server error if deletion fails
-		utils.SendResponse(c, http.StatusInternalServerError, "Failed to delete receipt", nil, err)
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to delete receipt", nil, map[string]interface{}{"error": err.Error()})
 		return
 	}
 
 	// Send the success response after deletion
-	utils.SendResponse(c, http.StatusOK, "Receipt deleted successfully", nil, nil)
+	utils.SendResponse(c, http.StatusOK, "Receipt deleted successfully", gin.H{
+		"expense_policy": models.ExpenseDeletePolicy(),
+	}, nil)
+}
+
+
+// convertReceiptAmount stores the receipt currency, defaulting to the user's own, and the total
+// converted into the user's currency. A missing exchange rate leaves the amount unconverted, which
+// keeps it out of the expense and puts the receipt up for review.
+func convertReceiptAmount(receipt *models.Receipt, detectedCurrency string) error {
+	userCurrency, err := models.GetUserCurrency(receipt.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to load user currency: %w", err)
+	}
+
+	receipt.Currency = detectedCurrency
+	if receipt.Currency == "" {
+		receipt.Currency = userCurrency
+	}
+	receipt.ConvertedCurrency = userCurrency
+	if receipt.Currency == userCurrency {
+		receipt.ConvertedAmount, receipt.ExchangeRate = receipt.TotalAmount, 1
+		return nil
+	}
+
+	// Use the rate of the transaction day when it is known
+	rateDate := time.Now()
+	if transactionDate, err := time.Parse("2006-01-02", receipt.TransactionDate); err == nil {
+		rateDate = transactionDate
+	}
+
+	provider, err := services.GetRateProvider()
+	if err == nil {
+		receipt.ConvertedAmount, receipt.ExchangeRate, err = services.ConvertAmount(provider, receipt.TotalAmount, receipt.Currency, userCurrency, rateDate)
+	}
+	if err != nil {
+		log.Printf("Receipt %s left unconverted: %v", receipt.ReceiptID, err)
+		receipt.ConvertedAmount, receipt.ExchangeRate = 0, 0
+		receipt.Status = models.ReceiptStatusNeedsReview
+	}
+	return nil
 }
@@ -0,0 +1,221 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"receipt-mgmt/internal/models"
+	"receipt-mgmt/internal/services"
+	"receipt-mgmt/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// receiptCorrectionRequest is the payload for correcting a receipt; omitted fields are left unchanged
+type receiptCorrectionRequest struct {
+	Merchant        *string    `json:"merchant"`
+	MerchantID      *uuid.UUID `json:"merchant_id"`
+	TotalAmount     *float64   `json:"total_amount"`
+	Tax             *float64   `json:"tax"`
+	Discounts       *float64   `json:"discounts"`
+	TransactionDate *string    `json:"transaction_date"`
+	TransactionTime *string    `json:"transaction_time"`
+	CategoryID      *uuid.UUID `json:"category_id"`
+	ExchangeRate    *float64   `json:"exchange_rate"` // Into the user's currency, for a receipt no rate was found for
+	Notes           *string    `json:"notes"`         // Not an OCR field, so not recorded as a correction
+}
+
+// UpdateReceipt applies manual corrections to a receipt, recording the OCR and corrected value of
+// every changed field and keeping the linked expense in sync
+func UpdateReceipt(c *gin.Context) {
+	receipt, ok := loadUserReceipt(c)
+	if !ok {
+		return
+	}
+
+	var request receiptCorrectionRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid request body", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	previous := *receipt // The merchant name before this correction is learned as an alias
+	corrections := []models.ReceiptCorrection{}
+	record := func(field, before, after string) {
+		if before != after {
+			corrections = append(corrections, models.ReceiptCorrection{
+				Field:          field,
+				OCRValue:       before,
+				PreviousValue:  before,
+				CorrectedValue: after,
+			})
+		}
+	}
+
+	merchantChanged := request.Merchant != nil || request.MerchantID != nil
+	if merchantChanged {
+		name := ""
+		if request.Merchant != nil {
+			name = strings.TrimSpace(*request.Merchant)
+		}
+		if name == "" && request.MerchantID == nil {
+			utils.SendResponse(c, http.StatusBadRequest, "merchant cannot be empty", nil, nil)
+			return
+		}
+		if name == "" {
+			// Only the canonical merchant was picked, so show its name
+			merchant, ok := loadMerchant(c, request.MerchantID.String())
+			if !ok {
+				return
+			}
+			name = merchant.CanonicalName
+		}
+		record("merchant", receipt.Merchant, name)
+		receipt.Merchant = name
+	}
+
+	for _, amount := range []struct {
+		field string
+		value *float64
+		dest  *float64
+	}{
+		{"total_amount", request.TotalAmount, &receipt.TotalAmount},
+		{"tax", request.Tax, &receipt.Tax},
+		{"discounts", request.Discounts, &receipt.Discounts},
+	} {
+		if amount.value == nil {
+			continue
+		}
+		if *amount.value < 0 {
+			utils.SendResponse(c, http.StatusBadRequest, amount.field+" cannot be negative", nil, nil)
+			return
+		}
+		record(amount.field, formatAmount(*amount.dest), formatAmount(*amount.value))
+		*amount.dest = *amount.value
+	}
+
+	dateChanged := false
+	if request.TransactionDate != nil {
+		if _, err := time.Parse("2006-01-02", *request.TransactionDate); err != nil {
+			utils.SendResponse(c, http.StatusBadRequest, "transaction_date must be in YYYY-MM-DD format", nil, nil)
+			return
+		}
+		dateChanged = *request.TransactionDate != receipt.TransactionDate
+		record("transaction_date", receipt.TransactionDate, *request.TransactionDate)
+		receipt.TransactionDate = *request.TransactionDate
+	}
+	if request.TransactionTime != nil {
+		transactionTime, ok := services.ParseClockTime(*request.TransactionTime)
+		if !ok {
+			utils.SendResponse(c, http.StatusBadRequest, "transaction_time must be in HH:MM or HH:MM:SS format", nil, nil)
+			return
+		}
+		record("transaction_time", receipt.TransactionTime, transactionTime)
+		receipt.TransactionTime = transactionTime
+	}
+
+	if request.CategoryID != nil {
+		isValid, err := models.IsCategoryIDValid(request.CategoryID.String(), receipt.UserID)
+		if err != nil {
+			utils.SendResponse(c, http.StatusInternalServerError, "Failed to check category", nil, map[string]interface{}{"error": err.Error()})
+			return
+		}
+		if !isValid {
+			utils.SendResponse(c, http.StatusBadRequest, "Invalid category_id", nil, nil)
+			return
+		}
+		record("category_id", receipt.CategoryID.String(), request.CategoryID.String())
+		receipt.CategoryID = *request.CategoryID
+	}
+	categoryChanged := receipt.CategoryID != previous.CategoryID
+
+	if request.ExchangeRate != nil {
+		if *request.ExchangeRate <= 0 {
+			utils.SendResponse(c, http.StatusBadRequest, "exchange_rate must be positive", nil, nil)
+			return
+		}
+		if receipt.Currency == receipt.ConvertedCurrency {
+			utils.SendResponse(c, http.StatusBadRequest, "The receipt is already in your currency", nil, nil)
+			return
+		}
+		record("exchange_rate", strconv.FormatFloat(receipt.ExchangeRate, 'f', -1, 64), strconv.FormatFloat(*request.ExchangeRate, 'f', -1, 64))
+		receipt.ExchangeRate = *request.ExchangeRate
+	}
+
+	notesChanged := false
+	if request.Notes != nil {
+		notes := strings.TrimSpace(*request.Notes)
+		notesChanged = notes != receipt.Notes
+		receipt.Notes = notes
+	}
+
+	if len(corrections) == 0 && !merchantChanged && !notesChanged {
+		utils.SendResponse(c, http.StatusOK, "Receipt is unchanged", receipt, nil)
+		return
+	}
+
+	// The exchange rate follows the transaction day, unless it was just set by hand
+	if dateChanged && request.ExchangeRate == nil && receipt.Currency != receipt.ConvertedCurrency {
+		if err := convertReceiptAmount(receipt, receipt.Currency); err != nil {
+			utils.SendResponse(c, http.StatusInternalServerError, "Failed to convert receipt amount", nil, map[string]interface{}{"error": err.Error()})
+			return
+		}
+	}
+
+	err := models.ApplyReceiptCorrections(receipt, corrections, func(tx *gorm.DB) error {
+		if categoryChanged {
+			// Learn from the chosen category; a changed suggestion counts against the suggested one
+			if err := models.LearnCategoryChange(tx, receipt, previous.CategoryID); err != nil {
+				return err
+			}
+			receipt.CategorySuggested = false
+		}
+		if !merchantChanged {
+			return nil
+		}
+		// Learn the previous name as an alias of the corrected merchant
+		merchant, err := correctMerchant(tx, &previous, request.MerchantID, receipt.Merchant)
+		if err != nil {
+			return err
+		}
+		receipt.MerchantID = &merchant.MerchantID
+		return nil
+	})
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, models.ErrSplitOutdated) {
+			status = http.StatusConflict
+		}
+		utils.SendResponse(c, status, "Failed to update receipt", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Receipt updated successfully", receipt, nil)
+}
+
+// GetReceiptCorrections returns the manual corrections made to a receipt
+func GetReceiptCorrections(c *gin.Context) {
+	receipt, ok := loadUserReceipt(c)
+	if !ok {
+		return
+	}
+
+	corrections, err := models.GetReceiptCorrections(receipt.ReceiptID, receipt.UserID)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to fetch receipt corrections", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Receipt corrections retrieved successfully", corrections, nil)
+}
+
+// formatAmount renders an amount the way it is stored, for the correction audit
+func formatAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', 2, 64)
+}
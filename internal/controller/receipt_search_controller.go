@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"net/http"
+	"receipt-mgmt/internal/models"
+	"receipt-mgmt/utils"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// SearchReceipts finds the user's receipts by merchant, item names, notes and OCR text, best match
+// first, with the list filters applied on top
+func SearchReceipts(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return
+	}
+
+	text := strings.TrimSpace(c.Query("q"))
+	if text == "" {
+		utils.SendResponse(c, http.StatusBadRequest, "q is required", nil, nil)
+		return
+	}
+	filter, ok := bindReceiptListFilter(c)
+	if !ok {
+		return
+	}
+
+	page := utils.ParseQueryInt(c, "page", 1)
+	if page < 1 {
+		page = 1
+	}
+	limit := utils.ParseQueryInt(c, "limit", defaultReceiptPageSize)
+	if limit < 1 {
+		limit = defaultReceiptPageSize
+	} else if limit > maxReceiptPageSize {
+		limit = maxReceiptPageSize
+	}
+
+	results, total, err := models.SearchReceipts(userID.(uuid.UUID), text, filter, page, limit)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to search receipts", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.SendPaginatedResponse(c, http.StatusOK, "Receipts retrieved successfully", results,
+		utils.CalculatePagination(total, page, limit))
+}
@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"receipt-mgmt/internal/models"
+	"receipt-mgmt/utils"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// receiptSplitRequest is one part of a split: line items, a manual amount, or neither to take the remainder
+type receiptSplitRequest struct {
+	CategoryID  uuid.UUID   `json:"category_id" binding:"required"`
+	ItemIDs     []uuid.UUID `json:"item_ids"`
+	Amount      *float64    `json:"amount"`
+	Description string      `json:"description"`
+}
+
+// GetReceiptSplits returns how a receipt is split across categories
+func GetReceiptSplits(c *gin.Context) {
+	receipt, ok := loadUserReceipt(c)
+	if !ok {
+		return
+	}
+
+	splits, err := models.GetReceiptSplits(receipt.ReceiptID, receipt.UserID)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to fetch receipt splits", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Receipt splits retrieved successfully", splits, nil)
+}
+
+// SplitReceipt replaces the receipt's split with the given parts and creates one expense per part
+func SplitReceipt(c *gin.Context) {
+	receipt, ok := loadUserReceipt(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Splits []receiptSplitRequest `json:"splits" binding:"required,dive"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid request body", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	inputs := make([]models.SplitInput, 0, len(request.Splits))
+	for i, split := range request.Splits {
+		isValid, err := models.IsCategoryIDValid(split.CategoryID.String(), receipt.UserID)
+		if err != nil {
+			utils.SendResponse(c, http.StatusInternalServerError, "Failed to check category", nil, map[string]interface{}{"error": err.Error()})
+			return
+		}
+		if !isValid {
+			utils.SendResponse(c, http.StatusBadRequest, fmt.Sprintf("Invalid category_id in split %d", i+1), nil, nil)
+			return
+		}
+		inputs = append(inputs, models.SplitInput{
+			CategoryID:  split.CategoryID,
+			ItemIDs:     split.ItemIDs,
+			Amount:      split.Amount,
+			Description: strings.TrimSpace(split.Description),
+		})
+	}
+
+	items, err := models.GetItemsByReceiptID(receipt.ReceiptID, receipt.UserID)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to fetch receipt items", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	splits, err := models.BuildReceiptSplits(receipt, items, inputs)
+	if err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid split", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	if err := models.SaveReceiptSplits(receipt, splits); err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to split receipt", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Receipt split successfully", splits, nil)
+}
+
+// DeleteReceiptSplits undoes a split so the receipt is a single expense in its own category again
+func DeleteReceiptSplits(c *gin.Context) {
+	receipt, ok := loadUserReceipt(c)
+	if !ok {
+		return
+	}
+
+	if err := models.ClearReceiptSplits(receipt); err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to remove receipt split", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Receipt split removed successfully", nil, nil)
+}
@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"receipt-mgmt/internal/models"
+	"receipt-mgmt/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// GetRecurringSeries lists the user's recurring charges with their total annualized cost.
+// Dismissed series are left out unless status=dismissed is asked for.
+func GetRecurringSeries(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return
+	}
+
+	status := c.Query("status")
+	switch status {
+	case "", models.RecurringDetected, models.RecurringConfirmed, models.RecurringDismissed:
+	default:
+		utils.SendResponse(c, http.StatusBadRequest, "status must be detected, confirmed or dismissed", nil, nil)
+		return
+	}
+
+	sendRecurringSeries(c, userID.(uuid.UUID), status, "Recurring series retrieved successfully")
+}
+
+// DetectRecurringSeries analyzes the user's expenses again and returns the recurring charges found
+func DetectRecurringSeries(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return
+	}
+
+	if err := models.DetectRecurringSeries(userID.(uuid.UUID)); err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to detect recurring series", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	sendRecurringSeries(c, userID.(uuid.UUID), "", "Recurring series detected successfully")
+}
+
+func sendRecurringSeries(c *gin.Context, userID uuid.UUID, status, message string) {
+	series, err := models.GetRecurringSeries(userID, status)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to fetch recurring series", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	annualizedCost := 0.0
+	for _, s := range series {
+		if s.Status != models.RecurringDismissed {
+			annualizedCost += s.AnnualizedCost
+		}
+	}
+	utils.SendResponse(c, http.StatusOK, message, gin.H{
+		"series":          series,
+		"annualized_cost": float64(int64(annualizedCost*100+0.5)) / 100,
+	}, nil)
+}
+
+// GetRecurringSeriesByID returns a recurring series with the expenses of its occurrences
+func GetRecurringSeriesByID(c *gin.Context) {
+	series, ok := loadRecurringSeries(c)
+	if !ok {
+		return
+	}
+
+	occurrences, err := models.GetRecurringOccurrences(series)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to fetch recurring occurrences", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Recurring series retrieved successfully", gin.H{
+		"series":      series,
+		"occurrences": occurrences,
+	}, nil)
+}
+
+// ConfirmRecurringSeries marks a series as a recurring charge the user recognizes
+func ConfirmRecurringSeries(c *gin.Context) {
+	setRecurringStatus(c, models.RecurringConfirmed, "Recurring series confirmed successfully")
+}
+
+// DismissRecurringSeries marks a series as not recurring; detection won't report it again
+func DismissRecurringSeries(c *gin.Context) {
+	setRecurringStatus(c, models.RecurringDismissed, "Recurring series dismissed successfully")
+}
+
+func setRecurringStatus(c *gin.Context, status, message string) {
+	series, ok := loadRecurringSeries(c)
+	if !ok {
+		return
+	}
+
+	if err := models.SetRecurringStatus(series, status); err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to update recurring series", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, message, series, nil)
+}
+
+// loadRecurringSeries fetches the user's recurring series in the URL, sending the error response
+// itself when it can't
+func loadRecurringSeries(c *gin.Context) (*models.RecurringSeries, bool) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return nil, false
+	}
+
+	seriesID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid recurring series ID", nil, nil)
+		return nil, false
+	}
+
+	series, err := models.GetRecurringSeriesByID(seriesID, userID.(uuid.UUID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.SendResponse(c, http.StatusNotFound, "Recurring series not found", nil, nil)
+		} else {
+			utils.SendResponse(c, http.StatusInternalServerError, "Failed to fetch recurring series", nil, map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		return nil, false
+	}
+	return series, true
+}
@@ -0,0 +1,330 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"receipt-mgmt/internal/models"
+	"receipt-mgmt/utils"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ruleRequest is the payload for creating or updating a rule; omitted fields are left unchanged on update
+type ruleRequest struct {
+	Name           *string                `json:"name"`
+	Priority       *int                   `json:"priority"`
+	Enabled        *bool                  `json:"enabled"`
+	MatchAll       *bool                  `json:"match_all"`
+	StopProcessing *bool                  `json:"stop_processing"`
+	Conditions     *models.RuleConditions `json:"conditions"`
+	Actions        *models.RuleActions    `json:"actions"`
+}
+
+// ruleHistoryRequest selects the rules and past receipts for a dry run or a retroactive apply.
+// Without rule or rule_ids, all of the user's enabled rules are used.
+type ruleHistoryRequest struct {
+	Rule    *ruleRequest `json:"rule"` // Unsaved rule to try out, dry runs only
+	RuleIDs []uuid.UUID  `json:"rule_ids"`
+	From    string       `json:"from"` // Inclusive YYYY-MM-DD transaction dates
+	To      string       `json:"to"`
+}
+
+// applyTo validates the request and copies it onto the rule, sending the error response itself when invalid
+func (r ruleRequest) applyTo(c *gin.Context, rule *models.Rule) bool {
+	if r.Name != nil {
+		rule.Name = strings.TrimSpace(*r.Name)
+	}
+	if r.Priority != nil {
+		rule.Priority = *r.Priority
+	}
+	if r.Enabled != nil {
+		rule.Enabled = *r.Enabled
+	}
+	if r.MatchAll != nil {
+		rule.MatchAll = *r.MatchAll
+	}
+	if r.StopProcessing != nil {
+		rule.StopProcessing = *r.StopProcessing
+	}
+	if r.Conditions != nil {
+		rule.Conditions = *r.Conditions
+	}
+	if r.Actions != nil {
+		rule.Actions = *r.Actions
+	}
+
+	if err := rule.Validate(); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid rule", nil, map[string]interface{}{"error": err.Error()})
+		return false
+	}
+	if rule.Actions.CategoryID != nil {
+		isValid, err := models.IsCategoryIDValid(rule.Actions.CategoryID.String(), rule.UserID)
+		if err != nil {
+			utils.SendResponse(c, http.StatusInternalServerError, "Failed to check category", nil, map[string]interface{}{"error": err.Error()})
+			return false
+		}
+		if !isValid {
+			utils.SendResponse(c, http.StatusBadRequest, "Invalid category_id in actions", nil, nil)
+			return false
+		}
+	}
+	return true
+}
+
+// GetRules lists the user's rules in the order they run
+func GetRules(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return
+	}
+
+	rules, err := models.GetUserRules(userID.(uuid.UUID), false)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to fetch rules", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Rules retrieved successfully", rules, nil)
+}
+
+// GetRuleByID returns one of the user's rules
+func GetRuleByID(c *gin.Context) {
+	rule, ok := loadRule(c)
+	if !ok {
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Rule retrieved successfully", rule, nil)
+}
+
+// CreateRule adds a rule that runs on the user's new receipts
+func CreateRule(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return
+	}
+
+	var request ruleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid request body", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	rule := newRule(userID.(uuid.UUID))
+	if !request.applyTo(c, &rule) {
+		return
+	}
+
+	if err := models.SaveRule(&rule); err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to create rule", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusCreated, "Rule created successfully", rule, nil)
+}
+
+// UpdateRule edits one of the user's rules
+func UpdateRule(c *gin.Context) {
+	rule, ok := loadRule(c)
+	if !ok {
+		return
+	}
+
+	var request ruleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid request body", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if !request.applyTo(c, rule) {
+		return
+	}
+
+	if err := models.SaveRule(rule); err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to update rule", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Rule updated successfully", rule, nil)
+}
+
+// DeleteRule removes one of the user's rules; receipts it already changed are left as they are
+func DeleteRule(c *gin.Context) {
+	rule, ok := loadRule(c)
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteRule(rule); err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to delete rule", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Rule deleted successfully", nil, nil)
+}
+
+// DryRunRules shows which past receipts the rules match and what they would change, without saving anything
+func DryRunRules(c *gin.Context) {
+	rules, filter, ok := loadHistoryRules(c, true)
+	if !ok {
+		return
+	}
+
+	userID, _ := c.Get("userId")
+	outcomes, err := models.PreviewRules(userID.(uuid.UUID), rules, filter)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to run rules", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Rules evaluated successfully", outcomes, nil)
+}
+
+// ApplyRules runs the rules on past receipts and saves the changes
+func ApplyRules(c *gin.Context) {
+	rules, filter, ok := loadHistoryRules(c, false)
+	if !ok {
+		return
+	}
+
+	userID, _ := c.Get("userId")
+	changed, err := models.ApplyRulesToHistory(userID.(uuid.UUID), rules, filter)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to apply rules", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Rules applied successfully", gin.H{
+		"updated":  len(changed),
+		"receipts": changed,
+	}, nil)
+}
+
+// newRule returns a rule with the defaults of a new rule
+func newRule(userID uuid.UUID) models.Rule {
+	return models.Rule{
+		RuleID:   uuid.New(),
+		UserID:   userID,
+		Priority: 100,
+		Enabled:  true,
+		MatchAll: true,
+	}
+}
+
+// loadHistoryRules reads a ruleHistoryRequest and returns the rules to run, sending the error response
+// itself when the request is invalid. Unsaved rules are only accepted for dry runs.
+func loadHistoryRules(c *gin.Context, allowUnsaved bool) ([]models.Rule, models.RuleHistoryFilter, bool) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return nil, models.RuleHistoryFilter{}, false
+	}
+
+	var request ruleHistoryRequest
+	// An empty body runs every enabled rule on the whole history
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			utils.SendResponse(c, http.StatusBadRequest, "Invalid request body", nil, map[string]interface{}{"error": err.Error()})
+			return nil, models.RuleHistoryFilter{}, false
+		}
+	}
+
+	filter := models.RuleHistoryFilter{From: request.From, To: request.To}
+	for _, date := range []string{filter.From, filter.To} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			utils.SendResponse(c, http.StatusBadRequest, "from and to must be in YYYY-MM-DD format", nil, nil)
+			return nil, filter, false
+		}
+	}
+
+	if request.Rule != nil {
+		if !allowUnsaved {
+			utils.SendResponse(c, http.StatusBadRequest, "Only saved rules can be applied, create the rule first", nil, nil)
+			return nil, filter, false
+		}
+		rule := newRule(userID.(uuid.UUID))
+		if !request.Rule.applyTo(c, &rule) {
+			return nil, filter, false
+		}
+		return []models.Rule{rule}, filter, true
+	}
+
+	rules, err := models.GetUserRules(userID.(uuid.UUID), len(request.RuleIDs) == 0)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to fetch rules", nil, map[string]interface{}{"error": err.Error()})
+		return nil, filter, false
+	}
+	if len(request.RuleIDs) > 0 {
+		// Keep the requested rules, in the order they normally run, even when disabled
+		selected := []models.Rule{}
+		for _, rule := range rules {
+			for _, ruleID := range request.RuleIDs {
+				if rule.RuleID == ruleID {
+					rule.Enabled = true
+					selected = append(selected, rule)
+					break
+				}
+			}
+		}
+		if len(selected) != len(request.RuleIDs) {
+			utils.SendResponse(c, http.StatusNotFound, "Rule not found", nil, nil)
+			return nil, filter, false
+		}
+		rules = selected
+	}
+	return rules, filter, true
+}
+
+// loadRule fetches the user's rule in the URL, sending the error response itself when it can't
+func loadRule(c *gin.Context) (*models.Rule, bool) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return nil, false
+	}
+
+	ruleID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid rule ID", nil, nil)
+		return nil, false
+	}
+
+	rule, err := models.GetRuleByID(ruleID, userID.(uuid.UUID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.SendResponse(c, http.StatusNotFound, "Rule not found", nil, nil)
+		} else {
+			utils.SendResponse(c, http.StatusInternalServerError, "Failed to fetch rule", nil, map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		return nil, false
+	}
+	return rule, true
+}
+
+// applyReceiptRules runs the user's enabled rules on a new receipt. A category chosen at upload
+// is kept; rules only replace a suggested one.
+func applyReceiptRules(receipt *models.Receipt) error {
+	rules, err := models.GetApplicableRules(receipt.UserID)
+	if err != nil {
+		return err
+	}
+
+	outcome := models.EvaluateRules(rules, receipt)
+	if !receipt.CategorySuggested {
+		outcome.CategoryID = nil
+	}
+	outcome.ApplyTo(receipt)
+	return nil
+}
@@ -0,0 +1,369 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"receipt-mgmt/internal/models"
+	"receipt-mgmt/internal/services"
+	"receipt-mgmt/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ImportStatement reads a CSV, OFX or QFX statement file, saves its new transactions and reconciles
+// them with the user's receipts. A CSV file needs a "mapping" form field naming its columns.
+func ImportStatement(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return
+	}
+
+	if err := c.Request.ParseMultipartForm(10 << 20); err != nil { // 10 MB max
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid file upload", nil, nil)
+		return
+	}
+	file, header, err := c.Request.FormFile("statement")
+	if err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "No file uploaded", nil, nil)
+		return
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Failed to read the statement file", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	format := strings.ToLower(strings.TrimSpace(c.PostForm("format")))
+	if format == "" {
+		format = services.DetectStatementFormat(header.Filename, content)
+	}
+	if format == "qfx" {
+		format = services.StatementFormatOFX
+	}
+
+	var mapping services.CSVColumnMapping
+	if value := c.PostForm("mapping"); value != "" {
+		if err := json.Unmarshal([]byte(value), &mapping); err != nil {
+			utils.SendResponse(c, http.StatusBadRequest, "Invalid mapping", nil, map[string]interface{}{"error": err.Error()})
+			return
+		}
+	}
+	if locale := c.PostForm("locale"); locale != "" {
+		if services.NormalizeLocale(locale) == "" {
+			utils.SendResponse(c, http.StatusBadRequest, "Unsupported locale, expected en-CA or fr-CA", nil, nil)
+			return
+		}
+		mapping.Locale = locale
+	}
+
+	statement := &models.StatementImport{UserID: userID.(uuid.UUID), FileName: header.Filename, Format: format}
+	if value := c.PostForm("payment_account_id"); value != "" {
+		accountID, err := uuid.Parse(value)
+		if err != nil {
+			utils.SendResponse(c, http.StatusBadRequest, "Invalid payment_account_id", nil, nil)
+			return
+		}
+		statement.PaymentAccountID = &accountID
+	}
+
+	parsed, err := services.ParseStatement(content, format, mapping)
+	if err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Failed to read the statement", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	transactions := make([]models.StatementTransaction, 0, len(parsed))
+	for _, transaction := range parsed {
+		transactions = append(transactions, models.StatementTransaction{
+			PostedDate:   transaction.PostedDate,
+			Amount:       transaction.Amount,
+			Description:  transaction.Description,
+			Reference:    transaction.Reference,
+			CardLastFour: transaction.CardLastFour,
+		})
+	}
+
+	if err := models.ImportStatement(statement, transactions); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusBadRequest
+		}
+		utils.SendResponse(c, status, "Failed to import the statement", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	// The new transactions may also settle receipts left open by earlier statements
+	if statement.PeriodStart != nil {
+		period := models.StatementFilter{
+			From: statement.PeriodStart.Format("2006-01-02"),
+			To:   statement.PeriodEnd.Format("2006-01-02"),
+		}
+		if err := models.ReconcileStatements(statement.UserID, period); err != nil {
+			utils.SendResponse(c, http.StatusInternalServerError, "Statement imported but reconciliation failed", statement, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+	}
+	report, err := models.GetReconciliationReport(statement.UserID, models.StatementFilter{ImportID: &statement.ImportID})
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Statement imported but the report failed", statement, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusCreated, "Statement imported successfully", gin.H{
+		"import":         statement,
+		"reconciliation": report,
+	}, nil)
+}
+
+// GetStatementImports lists the user's imported statements
+func GetStatementImports(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return
+	}
+
+	imports, err := models.GetStatementImports(userID.(uuid.UUID))
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to fetch statement imports", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Statement imports retrieved successfully", imports, nil)
+}
+
+// DeleteStatementImport deletes an imported statement and its transactions
+func DeleteStatementImport(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return
+	}
+
+	importID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid statement import ID", nil, nil)
+		return
+	}
+
+	if err := models.DeleteStatementImport(importID, userID.(uuid.UUID)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.SendResponse(c, http.StatusNotFound, "Statement import not found", nil, nil)
+		} else {
+			utils.SendResponse(c, http.StatusInternalServerError, "Failed to delete statement import", nil, map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Statement import deleted successfully", nil, nil)
+}
+
+// GetStatementTransactions lists the user's statement transactions, filtered by import_id,
+// payment_account_id, status, from and to
+func GetStatementTransactions(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return
+	}
+
+	filter, ok := bindStatementFilter(c)
+	if !ok {
+		return
+	}
+
+	transactions, err := models.GetStatementTransactions(userID.(uuid.UUID), filter)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to fetch statement transactions", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Statement transactions retrieved successfully", transactions, nil)
+}
+
+// ReconcileStatements matches the user's statement transactions to receipts again and returns the report
+func ReconcileStatements(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return
+	}
+
+	filter, ok := bindStatementFilter(c)
+	if !ok {
+		return
+	}
+
+	if err := models.ReconcileStatements(userID.(uuid.UUID), filter); err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to reconcile statements", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	sendReconciliationReport(c, userID.(uuid.UUID), filter)
+}
+
+// GetReconciliationReport returns the matched, unmatched and ambiguous transactions and the card
+// receipts missing from the statements
+func GetReconciliationReport(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return
+	}
+
+	filter, ok := bindStatementFilter(c)
+	if !ok {
+		return
+	}
+	sendReconciliationReport(c, userID.(uuid.UUID), filter)
+}
+
+func sendReconciliationReport(c *gin.Context, userID uuid.UUID, filter models.StatementFilter) {
+	report, err := models.GetReconciliationReport(userID, filter)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to build the reconciliation report", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	utils.SendResponse(c, http.StatusOK, "Reconciliation report retrieved successfully", report, nil)
+}
+
+// MatchStatementTransaction pairs a transaction with the receipt the user picked
+func MatchStatementTransaction(c *gin.Context) {
+	transaction, ok := loadStatementTransaction(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		ReceiptID uuid.UUID `json:"receipt_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid request body", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	if err := models.MatchStatementTransaction(transaction, request.ReceiptID); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		} else if errors.Is(err, models.ErrReceiptAlreadyMatched) {
+			status = http.StatusConflict
+		}
+		utils.SendResponse(c, status, "Failed to match statement transaction", nil, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Statement transaction matched successfully", transaction, nil)
+}
+
+// UnmatchStatementTransaction removes a transaction's match; with ignore=true the transaction is
+// marked as needing no receipt
+func UnmatchStatementTransaction(c *gin.Context) {
+	transaction, ok := loadStatementTransaction(c)
+	if !ok {
+		return
+	}
+
+	ignore := false
+	if value := c.Query("ignore"); value != "" {
+		var err error
+		if ignore, err = strconv.ParseBool(value); err != nil {
+			utils.SendResponse(c, http.StatusBadRequest, "Invalid ignore value", nil, nil)
+			return
+		}
+	}
+
+	if err := models.UnmatchStatementTransaction(transaction, ignore); err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to unmatch statement transaction", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Statement transaction unmatched successfully", transaction, nil)
+}
+
+// bindStatementFilter reads the statement filter from the query, sending the error response itself when invalid
+func bindStatementFilter(c *gin.Context) (models.StatementFilter, bool) {
+	filter := models.StatementFilter{
+		Status: c.Query("status"),
+		From:   c.Query("from"),
+		To:     c.Query("to"),
+	}
+	switch filter.Status {
+	case "", models.StatementMatched, models.StatementUnmatched, models.StatementAmbiguous, models.StatementIgnored:
+	default:
+		utils.SendResponse(c, http.StatusBadRequest, "status must be matched, unmatched, ambiguous or ignored", nil, nil)
+		return filter, false
+	}
+	for _, date := range []string{filter.From, filter.To} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			utils.SendResponse(c, http.StatusBadRequest, "from and to must be in YYYY-MM-DD format", nil, nil)
+			return filter, false
+		}
+	}
+	for param, dest := range map[string]**uuid.UUID{"import_id": &filter.ImportID, "payment_account_id": &filter.PaymentAccountID} {
+		if value := c.Query(param); value != "" {
+			parsedID, err := uuid.Parse(value)
+			if err != nil {
+				utils.SendResponse(c, http.StatusBadRequest, "Invalid "+param, nil, nil)
+				return filter, false
+			}
+			*dest = &parsedID
+		}
+	}
+	return filter, true
+}
+
+// loadStatementTransaction fetches the user's statement transaction in the URL, sending the error
+// response itself when it can't
+func loadStatementTransaction(c *gin.Context) (*models.StatementTransaction, bool) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return nil, false
+	}
+
+	transactionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid statement transaction ID", nil, nil)
+		return nil, false
+	}
+
+	transaction, err := models.GetStatementTransactionByID(transactionID, userID.(uuid.UUID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.SendResponse(c, http.StatusNotFound, "Statement transaction not found", nil, nil)
+		} else {
+			utils.SendResponse(c, http.StatusInternalServerError, "Failed to fetch statement transaction", nil, map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		return nil, false
+	}
+	return transaction, true
+}
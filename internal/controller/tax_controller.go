@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"net/http"
+	"receipt-mgmt/internal/models"
+	"receipt-mgmt/internal/services"
+	"receipt-mgmt/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// GetTaxSummary reports the sales tax paid per period, including the GST/HST
+// that self-employed users can claim as input tax credits
+func GetTaxSummary(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		utils.SendResponse(c, http.StatusUnauthorized, "Unauthorized", nil, nil)
+		return
+	}
+
+	period := c.DefaultQuery("period", "month")
+	if !models.TaxSummaryPeriods[period] {
+		utils.SendResponse(c, http.StatusBadRequest, "period must be one of month, quarter or year", nil, nil)
+		return
+	}
+
+	summary, err := models.GetTaxSummary(userID.(uuid.UUID), c.Query("from"), c.Query("to"), period)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Failed to compute tax summary", nil, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Tax summary retrieved successfully", summary, nil)
+}
+
+// buildReceiptTaxes converts the parsed tax components into tax rows for the given receipt
+func buildReceiptTaxes(receiptID, userID uuid.UUID, components []services.TaxComponent) []models.ReceiptTax {
+	taxes := make([]models.ReceiptTax, 0, len(components))
+	for _, component := range components {
+		taxes = append(taxes, models.ReceiptTax{
+			TaxID:     uuid.New(),
+			ReceiptID: receiptID,
+			UserID:    userID,
+			Type:      component.Type,
+			Rate:      component.Rate,
+			Amount:    component.Amount,
+		})
+	}
+	return taxes
+}
@@ -0,0 +1,601 @@
+package models
+
+import (
+	"fmt"
+	"receipt-mgmt/db"
+	"receipt-mgmt/internal/services"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+)
+
+// AnalyticsRange is the period and currency an analysis covers. Receipts paid in the currency or
+// converted to it at upload count as they are; others are converted with the exchange rate of their
+// transaction date, and left out when there is none.
+type AnalyticsRange struct {
+	From     time.Time // Inclusive transaction dates
+	To       time.Time
+	Currency string
+}
+
+// Previous returns the range of the same length right before this one
+func (r AnalyticsRange) Previous() AnalyticsRange {
+	days := int(r.To.Sub(r.From).Hours()/24+0.5) + 1
+	return AnalyticsRange{From: r.From.AddDate(0, 0, -days), To: r.From.AddDate(0, 0, -1), Currency: r.Currency}
+}
+
+// AnalyticsReceipt is the part of a receipt the analytics are computed from, with its splits
+type AnalyticsReceipt struct {
+	ReceiptID         uuid.UUID
+	CategoryID        uuid.UUID
+	CategoryName      *string
+	Type              string
+	Currency          string
+	ConvertedCurrency string
+	ExchangeRate      float64
+	TotalAmount       float64
+	Tax               float64
+	Discounts         float64
+	TransactionDate   string
+	TransactionTime   string
+	Splits            []AnalyticsSplit `gorm:"-"`
+	rateCurrency      string           // Currency rate takes the amounts to, set when loaded for a range
+	rate              float64          // Zero when there is no exchange rate
+}
+
+// AnalyticsSplit is the part of a split receipt filed under one category, in the receipt's currency
+type AnalyticsSplit struct {
+	ReceiptID    uuid.UUID
+	CategoryID   uuid.UUID
+	CategoryName *string
+	Amount       float64
+}
+
+// AnalyticsTotals summarizes the spending of a period. Refunds are deducted from Net.
+type AnalyticsTotals struct {
+	From             string  `json:"from"`
+	To               string  `json:"to"`
+	Currency         string  `json:"currency"`
+	ReceiptCount     int     `json:"receipt_count"` // Purchases
+	RefundCount      int     `json:"refund_count"`
+	Spent            float64 `json:"spent"`
+	Refunded         float64 `json:"refunded"`
+	Net              float64 `json:"net"`
+	Tax              float64 `json:"tax"`
+	Discounts        float64 `json:"discounts"`
+	AverageBasket    float64 `json:"average_basket"`    // Spent per purchase
+	ExcludedReceipts int     `json:"excluded_receipts"` // No exchange rate to the currency
+}
+
+// CategorySpending is the net spending of a category; split receipts count under each split's category
+type CategorySpending struct {
+	CategoryID   uuid.UUID `json:"category_id"`
+	Name         string    `json:"name"`
+	Amount       float64   `json:"amount"`
+	ReceiptCount int       `json:"receipt_count"` // Purchases
+	Share        float64   `json:"share"`         // Percent of the period's net spending
+}
+
+// MerchantSpending is the net spending at a merchant, grouped by canonical merchant when known
+type MerchantSpending struct {
+	MerchantID    *uuid.UUID `json:"merchant_id"`
+	Name          string     `json:"name"`
+	Amount        float64    `json:"amount"`
+	ReceiptCount  int        `json:"receipt_count"` // Purchases
+	AverageBasket float64    `json:"average_basket"`
+}
+
+// MonthlySpending is the spending of one calendar month of the period
+type MonthlySpending struct {
+	Month        string  `json:"month"` // YYYY-MM
+	Amount       float64 `json:"amount"`
+	ReceiptCount int     `json:"receipt_count"`
+	Tax          float64 `json:"tax"`
+	Discounts    float64 `json:"discounts"`
+}
+
+// SpendingBucket is the spending on one day of the week or at one hour of the day
+type SpendingBucket struct {
+	Day           string  `json:"day,omitempty"`
+	Hour          *int    `json:"hour,omitempty"`
+	Amount        float64 `json:"amount"`
+	ReceiptCount  int     `json:"receipt_count"`
+	AverageBasket float64 `json:"average_basket"`
+}
+
+// SpendingPatterns shows when the user shops. Receipts without a transaction time are left out of
+// the hours.
+type SpendingPatterns struct {
+	DayOfWeek       []SpendingBucket `json:"day_of_week"` // Monday first
+	HourOfDay       []SpendingBucket `json:"hour_of_day"`
+	UntimedReceipts int              `json:"untimed_receipts"`
+}
+
+// SpendingComparison compares a period with an earlier one. The percent changes are nil when the
+// previous amount is zero.
+type SpendingComparison struct {
+	Current       AnalyticsTotals  `json:"current"`
+	Previous      AnalyticsTotals  `json:"previous"`
+	Change        float64          `json:"change"`
+	ChangePercent *float64         `json:"change_percent"`
+	Categories    []CategoryChange `json:"categories"`
+}
+
+// CategoryChange is the change in a category's spending between the two periods
+type CategoryChange struct {
+	CategoryID    uuid.UUID `json:"category_id"`
+	Name          string    `json:"name"`
+	Current       float64   `json:"current"`
+	Previous      float64   `json:"previous"`
+	Change        float64   `json:"change"`
+	ChangePercent *float64  `json:"change_percent"`
+}
+
+// GetAnalyticsReceipts loads the user's receipts dated within the range, with their splits and the
+// factor taking their amounts to the range's currency
+func GetAnalyticsReceipts(userID uuid.UUID, r AnalyticsRange) ([]AnalyticsReceipt, error) {
+	DB := db.GetDBInstance()
+
+	var receipts []AnalyticsReceipt
+	if err := DB.Table("receipts").
+		Select("receipts.receipt_id, receipts.category_id, categories.name AS category_name, "+
+			"receipts.type, receipts.currency, receipts.converted_currency, "+
+			"receipts.exchange_rate, receipts.total_amount, receipts.tax, receipts.discounts, "+
+			"receipts.transaction_date, receipts.transaction_time").
+		Joins("LEFT JOIN categories ON categories.id = receipts.category_id").
+		Where("receipts.user_id = ? AND receipts.deleted_at IS NULL", userID).
+		Where("receipts.transaction_date >= ? AND receipts.transaction_date <= ?", r.From.Format("2006-01-02"), r.To.Format("2006-01-02")).
+		Order("receipts.transaction_date ASC").
+		Scan(&receipts).Error; err != nil {
+		return nil, fmt.Errorf("error loading receipts: %w", err)
+	}
+	if len(receipts) == 0 {
+		return receipts, nil
+	}
+
+	// Receipts saved before currencies were detected are in the user's currency
+	userCurrency, err := GetUserCurrency(userID)
+	if err != nil {
+		return nil, fmt.Errorf("error loading user currency: %w", err)
+	}
+	converter := newCurrencyConverter(r.Currency)
+	for i := range receipts {
+		receipt := &receipts[i]
+		if receipt.Currency == "" {
+			receipt.Currency = userCurrency
+		}
+		receipt.rateCurrency = r.Currency
+		receipt.rate, _ = converter.rate(receipt.Currency, receipt.ConvertedCurrency, receipt.ExchangeRate, receipt.TransactionDate)
+	}
+
+	ids := make([]uuid.UUID, len(receipts))
+	byID := make(map[uuid.UUID]int, len(receipts))
+	for i, receipt := range receipts {
+		ids[i] = receipt.ReceiptID
+		byID[receipt.ReceiptID] = i
+	}
+	var splits []AnalyticsSplit
+	if err := DB.Table("receipt_splits").
+		Select("receipt_splits.receipt_id, receipt_splits.category_id, categories.name AS category_name, receipt_splits.amount").
+		Joins("LEFT JOIN categories ON categories.id = receipt_splits.category_id").
+		Where("receipt_splits.receipt_id IN ?", ids).
+		Scan(&splits).Error; err != nil {
+		return nil, fmt.Errorf("error loading receipt splits: %w", err)
+	}
+	for _, split := range splits {
+		i := byID[split.ReceiptID]
+		receipts[i].Splits = append(receipts[i].Splits, split)
+	}
+	return receipts, nil
+}
+
+// rateTo returns the factor taking the receipt's amounts to the currency, false when there is no rate
+func (a *AnalyticsReceipt) rateTo(currency string) (float64, bool) {
+	if a.rateCurrency == currency {
+		return a.rate, a.rate > 0
+	}
+	return currencyRate(a.Currency, a.ConvertedCurrency, a.ExchangeRate, currency)
+}
+
+// currencyRate returns the factor taking a receipt's amounts to the currency: 1 when it was paid in
+// the currency, its exchange rate when it was converted to it, false otherwise
+func currencyRate(paid, converted string, exchangeRate float64, currency string) (float64, bool) {
+	if paid == currency {
+		return 1, true
+	}
+	if converted == currency && exchangeRate > 0 {
+		return exchangeRate, true
+	}
+	return 0, false
+}
+
+// currencyConverter finds the factor taking receipt amounts to one currency. Receipts paid in the
+// currency or converted to it at upload use that, as currencyRate does; others are converted with
+// the exchange rate of their transaction date, like uploads. Rates are looked up once per currency and day.
+type currencyConverter struct {
+	currency string
+	provider services.RateProvider // Nil when no exchange rates are available
+	rates    map[string]float64    // By currency and date, zero when there is no rate
+}
+
+// newCurrencyConverter returns a converter to the currency using the configured rate provider
+func newCurrencyConverter(currency string) *currencyConverter {
+	converter := &currencyConverter{currency: currency, rates: map[string]float64{}}
+	if provider, err := services.GetRateProvider(); err == nil {
+		converter.provider = provider
+	}
+	return converter
+}
+
+// rate returns the factor taking a receipt's amounts to the currency, false when there is no rate
+func (c *currencyConverter) rate(paid, converted string, exchangeRate float64, date string) (float64, bool) {
+	if rate, ok := currencyRate(paid, converted, exchangeRate, c.currency); ok {
+		return rate, true
+	}
+	if c.provider == nil {
+		return 0, false
+	}
+
+	key := paid + "|" + date
+	rate, seen := c.rates[key]
+	if !seen {
+		if on, err := time.Parse("2006-01-02", date); err == nil {
+			rate, _ = services.CrossRate(c.provider, strings.ToUpper(paid), strings.ToUpper(c.currency), on, viper.GetString("fx.base_currency"))
+		}
+		c.rates[key] = rate
+	}
+	return rate, rate > 0
+}
+
+// signedTotal returns the receipt total in the currency, negative for a refund
+func (a *AnalyticsReceipt) signedTotal(rate float64) float64 {
+	if a.Type == ReceiptTypeRefund {
+		return -a.TotalAmount * rate
+	}
+	return a.TotalAmount * rate
+}
+
+// categoryAmounts spreads the receipt's signed total over its categories: the splits' when it is split
+func (a *AnalyticsReceipt) categoryAmounts(rate float64) []CategorySpending {
+	if len(a.Splits) == 0 {
+		return []CategorySpending{{CategoryID: a.CategoryID, Name: stringValue(a.CategoryName), Amount: a.signedTotal(rate)}}
+	}
+	sign := 1.0
+	if a.Type == ReceiptTypeRefund {
+		sign = -1
+	}
+	amounts := make([]CategorySpending, 0, len(a.Splits))
+	for _, split := range a.Splits {
+		amounts = append(amounts, CategorySpending{CategoryID: split.CategoryID, Name: stringValue(split.CategoryName), Amount: sign * split.Amount * rate})
+	}
+	return amounts
+}
+
+// SummarizeSpending totals the receipts known in the range's currency
+func SummarizeSpending(receipts []AnalyticsReceipt, r AnalyticsRange) AnalyticsTotals {
+	totals := AnalyticsTotals{From: r.From.Format("2006-01-02"), To: r.To.Format("2006-01-02"), Currency: r.Currency}
+	for i := range receipts {
+		receipt := &receipts[i]
+		rate, ok := receipt.rateTo(r.Currency)
+		if !ok {
+			totals.ExcludedReceipts++
+			continue
+		}
+		if receipt.Type == ReceiptTypeRefund {
+			totals.RefundCount++
+			totals.Refunded += receipt.TotalAmount * rate
+			continue
+		}
+		totals.ReceiptCount++
+		totals.Spent += receipt.TotalAmount * rate
+		totals.Tax += receipt.Tax * rate
+		totals.Discounts += receipt.Discounts * rate
+	}
+
+	totals.Spent = roundCents(totals.Spent)
+	totals.Refunded = roundCents(totals.Refunded)
+	totals.Net = roundCents(totals.Spent - totals.Refunded)
+	totals.Tax = roundCents(totals.Tax)
+	totals.Discounts = roundCents(totals.Discounts)
+	if totals.ReceiptCount > 0 {
+		totals.AverageBasket = roundCents(totals.Spent / float64(totals.ReceiptCount))
+	}
+	return totals
+}
+
+// SpendingByCategory returns the net spending per category, largest first
+func SpendingByCategory(receipts []AnalyticsReceipt, r AnalyticsRange) []CategorySpending {
+	byCategory := map[uuid.UUID]*CategorySpending{}
+	net := 0.0
+	for i := range receipts {
+		receipt := &receipts[i]
+		rate, ok := receipt.rateTo(r.Currency)
+		if !ok {
+			continue
+		}
+		for _, part := range receipt.categoryAmounts(rate) {
+			category := byCategory[part.CategoryID]
+			if category == nil {
+				category = &CategorySpending{CategoryID: part.CategoryID, Name: part.Name}
+				byCategory[part.CategoryID] = category
+			}
+			category.Amount += part.Amount
+			if receipt.Type != ReceiptTypeRefund {
+				category.ReceiptCount++
+			}
+			net += part.Amount
+		}
+	}
+
+	categories := make([]CategorySpending, 0, len(byCategory))
+	for _, category := range byCategory {
+		if net > 0 {
+			category.Share = roundCents(category.Amount / net * 100)
+		}
+		category.Amount = roundCents(category.Amount)
+		categories = append(categories, *category)
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		if categories[i].Amount != categories[j].Amount {
+			return categories[i].Amount > categories[j].Amount
+		}
+		return categories[i].Name < categories[j].Name
+	})
+	return categories
+}
+
+// SpendingByMerchant returns the user's net spending per merchant in the range, largest first,
+// keeping the top limit merchants when limit is positive. The receipts are totalled in the database
+// per printed name and canonical merchant, then the printed names are grouped like everywhere else.
+// Receipts neither paid in the currency nor converted to it are totalled per currency and day too,
+// and converted with the exchange rate of that day.
+func SpendingByMerchant(userID uuid.UUID, r AnalyticsRange, limit int) ([]MerchantSpending, error) {
+	DB := db.GetDBInstance()
+
+	// Receipts saved before currencies were detected are in the user's currency
+	userCurrency, err := GetUserCurrency(userID)
+	if err != nil {
+		return nil, fmt.Errorf("error loading user currency: %w", err)
+	}
+
+	// The factor taking each receipt's amounts to the currency, as currencyRate does; NULL when
+	// they have to be converted with the exchange rates
+	rated := DB.Table("receipts").
+		Select("receipts.merchant_id, receipts.merchant, receipts.type, receipts.total_amount, receipts.transaction_date, "+
+			"COALESCE(NULLIF(receipts.currency, ''), ?) AS currency, "+
+			"CASE WHEN COALESCE(NULLIF(receipts.currency, ''), ?) = ? THEN 1 "+
+			"WHEN receipts.converted_currency = ? AND receipts.exchange_rate > 0 THEN receipts.exchange_rate END AS rate",
+			userCurrency, userCurrency, r.Currency, r.Currency).
+		Where("receipts.user_id = ? AND receipts.deleted_at IS NULL", userID).
+		Where("receipts.transaction_date >= ? AND receipts.transaction_date <= ?", r.From.Format("2006-01-02"), r.To.Format("2006-01-02"))
+
+	var rows []struct {
+		MerchantID    *uuid.UUID
+		Merchant      string
+		CanonicalName *string
+		Currency      *string // Set with Date when the totals still have to be converted
+		Date          *string
+		Amount        float64 // Net of refunds
+		Spent         float64
+		ReceiptCount  int // Purchases
+	}
+	if err := DB.Table("(?) AS rated", rated).
+		Select("rated.merchant_id, rated.merchant, merchants.canonical_name, "+
+			"CASE WHEN rated.rate IS NULL THEN rated.currency END AS currency, "+
+			"CASE WHEN rated.rate IS NULL THEN rated.transaction_date END AS date, "+
+			"SUM(CASE WHEN rated.type = ? THEN -rated.total_amount ELSE rated.total_amount END * COALESCE(rated.rate, 1)) AS amount, "+
+			"COALESCE(SUM(rated.total_amount * COALESCE(rated.rate, 1)) FILTER (WHERE rated.type <> ?), 0) AS spent, "+
+			"COUNT(*) FILTER (WHERE rated.type <> ?) AS receipt_count",
+			ReceiptTypeRefund, ReceiptTypeRefund, ReceiptTypeRefund).
+		Joins("LEFT JOIN merchants ON merchants.merchant_id = rated.merchant_id").
+		Group("rated.merchant_id, rated.merchant, merchants.canonical_name, " +
+			"CASE WHEN rated.rate IS NULL THEN rated.currency END, CASE WHEN rated.rate IS NULL THEN rated.transaction_date END").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("error totalling merchant spending: %w", err)
+	}
+
+	type merchantTotal struct {
+		MerchantSpending
+		spent float64
+	}
+	byMerchant := map[string]*merchantTotal{}
+	converter := newCurrencyConverter(r.Currency)
+	for _, row := range rows {
+		rate := 1.0
+		if row.Currency != nil {
+			var ok bool
+			if rate, ok = converter.rate(*row.Currency, "", 0, stringValue(row.Date)); !ok {
+				continue
+			}
+		}
+		key, name, _ := merchantGroup(row.MerchantID, row.CanonicalName, row.Merchant)
+		merchant := byMerchant[key]
+		if merchant == nil {
+			merchant = &merchantTotal{MerchantSpending: MerchantSpending{MerchantID: row.MerchantID, Name: name}}
+			byMerchant[key] = merchant
+		}
+		merchant.Amount += row.Amount * rate
+		merchant.ReceiptCount += row.ReceiptCount
+		merchant.spent += row.Spent * rate
+	}
+
+	merchants := make([]MerchantSpending, 0, len(byMerchant))
+	for _, merchant := range byMerchant {
+		merchant.Amount = roundCents(merchant.Amount)
+		if merchant.ReceiptCount > 0 {
+			merchant.AverageBasket = roundCents(merchant.spent / float64(merchant.ReceiptCount))
+		}
+		merchants = append(merchants, merchant.MerchantSpending)
+	}
+	sort.Slice(merchants, func(i, j int) bool {
+		if merchants[i].Amount != merchants[j].Amount {
+			return merchants[i].Amount > merchants[j].Amount
+		}
+		return merchants[i].Name < merchants[j].Name
+	})
+	if limit > 0 && len(merchants) > limit {
+		merchants = merchants[:limit]
+	}
+	return merchants, nil
+}
+
+// SpendingByMonth returns the net spending of every month the range touches, including months without receipts
+func SpendingByMonth(receipts []AnalyticsReceipt, r AnalyticsRange) []MonthlySpending {
+	months := []MonthlySpending{}
+	index := map[string]int{}
+	for month := time.Date(r.From.Year(), r.From.Month(), 1, 0, 0, 0, 0, time.UTC); !month.After(r.To); month = month.AddDate(0, 1, 0) {
+		index[month.Format("2006-01")] = len(months)
+		months = append(months, MonthlySpending{Month: month.Format("2006-01")})
+	}
+
+	for i := range receipts {
+		receipt := &receipts[i]
+		rate, ok := receipt.rateTo(r.Currency)
+		if !ok || len(receipt.TransactionDate) < 7 {
+			continue
+		}
+		m, ok := index[receipt.TransactionDate[:7]]
+		if !ok {
+			continue
+		}
+		month := &months[m]
+		month.Amount += receipt.signedTotal(rate)
+		if receipt.Type != ReceiptTypeRefund {
+			month.ReceiptCount++
+			month.Tax += receipt.Tax * rate
+			month.Discounts += receipt.Discounts * rate
+		}
+	}
+
+	for i := range months {
+		months[i].Amount = roundCents(months[i].Amount)
+		months[i].Tax = roundCents(months[i].Tax)
+		months[i].Discounts = roundCents(months[i].Discounts)
+	}
+	return months
+}
+
+// SpendingPatternsOf buckets the purchases by day of the week and by hour of the transaction time
+func SpendingPatternsOf(receipts []AnalyticsReceipt, r AnalyticsRange) SpendingPatterns {
+	patterns := SpendingPatterns{DayOfWeek: make([]SpendingBucket, 7), HourOfDay: make([]SpendingBucket, 24)}
+	for day := range patterns.DayOfWeek {
+		patterns.DayOfWeek[day].Day = strings.ToLower(time.Weekday((day + 1) % 7).String())
+	}
+	for hour := range patterns.HourOfDay {
+		h := hour
+		patterns.HourOfDay[hour].Hour = &h
+	}
+
+	for i := range receipts {
+		receipt := &receipts[i]
+		rate, ok := receipt.rateTo(r.Currency)
+		if !ok || receipt.Type == ReceiptTypeRefund {
+			continue
+		}
+		date, err := time.Parse("2006-01-02", receipt.TransactionDate)
+		if err != nil {
+			continue
+		}
+		amount := receipt.TotalAmount * rate
+
+		day := &patterns.DayOfWeek[(int(date.Weekday())+6)%7]
+		day.Amount += amount
+		day.ReceiptCount++
+
+		hour, ok := transactionHour(receipt.TransactionTime)
+		if !ok {
+			patterns.UntimedReceipts++
+			continue
+		}
+		patterns.HourOfDay[hour].Amount += amount
+		patterns.HourOfDay[hour].ReceiptCount++
+	}
+
+	for _, buckets := range [][]SpendingBucket{patterns.DayOfWeek, patterns.HourOfDay} {
+		for i := range buckets {
+			if buckets[i].ReceiptCount > 0 {
+				buckets[i].AverageBasket = roundCents(buckets[i].Amount / float64(buckets[i].ReceiptCount))
+			}
+			buckets[i].Amount = roundCents(buckets[i].Amount)
+		}
+	}
+	return patterns
+}
+
+// CompareSpending compares the totals and category spending of two periods
+func CompareSpending(current []AnalyticsReceipt, r AnalyticsRange, previous []AnalyticsReceipt, previousRange AnalyticsRange) SpendingComparison {
+	comparison := SpendingComparison{
+		Current:  SummarizeSpending(current, r),
+		Previous: SummarizeSpending(previous, previousRange),
+	}
+	comparison.Change = roundCents(comparison.Current.Net - comparison.Previous.Net)
+	comparison.ChangePercent = percentChange(comparison.Current.Net, comparison.Previous.Net)
+
+	changes := map[uuid.UUID]*CategoryChange{}
+	order := []uuid.UUID{}
+	categoryChange := func(category CategorySpending) *CategoryChange {
+		change := changes[category.CategoryID]
+		if change == nil {
+			change = &CategoryChange{CategoryID: category.CategoryID, Name: category.Name}
+			changes[category.CategoryID] = change
+			order = append(order, category.CategoryID)
+		}
+		return change
+	}
+	for _, category := range SpendingByCategory(current, r) {
+		categoryChange(category).Current = category.Amount
+	}
+	for _, category := range SpendingByCategory(previous, previousRange) {
+		categoryChange(category).Previous = category.Amount
+	}
+
+	comparison.Categories = make([]CategoryChange, 0, len(order))
+	for _, id := range order {
+		change := changes[id]
+		change.Change = roundCents(change.Current - change.Previous)
+		change.ChangePercent = percentChange(change.Current, change.Previous)
+		comparison.Categories = append(comparison.Categories, *change)
+	}
+	sort.SliceStable(comparison.Categories, func(i, j int) bool {
+		return absAmount(comparison.Categories[i].Change) > absAmount(comparison.Categories[j].Change)
+	})
+	return comparison
+}
+
+// transactionHour reads the hour of an HH:MM or HH:MM:SS transaction time
+func transactionHour(value string) (int, bool) {
+	if len(value) < 5 {
+		return 0, false
+	}
+	clock, err := time.Parse("15:04", value[:5])
+	if err != nil {
+		return 0, false
+	}
+	return clock.Hour(), true
+}
+
+// percentChange returns the change from previous to current in percent, nil when previous is zero
+func percentChange(current, previous float64) *float64 {
+	if previous == 0 {
+		return nil
+	}
+	change := roundCents((current - previous) / absAmount(previous) * 100)
+	return &change
+}
+
+func absAmount(amount float64) float64 {
+	if amount < 0 {
+		return -amount
+	}
+	return amount
+}
+
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
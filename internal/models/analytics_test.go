@@ -0,0 +1,70 @@
+package models
+
+import (
+	"math"
+	"receipt-mgmt/internal/services"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCurrencyConverterRate(t *testing.T) {
+	provider, err := services.ParseRatesTable(strings.NewReader("date,from,to,rate\n" +
+		"2024-01-01,USD,CAD,1.35\n" +
+		"2024-03-01,USD,CAD,1.40\n" +
+		"2024-01-01,EUR,CAD,1.45\n"))
+	if err != nil {
+		t.Fatalf("ParseRatesTable() = %v", err)
+	}
+	converter := &currencyConverter{currency: "CAD", provider: provider, rates: map[string]float64{}}
+
+	tests := []struct {
+		name         string
+		paid         string
+		converted    string
+		exchangeRate float64
+		date         string
+		want         float64
+		wantOK       bool
+	}{
+		{"paid in the currency", "CAD", "", 0, "2024-02-10", 1, true},
+		{"converted at upload", "USD", "CAD", 1.33, "2024-02-10", 1.33, true},
+		{"rate of the transaction date", "USD", "", 0, "2024-02-10", 1.35, true},
+		{"later rate", "USD", "", 0, "2024-03-15", 1.40, true},
+		{"not converted at upload", "USD", "CAD", 0, "2024-03-15", 1.40, true},
+		{"before the first rate", "USD", "", 0, "2023-12-31", 0, false},
+		{"currency without a rate", "GBP", "", 0, "2024-02-10", 0, false},
+		{"date that can't be read", "USD", "", 0, "Feb 10", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := converter.rate(tt.paid, tt.converted, tt.exchangeRate, tt.date)
+			if ok != tt.wantOK || math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("rate() = %v, %v; want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+
+	// Converting to another currency goes through the base currency
+	converter = &currencyConverter{currency: "USD", provider: provider, rates: map[string]float64{}}
+	if got, ok := converter.rate("EUR", "", 0, "2024-03-15"); !ok || math.Abs(got-1.45/1.40) > 1e-9 {
+		t.Errorf("rate() = %v, %v; want %v, true", got, ok, 1.45/1.40)
+	}
+}
+
+func TestSummarizeSpending(t *testing.T) {
+	r := AnalyticsRange{From: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC), Currency: "CAD"}
+	receipts := []AnalyticsReceipt{
+		{Type: ReceiptTypePurchase, Currency: "CAD", TotalAmount: 50, Tax: 6.5},
+		{Type: ReceiptTypePurchase, Currency: "USD", ConvertedCurrency: "CAD", ExchangeRate: 1.4, TotalAmount: 100},
+		{Type: ReceiptTypePurchase, Currency: "USD", TotalAmount: 20, rateCurrency: "CAD", rate: 1.35},
+		{Type: ReceiptTypeRefund, Currency: "CAD", TotalAmount: 10},
+		{Type: ReceiptTypePurchase, Currency: "GBP", TotalAmount: 30, rateCurrency: "CAD"},
+	}
+
+	got := SummarizeSpending(receipts, r)
+	if got.ReceiptCount != 3 || got.RefundCount != 1 || got.Spent != 217 || got.Net != 207 || got.Tax != 6.5 || got.ExcludedReceipts != 1 {
+		t.Errorf("SummarizeSpending() = %+v; want 3 purchases, 1 refund, 217 spent, 207 net, 6.5 tax and 1 excluded receipt", got)
+	}
+}
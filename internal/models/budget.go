@@ -0,0 +1,333 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"receipt-mgmt/db"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Budget periods
+const (
+	BudgetWeekly    = "weekly" // Monday to Sunday
+	BudgetMonthly   = "monthly"
+	BudgetQuarterly = "quarterly"
+	BudgetYearly    = "yearly"
+)
+
+// What a budget carries into the next period
+const (
+	RolloverNone    = "none"    // Every period starts from the budget amount
+	RolloverSurplus = "surplus" // Unspent money is added to the next period
+	RolloverFull    = "full"    // Unspent money is added and overspending is taken off the next period
+)
+
+// Budget statuses, from the share of the limit spent
+const (
+	BudgetOnTrack  = "on_track"
+	BudgetWarning  = "warning"  // At or above the first threshold
+	BudgetExceeded = "exceeded" // At or above the limit
+)
+
+// BudgetThresholds are the percentages of the limit that raise an alert when crossed
+var BudgetThresholds = []int{80, 100}
+
+// ErrBudgetExists is returned when the user already has a budget for the category and period
+var ErrBudgetExists = errors.New("a budget for this category and period already exists")
+
+// Budget is a spending limit for one of the user's categories over a repeating period
+type Budget struct {
+	BudgetID   uuid.UUID `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"budget_id"`
+	UserID     uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_budget_category_period" json:"user_id"`
+	CategoryID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_budget_category_period" json:"category_id"`
+	Period     string    `gorm:"type:varchar(10);not null;uniqueIndex:idx_budget_category_period" json:"period"` // weekly, monthly, quarterly or yearly
+	Amount     float64   `gorm:"type:decimal(10,2);not null" json:"amount"`                                      // Limit per period, in the user's currency
+	Rollover   string    `gorm:"type:varchar(10);not null;default:'none'" json:"rollover"`                       // none, surplus or full
+	StartDate  time.Time `gorm:"type:date;not null" json:"start_date"`                                           // Rollover is counted from the period holding this date
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// BudgetProgress is how much of a budget is spent in one period
+type BudgetProgress struct {
+	Budget
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"` // Last day of the period
+	Carried     float64   `json:"carried"`    // Brought over from earlier periods, negative after overspending
+	Limit       float64   `json:"limit"`      // Amount plus carried
+	Spent       float64   `json:"spent"`      // Sum of the category's expenses in the period, refunds deducted
+	Remaining   float64   `json:"remaining"`
+	PercentUsed float64   `json:"percent_used"`
+	Status      string    `json:"status"` // on_track, warning or exceeded
+}
+
+// BudgetAlert is raised once per period when spending in a budget crosses a threshold
+type BudgetAlert struct {
+	AlertID      uuid.UUID  `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"alert_id"`
+	UserID       uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	BudgetID     uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_budget_alert_threshold" json:"budget_id"`
+	CategoryID   uuid.UUID  `gorm:"type:uuid;not null" json:"category_id"`
+	PeriodStart  time.Time  `gorm:"type:date;not null;uniqueIndex:idx_budget_alert_threshold" json:"period_start"`
+	Threshold    int        `gorm:"not null;uniqueIndex:idx_budget_alert_threshold" json:"threshold"` // Percentage of the limit crossed
+	Spent        float64    `gorm:"type:decimal(10,2)" json:"spent"`
+	Limit        float64    `gorm:"column:limit_amount;type:decimal(10,2)" json:"limit"`
+	ReceiptID    *uuid.UUID `gorm:"type:uuid" json:"receipt_id"` // Upload that crossed the threshold
+	Acknowledged bool       `gorm:"default:false;index" json:"acknowledged"`
+	CreatedAt    time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	Budget       *Budget    `gorm:"foreignKey:BudgetID;references:BudgetID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// Validate checks the budget's amount, period and rollover option
+func (b *Budget) Validate() error {
+	if b.Amount <= 0 {
+		return errors.New("amount must be greater than zero")
+	}
+	switch b.Period {
+	case BudgetWeekly, BudgetMonthly, BudgetQuarterly, BudgetYearly:
+	default:
+		return errors.New("period must be weekly, monthly, quarterly or yearly")
+	}
+	switch b.Rollover {
+	case RolloverNone, RolloverSurplus, RolloverFull:
+	default:
+		return errors.New("rollover must be none, surplus or full")
+	}
+	return nil
+}
+
+// PeriodBounds returns the first day of the budget period holding the date and the first day of the next one
+func (b *Budget) PeriodBounds(date time.Time) (time.Time, time.Time) {
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	switch b.Period {
+	case BudgetWeekly:
+		start := day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+		return start, start.AddDate(0, 0, 7)
+	case BudgetQuarterly:
+		start := time.Date(day.Year(), day.Month()-(day.Month()-1)%3, 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 3, 0)
+	case BudgetYearly:
+		start := time.Date(day.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(1, 0, 0)
+	}
+	start := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 1, 0)
+}
+
+// GetUserBudgets returns the user's budgets
+func GetUserBudgets(userID uuid.UUID) ([]Budget, error) {
+	DB := db.GetDBInstance()
+
+	var budgets []Budget
+	err := DB.Where("user_id = ?", userID).Order("period ASC, created_at ASC").Find(&budgets).Error
+	return budgets, err
+}
+
+// GetBudgetByID returns one of the user's budgets
+func GetBudgetByID(budgetID, userID uuid.UUID) (*Budget, error) {
+	DB := db.GetDBInstance()
+
+	var budget Budget
+	if err := DB.Where("budget_id = ? AND user_id = ?", budgetID, userID).First(&budget).Error; err != nil {
+		return nil, err
+	}
+	return &budget, nil
+}
+
+// SaveBudget creates or updates a budget, rejecting a second budget for the same category and period
+func SaveBudget(budget *Budget) error {
+	DB := db.GetDBInstance()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&Budget{}).
+			Where("user_id = ? AND category_id = ? AND period = ? AND budget_id <> ?", budget.UserID, budget.CategoryID, budget.Period, budget.BudgetID).
+			Count(&count).Error; err != nil {
+			return fmt.Errorf("error checking existing budgets: %w", err)
+		}
+		if count > 0 {
+			return ErrBudgetExists
+		}
+		if err := tx.Save(budget).Error; err != nil {
+			return fmt.Errorf("error saving budget: %w", err)
+		}
+		return nil
+	})
+}
+
+// DeleteBudget deletes one of the user's budgets and its alerts
+func DeleteBudget(budget *Budget) error {
+	DB := db.GetDBInstance()
+
+	if err := DB.Delete(budget).Error; err != nil {
+		return fmt.Errorf("error deleting budget: %w", err)
+	}
+	return nil
+}
+
+// GetBudgetProgress works out how much of the budget is spent in the period holding the date
+func GetBudgetProgress(budget *Budget, date time.Time) (*BudgetProgress, error) {
+	return budgetProgress(db.GetDBInstance(), budget, date)
+}
+
+// budgetProgress computes the budget's progress within the given transaction. With rollover, the
+// periods since the start date are replayed to find what is carried over.
+func budgetProgress(tx *gorm.DB, budget *Budget, date time.Time) (*BudgetProgress, error) {
+	firstStart, _ := budget.PeriodBounds(budget.StartDate)
+	start, end := budget.PeriodBounds(date)
+	if budget.Rollover == RolloverNone || start.Before(firstStart) {
+		firstStart = start
+	}
+
+	var days []struct {
+		Day   time.Time
+		Spent float64
+	}
+	if err := tx.Model(&Expense{}).Select("date::date AS day, SUM(amount) AS spent").
+		Where("user_id = ? AND category_id = ? AND date >= ? AND date < ?", budget.UserID, budget.CategoryID, firstStart, end).
+		Group("day").Scan(&days).Error; err != nil {
+		return nil, fmt.Errorf("error adding up expenses: %w", err)
+	}
+	spentByPeriod := map[time.Time]float64{}
+	for _, day := range days {
+		periodStart, _ := budget.PeriodBounds(day.Day)
+		spentByPeriod[periodStart] += day.Spent
+	}
+
+	carried := 0.0
+	for periodStart := firstStart; periodStart.Before(start); {
+		_, next := budget.PeriodBounds(periodStart)
+		left := budget.Amount + carried - spentByPeriod[periodStart]
+		if budget.Rollover == RolloverSurplus {
+			left = math.Max(0, left)
+		}
+		carried = left
+		periodStart = next
+	}
+
+	progress := &BudgetProgress{
+		Budget:      *budget,
+		PeriodStart: start,
+		PeriodEnd:   end.AddDate(0, 0, -1),
+		Carried:     roundCents(carried),
+		Limit:       roundCents(budget.Amount + carried),
+		Spent:       roundCents(spentByPeriod[start]),
+	}
+	progress.Remaining = roundCents(progress.Limit - progress.Spent)
+	if progress.Limit > 0 {
+		progress.PercentUsed = math.Round(progress.Spent/progress.Limit*1000) / 10
+	} else if progress.Spent > 0 {
+		progress.PercentUsed = 100 // Overspending carried over left nothing to spend
+	}
+	progress.Status = BudgetOnTrack
+	if progress.PercentUsed >= float64(BudgetThresholds[0]) {
+		progress.Status = BudgetWarning
+	}
+	if progress.PercentUsed >= 100 {
+		progress.Status = BudgetExceeded
+	}
+	return progress, nil
+}
+
+// GetBudgetsProgress returns the progress of each of the user's budgets in the period holding the date
+func GetBudgetsProgress(userID uuid.UUID, date time.Time) ([]BudgetProgress, error) {
+	DB := db.GetDBInstance()
+
+	budgets, err := GetUserBudgets(userID)
+	if err != nil {
+		return nil, fmt.Errorf("error loading budgets: %w", err)
+	}
+	progress := make([]BudgetProgress, 0, len(budgets))
+	for i := range budgets {
+		p, err := budgetProgress(DB, &budgets[i], date)
+		if err != nil {
+			return nil, err
+		}
+		progress = append(progress, *p)
+	}
+	return progress, nil
+}
+
+// CheckBudgetThresholds raises the alerts for the thresholds the receipt's expenses pushed its
+// categories' budgets across. Each threshold is raised once per budget period.
+func CheckBudgetThresholds(receipt *Receipt) ([]BudgetAlert, error) {
+	DB := db.GetDBInstance()
+
+	alerts := []BudgetAlert{}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var budgets []Budget
+		if err := tx.Where("user_id = ? AND category_id IN (SELECT category_id FROM expenses WHERE receipt_id = ?)",
+			receipt.UserID, receipt.ReceiptID).Find(&budgets).Error; err != nil {
+			return fmt.Errorf("error loading budgets: %w", err)
+		}
+
+		date := receipt.expenseDate()
+		for i := range budgets {
+			progress, err := budgetProgress(tx, &budgets[i], date)
+			if err != nil {
+				return err
+			}
+			for _, threshold := range BudgetThresholds {
+				if progress.PercentUsed < float64(threshold) {
+					continue
+				}
+				alert := BudgetAlert{
+					AlertID:     uuid.New(),
+					UserID:      receipt.UserID,
+					BudgetID:    budgets[i].BudgetID,
+					CategoryID:  budgets[i].CategoryID,
+					PeriodStart: progress.PeriodStart,
+					Threshold:   threshold,
+					Spent:       progress.Spent,
+					Limit:       progress.Limit,
+					ReceiptID:   &receipt.ReceiptID,
+				}
+				// Already raised in this period by an earlier upload
+				result := tx.Where("budget_id = ? AND period_start = ? AND threshold = ?", alert.BudgetID, alert.PeriodStart, threshold).
+					FirstOrCreate(&alert)
+				if result.Error != nil {
+					return fmt.Errorf("error saving budget alert: %w", result.Error)
+				}
+				if result.RowsAffected > 0 {
+					alerts = append(alerts, alert)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return alerts, nil
+}
+
+// GetBudgetAlerts returns the user's budget alerts, latest first
+func GetBudgetAlerts(userID uuid.UUID, unacknowledgedOnly bool) ([]BudgetAlert, error) {
+	DB := db.GetDBInstance()
+
+	query := DB.Where("user_id = ?", userID)
+	if unacknowledgedOnly {
+		query = query.Where("NOT acknowledged")
+	}
+	var alerts []BudgetAlert
+	err := query.Order("created_at DESC").Find(&alerts).Error
+	return alerts, err
+}
+
+// AcknowledgeBudgetAlert marks one of the user's alerts as seen
+func AcknowledgeBudgetAlert(alertID, userID uuid.UUID) (*BudgetAlert, error) {
+	DB := db.GetDBInstance()
+
+	var alert BudgetAlert
+	if err := DB.Where("alert_id = ? AND user_id = ?", alertID, userID).First(&alert).Error; err != nil {
+		return nil, err
+	}
+	alert.Acknowledged = true
+	if err := DB.Model(&BudgetAlert{}).Where("alert_id = ?", alert.AlertID).Update("acknowledged", true).Error; err != nil {
+		return nil, fmt.Errorf("error acknowledging budget alert: %w", err)
+	}
+	return &alert, nil
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBudgetPeriodBounds(t *testing.T) {
+	tests := []struct {
+		period string
+		date   time.Time
+		start  string
+		end    string
+	}{
+		{BudgetWeekly, time.Date(2024, 3, 13, 15, 30, 0, 0, time.UTC), "2024-03-11", "2024-03-18"}, // Wednesday
+		{BudgetWeekly, time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC), "2024-03-11", "2024-03-18"},   // Monday
+		{BudgetWeekly, time.Date(2024, 3, 17, 23, 59, 0, 0, time.UTC), "2024-03-11", "2024-03-18"}, // Sunday
+		{BudgetWeekly, time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC), "2024-12-30", "2025-01-06"},
+		{BudgetMonthly, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), "2024-02-01", "2024-03-01"},
+		{BudgetMonthly, time.Date(2024, 12, 15, 0, 0, 0, 0, time.UTC), "2024-12-01", "2025-01-01"},
+		{BudgetQuarterly, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), "2024-01-01", "2024-04-01"},
+		{BudgetQuarterly, time.Date(2024, 6, 30, 0, 0, 0, 0, time.UTC), "2024-04-01", "2024-07-01"},
+		{BudgetQuarterly, time.Date(2024, 11, 5, 0, 0, 0, 0, time.UTC), "2024-10-01", "2025-01-01"},
+		{BudgetYearly, time.Date(2024, 7, 4, 0, 0, 0, 0, time.UTC), "2024-01-01", "2025-01-01"},
+		{"", time.Date(2024, 7, 4, 0, 0, 0, 0, time.UTC), "2024-07-01", "2024-08-01"}, // Monthly by default
+	}
+
+	for _, tt := range tests {
+		budget := &Budget{Period: tt.period}
+		start, end := budget.PeriodBounds(tt.date)
+		if got, want := start.Format("2006-01-02")+" "+end.Format("2006-01-02"), tt.start+" "+tt.end; got != want {
+			t.Errorf("%q PeriodBounds(%s) = %s; want %s", tt.period, tt.date.Format("2006-01-02"), got, want)
+		}
+	}
+}
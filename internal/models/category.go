@@ -0,0 +1,151 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"receipt-mgmt/db"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// FallbackCategoryName is the category that receipts and expenses move to when their category
+// is deleted and no other category is given
+const FallbackCategoryName = "Uncategorized"
+
+// ErrCategoryNameTaken is returned when the user already has a category, or there is a default one, with the same name
+var ErrCategoryNameTaken = errors.New("a category with this name already exists")
+
+// GetUserCategories returns the default categories followed by the user's own
+func GetUserCategories(userID uuid.UUID) ([]Category, error) {
+	DB := db.GetDBInstance()
+
+	var categories []Category
+	err := DB.Where("user_id = ? OR user_id IS NULL OR is_default = true", userID).
+		Order("user_id IS NOT NULL, name ASC").Find(&categories).Error
+	return categories, err
+}
+
+// GetCategoryByID returns a category the user can see, either a default one or their own
+func GetCategoryByID(tx *gorm.DB, categoryID, userID uuid.UUID) (*Category, error) {
+	var category Category
+	err := tx.Where("id = ? AND (user_id = ? OR user_id IS NULL OR is_default = true)", categoryID, userID).
+		First(&category).Error
+	if err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+// IsOwnedBy reports whether the category is a user-defined category of the given user
+func (c *Category) IsOwnedBy(userID uuid.UUID) bool {
+	return !c.IsDefault && c.UserID != nil && *c.UserID == userID
+}
+
+// SaveCategory creates or updates a user's category, rejecting names already used by the user or a default category
+func SaveCategory(category *Category) error {
+	DB := db.GetDBInstance()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&Category{}).
+			Where("LOWER(name) = LOWER(?) AND id <> ?", strings.TrimSpace(category.Name), category.ID).
+			Where("user_id = ? OR user_id IS NULL OR is_default = true", category.UserID).
+			Count(&count).Error; err != nil {
+			return fmt.Errorf("error checking category name: %w", err)
+		}
+		if count > 0 {
+			return ErrCategoryNameTaken
+		}
+
+		category.UpdatedAt = time.Now()
+		if err := tx.Save(category).Error; err != nil {
+			return fmt.Errorf("error saving category: %w", err)
+		}
+		return nil
+	})
+}
+
+// DeleteCategory soft deletes a user's category, moving the user's receipts, splits, expenses and rules to the
+// fallback category. When fallbackID is nil, the default "Uncategorized" category is used,
+// created for the user when there is none.
+func DeleteCategory(category *Category, fallbackID *uuid.UUID) (*Category, error) {
+	DB := db.GetDBInstance()
+	userID := *category.UserID
+
+	var fallback *Category
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if fallbackID != nil {
+			fallback, err = GetCategoryByID(tx, *fallbackID, userID)
+			if err != nil {
+				return fmt.Errorf("fallback category not found: %w", err)
+			}
+		} else {
+			fallback, err = findFallbackCategory(tx, userID, category.ID)
+			if err != nil {
+				return err
+			}
+		}
+		if fallback.ID == category.ID {
+			return errors.New("a category can't be its own fallback")
+		}
+
+		if err := tx.Model(&Receipt{}).Where("user_id = ? AND category_id = ?", userID, category.ID).
+			Update("category_id", fallback.ID).Error; err != nil {
+			return fmt.Errorf("error moving receipts: %w", err)
+		}
+		if err := tx.Model(&ReceiptSplit{}).Where("user_id = ? AND category_id = ?", userID, category.ID).
+			Update("category_id", fallback.ID).Error; err != nil {
+			return fmt.Errorf("error moving receipt splits: %w", err)
+		}
+		if err := tx.Model(&Expense{}).Where("user_id = ? AND category_id = ?", userID, category.ID).
+			Updates(map[string]interface{}{"category_id": fallback.ID, "updated_at": time.Now()}).Error; err != nil {
+			return fmt.Errorf("error moving expenses: %w", err)
+		}
+		if err := tx.Model(&Rule{}).Where("user_id = ? AND actions->>'category_id' = ?", userID, category.ID.String()).
+			Updates(map[string]interface{}{
+				"actions":    gorm.Expr("jsonb_set(actions, '{category_id}', to_jsonb(?::text))", fallback.ID.String()),
+				"updated_at": time.Now(),
+			}).Error; err != nil {
+			return fmt.Errorf("error moving rules: %w", err)
+		}
+		// The fallback may already have its own budgets, so the category's budgets go with it
+		if err := tx.Where("user_id = ? AND category_id = ?", userID, category.ID).Delete(&Budget{}).Error; err != nil {
+			return fmt.Errorf("error deleting category budgets: %w", err)
+		}
+
+		if err := tx.Delete(category).Error; err != nil {
+			return fmt.Errorf("error deleting category: %w", err)
+		}
+		return nil
+	})
+	return fallback, err
+}
+
+// findFallbackCategory returns the default or user's "Uncategorized" category, creating it for the user when missing
+func findFallbackCategory(tx *gorm.DB, userID, excludeID uuid.UUID) (*Category, error) {
+	var fallback Category
+	err := tx.Where("LOWER(name) = LOWER(?) AND id <> ?", FallbackCategoryName, excludeID).
+		Where("user_id = ? OR user_id IS NULL OR is_default = true", userID).
+		Order("user_id IS NOT NULL").First(&fallback).Error
+	if err == nil {
+		return &fallback, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("error looking up fallback category: %w", err)
+	}
+
+	fallback = Category{
+		ID:          uuid.New(),
+		UserID:      &userID,
+		Name:        FallbackCategoryName,
+		Description: "Receipts and expenses from deleted categories",
+	}
+	if err := tx.Create(&fallback).Error; err != nil {
+		return nil, fmt.Errorf("error creating fallback category: %w", err)
+	}
+	return &fallback, nil
+}
@@ -0,0 +1,265 @@
+package models
+
+import (
+	"fmt"
+	"receipt-mgmt/db"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MerchantCategoryPreference is what the service has learned about the category a user files a merchant under.
+// Accepted suggestions and chosen categories raise the weight, replaced suggestions lower it.
+type MerchantCategoryPreference struct {
+	PreferenceID uuid.UUID `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"preference_id"`
+	UserID       uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_merchant_category_preference" json:"user_id"`
+	MerchantID   uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_merchant_category_preference" json:"merchant_id"`
+	CategoryID   uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_merchant_category_preference" json:"category_id"`
+	Weight       float64   `gorm:"type:decimal(8,2);not null;default:0" json:"weight"`
+	UpdatedAt    time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// CategorySuggestion is a category proposed for a receipt, with a confidence between 0 and 1
+type CategorySuggestion struct {
+	CategoryID uuid.UUID `json:"category_id"`
+	Name       string    `json:"name"`
+	Confidence float64   `json:"confidence"`
+}
+
+// MaxCategoryAlternatives is how many alternatives are returned next to the best suggestion
+const MaxCategoryAlternatives = 3
+
+// Weights of the evidence behind a suggestion; they add up to 1 so the best score is the confidence
+const (
+	historyEvidenceWeight = 0.5 // Categories of the user's earlier receipts from the merchant
+	learnedEvidenceWeight = 0.2 // Accepted and replaced suggestions
+	keywordEvidenceWeight = 0.3 // Category keywords found in the merchant name and items
+)
+
+// defaultCategoryKeywords lists the words that point to the usual default categories, keyed by lower-case category name
+var defaultCategoryKeywords = map[string][]string{
+	"groceries":      {"grocery", "supermarket", "market", "epicerie", "produce", "milk", "bread", "eggs", "cheese", "fromage", "banana", "apple", "lait", "pain", "meat", "chicken", "vegetable", "fruit", "loblaws", "sobeys", "metro", "iga", "provigo", "no frills", "food basics", "freshco"},
+	"food":           {"grocery", "supermarket", "restaurant", "cafe", "coffee", "pizza", "burger", "bakery", "boulangerie", "epicerie", "meal", "sandwich"},
+	"dining":         {"restaurant", "cafe", "coffee", "pizza", "burger", "sushi", "bistro", "bar", "pub", "grill", "tim hortons", "starbucks", "mcdonalds", "subway", "tip", "pourboire"},
+	"restaurants":    {"restaurant", "cafe", "coffee", "pizza", "burger", "sushi", "bistro", "bar", "pub", "grill", "tim hortons", "starbucks", "mcdonalds", "subway"},
+	"transportation": {"gas", "fuel", "essence", "petro", "esso", "shell", "ultramar", "irving", "parking", "stationnement", "transit", "uber", "lyft", "taxi", "presto", "opus", "toll"},
+	"gas":            {"gas", "fuel", "essence", "diesel", "petro", "esso", "shell", "ultramar", "irving", "pump"},
+	"utilities":      {"hydro", "electric", "electricity", "water", "internet", "phone", "mobile", "wireless", "bell", "rogers", "telus", "videotron", "fido", "enbridge"},
+	"entertainment":  {"cinema", "cineplex", "movie", "theatre", "theater", "concert", "ticket", "billet", "netflix", "spotify", "game", "bowling"},
+	"health":         {"pharmacy", "pharmacie", "drug", "shoppers", "jean coutu", "rexall", "uniprix", "prescription", "rx", "vitamin", "clinic", "dental", "optical"},
+	"shopping":       {"clothing", "apparel", "shoes", "mall", "winners", "walmart", "amazon", "canadian tire", "dollarama", "best buy", "ikea"},
+	"clothing":       {"clothing", "apparel", "shirt", "pants", "jeans", "dress", "shoes", "socks", "jacket", "vetement"},
+	"home":           {"hardware", "quincaillerie", "home depot", "rona", "lowes", "home hardware", "furniture", "ikea", "paint", "lumber", "garden"},
+	"electronics":    {"electronics", "best buy", "apple", "cable", "charger", "laptop", "computer", "phone", "headphones", "battery"},
+	"personal care":  {"salon", "barber", "spa", "shampoo", "soap", "cosmetic", "toothpaste", "deodorant"},
+	"travel":         {"hotel", "motel", "airbnb", "air canada", "westjet", "via rail", "airline", "flight", "car rental"},
+	"education":      {"book", "livre", "tuition", "school", "course", "indigo", "textbook"},
+	"office":         {"staples", "bureau en gros", "office", "paper", "printer", "ink", "toner", "envelope"},
+}
+
+// SuggestReceiptCategories ranks the categories the user can file the receipt under, from the user's
+// history with the merchant, what was learned from earlier suggestions, and the category keywords
+// found in the merchant name and item names. The best suggestion comes first.
+func SuggestReceiptCategories(receipt *Receipt, itemNames []string) ([]CategorySuggestion, error) {
+	categories, err := GetUserCategories(receipt.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("error loading categories: %w", err)
+	}
+
+	history, learned := map[uuid.UUID]float64{}, map[uuid.UUID]float64{}
+	if receipt.MerchantID != nil {
+		if history, err = merchantCategoryHistory(receipt.UserID, *receipt.MerchantID, receipt.ReceiptID); err != nil {
+			return nil, err
+		}
+		if learned, err = merchantCategoryWeights(receipt.UserID, *receipt.MerchantID); err != nil {
+			return nil, err
+		}
+	}
+
+	text := strings.Join(append([]string{receipt.Merchant}, itemNames...), " ")
+	return rankCategories(categories, history, learned, text), nil
+}
+
+// rankCategories scores each category from the merchant history, the learned weights and the keywords
+// found in the text, and returns the best ones first
+func rankCategories(categories []Category, history, learned map[uuid.UUID]float64, text string) []CategorySuggestion {
+	text = " " + normalizeKeywordText(text) + " "
+	keywords := map[uuid.UUID]float64{}
+	for _, category := range categories {
+		keywords[category.ID] = float64(countCategoryKeywords(category, text))
+	}
+
+	historyTotal, learnedTotal, keywordTotal := sumPositive(history), sumPositive(learned), sumPositive(keywords)
+	suggestions := []CategorySuggestion{}
+	for _, category := range categories {
+		score := 0.0
+		if historyTotal > 0 {
+			score += historyEvidenceWeight * history[category.ID] / historyTotal
+		}
+		if learnedTotal > 0 && learned[category.ID] > 0 {
+			score += learnedEvidenceWeight * learned[category.ID] / learnedTotal
+		}
+		if keywordTotal > 0 {
+			score += keywordEvidenceWeight * keywords[category.ID] / keywordTotal
+		}
+		if learned[category.ID] < 0 {
+			// The user replaced this suggestion before
+			score /= 2
+		}
+		if score > 0 {
+			suggestions = append(suggestions, CategorySuggestion{CategoryID: category.ID, Name: category.Name, Confidence: roundConfidence(score)})
+		}
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool { return suggestions[i].Confidence > suggestions[j].Confidence })
+	if len(suggestions) > MaxCategoryAlternatives+1 {
+		suggestions = suggestions[:MaxCategoryAlternatives+1]
+	}
+	return suggestions
+}
+
+// merchantCategoryHistory counts the user's other receipts from the merchant per confirmed category
+func merchantCategoryHistory(userID, merchantID, excludeReceiptID uuid.UUID) (map[uuid.UUID]float64, error) {
+	DB := db.GetDBInstance()
+
+	var rows []struct {
+		CategoryID uuid.UUID
+		Count      float64
+	}
+	err := DB.Model(&Receipt{}).Select("category_id, COUNT(*) AS count").
+		Where("user_id = ? AND merchant_id = ? AND receipt_id <> ? AND category_suggested = false", userID, merchantID, excludeReceiptID).
+		Group("category_id").Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("error loading merchant history: %w", err)
+	}
+
+	history := map[uuid.UUID]float64{}
+	for _, row := range rows {
+		history[row.CategoryID] = row.Count
+	}
+	return history, nil
+}
+
+// merchantCategoryWeights returns the learned weight of each category for the merchant
+func merchantCategoryWeights(userID, merchantID uuid.UUID) (map[uuid.UUID]float64, error) {
+	DB := db.GetDBInstance()
+
+	var preferences []MerchantCategoryPreference
+	if err := DB.Where("user_id = ? AND merchant_id = ?", userID, merchantID).Find(&preferences).Error; err != nil {
+		return nil, fmt.Errorf("error loading category preferences: %w", err)
+	}
+
+	weights := map[uuid.UUID]float64{}
+	for _, preference := range preferences {
+		weights[preference.CategoryID] = preference.Weight
+	}
+	return weights, nil
+}
+
+// LearnCategoryChoice adjusts the learned weight of a category for the user and merchant
+func LearnCategoryChoice(tx *gorm.DB, userID, merchantID, categoryID uuid.UUID, delta float64) error {
+	preference := MerchantCategoryPreference{
+		PreferenceID: uuid.New(),
+		UserID:       userID,
+		MerchantID:   merchantID,
+		CategoryID:   categoryID,
+		Weight:       delta,
+	}
+	err := tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}, {Name: "merchant_id"}, {Name: "category_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"weight":     gorm.Expr("merchant_category_preferences.weight + ?", delta),
+			"updated_at": time.Now(),
+		}),
+	}).Create(&preference).Error
+	if err != nil {
+		return fmt.Errorf("error learning category choice: %w", err)
+	}
+	return nil
+}
+
+// AcceptSuggestedCategory confirms the category suggested for a receipt and learns it for the merchant
+func AcceptSuggestedCategory(receipt *Receipt) error {
+	DB := db.GetDBInstance()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Receipt{}).Where("receipt_id = ?", receipt.ReceiptID).
+			Update("category_suggested", false).Error; err != nil {
+			return fmt.Errorf("error confirming category: %w", err)
+		}
+		receipt.CategorySuggested = false
+
+		if receipt.MerchantID == nil {
+			return nil
+		}
+		return LearnCategoryChoice(tx, receipt.UserID, *receipt.MerchantID, receipt.CategoryID, 1)
+	})
+}
+
+// LearnCategoryChange learns from a user moving a receipt to another category: a replaced suggestion
+// counts against the suggested category, and the chosen category is reinforced
+func LearnCategoryChange(tx *gorm.DB, receipt *Receipt, previousCategoryID uuid.UUID) error {
+	if receipt.MerchantID == nil || previousCategoryID == receipt.CategoryID {
+		return nil
+	}
+
+	reward := 1.0
+	if receipt.CategorySuggested {
+		if err := LearnCategoryChoice(tx, receipt.UserID, *receipt.MerchantID, previousCategoryID, -1); err != nil {
+			return err
+		}
+		reward = 2
+	}
+	return LearnCategoryChoice(tx, receipt.UserID, *receipt.MerchantID, receipt.CategoryID, reward)
+}
+
+// FallbackCategory returns the "Uncategorized" category used when nothing else applies, creating it for the user when missing
+func FallbackCategory(tx *gorm.DB, userID uuid.UUID) (*Category, error) {
+	return findFallbackCategory(tx, userID, uuid.Nil)
+}
+
+// countCategoryKeywords counts the category's keywords, and the words of its own name, found in the text
+func countCategoryKeywords(category Category, text string) int {
+	keywords := append([]string{}, defaultCategoryKeywords[strings.ToLower(category.Name)]...)
+	for _, word := range strings.Fields(normalizeKeywordText(category.Name)) {
+		if len(word) > 2 {
+			keywords = append(keywords, word)
+		}
+	}
+
+	count := 0
+	for _, keyword := range keywords {
+		if strings.Contains(text, " "+keyword+" ") {
+			count++
+		}
+	}
+	return count
+}
+
+// normalizeKeywordText lower-cases the text, strips accents and keeps only letters, digits and single spaces
+func normalizeKeywordText(text string) string {
+	lower := strings.ToLower(stripAccents(text))
+	return strings.Join(strings.FieldsFunc(lower, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	}), " ")
+}
+
+// sumPositive adds up the positive values of the map
+func sumPositive(values map[uuid.UUID]float64) float64 {
+	sum := 0.0
+	for _, value := range values {
+		if value > 0 {
+			sum += value
+		}
+	}
+	return sum
+}
+
+// roundConfidence rounds a confidence to four decimal places, as stored
+func roundConfidence(confidence float64) float64 {
+	return float64(int(confidence*10000+0.5)) / 10000
+}
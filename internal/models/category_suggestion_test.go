@@ -0,0 +1,147 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// dryRunDB returns a database that builds statements without running them, and the statements it built
+func dryRunDB(t *testing.T) (*gorm.DB, *[]string) {
+	t.Helper()
+
+	tx, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost user=test dbname=test sslmode=disable"}),
+		&gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatalf("gorm.Open() = %v", err)
+	}
+
+	statements := []string{}
+	record := func(tx *gorm.DB) {
+		statements = append(statements, tx.Dialector.Explain(tx.Statement.SQL.String(), tx.Statement.Vars...))
+	}
+	if err := tx.Callback().Create().After("gorm:create").Register("test:record", record); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+	if err := tx.Callback().Query().After("gorm:query").Register("test:record", record); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+	return tx, &statements
+}
+
+func TestRankCategories(t *testing.T) {
+	groceries := Category{ID: uuid.New(), Name: "Groceries"}
+	health := Category{ID: uuid.New(), Name: "Health"}
+	dining := Category{ID: uuid.New(), Name: "Dining"}
+	home := Category{ID: uuid.New(), Name: "Home"}
+	office := Category{ID: uuid.New(), Name: "Office"}
+	categories := []Category{groceries, health, dining, home, office}
+
+	tests := []struct {
+		name    string
+		history map[uuid.UUID]float64
+		learned map[uuid.UUID]float64
+		text    string
+		want    []CategorySuggestion
+	}{
+		{
+			name: "keywords only",
+			text: "SHOPPERS DRUG MART VITAMIN D",
+			want: []CategorySuggestion{{CategoryID: health.ID, Name: "Health", Confidence: 0.3}},
+		},
+		{
+			name:    "history and keywords",
+			history: map[uuid.UUID]float64{groceries.ID: 3, health.ID: 1},
+			text:    "LOBLAWS MILK BREAD",
+			want: []CategorySuggestion{
+				{CategoryID: groceries.ID, Name: "Groceries", Confidence: 0.675},
+				{CategoryID: health.ID, Name: "Health", Confidence: 0.125},
+			},
+		},
+		{
+			name:    "learned weights",
+			history: map[uuid.UUID]float64{groceries.ID: 1},
+			learned: map[uuid.UUID]float64{groceries.ID: 3, dining.ID: 1},
+			text:    "CORNER STORE",
+			want: []CategorySuggestion{
+				{CategoryID: groceries.ID, Name: "Groceries", Confidence: 0.65},
+				{CategoryID: dining.ID, Name: "Dining", Confidence: 0.05},
+			},
+		},
+		{
+			name:    "replaced suggestion is halved",
+			history: map[uuid.UUID]float64{groceries.ID: 1, health.ID: 1},
+			learned: map[uuid.UUID]float64{groceries.ID: -1},
+			text:    "CORNER STORE",
+			want: []CategorySuggestion{
+				{CategoryID: health.ID, Name: "Health", Confidence: 0.25},
+				{CategoryID: groceries.ID, Name: "Groceries", Confidence: 0.125},
+			},
+		},
+		{
+			name:    "capped to the best suggestion and three alternatives",
+			history: map[uuid.UUID]float64{groceries.ID: 5, health.ID: 4, dining.ID: 3, home.ID: 2, office.ID: 1},
+			want: []CategorySuggestion{
+				{CategoryID: groceries.ID, Name: "Groceries", Confidence: 0.1667},
+				{CategoryID: health.ID, Name: "Health", Confidence: 0.1333},
+				{CategoryID: dining.ID, Name: "Dining", Confidence: 0.1},
+				{CategoryID: home.ID, Name: "Home", Confidence: 0.0667},
+			},
+		},
+		{
+			name: "nothing matches",
+			text: "ACME 1234",
+			want: []CategorySuggestion{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rankCategories(categories, tt.history, tt.learned, tt.text)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rankCategories() = %+v; want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLearnCategoryChange(t *testing.T) {
+	merchantID := uuid.New()
+	previous, chosen := uuid.New(), uuid.New()
+
+	tests := []struct {
+		name       string
+		merchantID *uuid.UUID
+		suggested  bool
+		categoryID uuid.UUID
+		want       []string // Category and weight change of each statement
+	}{
+		{"replaced suggestion", &merchantID, true, chosen, []string{previous.String() + "',-1", chosen.String() + "',2"}},
+		{"changed confirmed category", &merchantID, false, chosen, []string{chosen.String() + "',1"}},
+		{"same category", &merchantID, true, previous, nil},
+		{"no merchant", nil, true, chosen, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx, statements := dryRunDB(t)
+			receipt := &Receipt{UserID: uuid.New(), MerchantID: tt.merchantID, CategoryID: tt.categoryID, CategorySuggested: tt.suggested}
+			if err := LearnCategoryChange(tx, receipt, previous); err != nil {
+				t.Fatalf("LearnCategoryChange() = %v", err)
+			}
+
+			if len(*statements) != len(tt.want) {
+				t.Fatalf("LearnCategoryChange() ran %d statements; want %d: %q", len(*statements), len(tt.want), *statements)
+			}
+			for i, statement := range *statements {
+				if !strings.Contains(statement, tt.want[i]) || !strings.Contains(statement, "ON CONFLICT") {
+					t.Errorf("LearnCategoryChange() statement %d = %s; want %s", i, statement, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,300 @@
+package models
+
+import (
+	"fmt"
+	"receipt-mgmt/db"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Kinds of receipt and expense inconsistencies
+const (
+	IssueReceiptWithoutExpense = "receipt_without_expense" // A receipt whose expense was never created or was lost
+	IssueOrphanExpense         = "orphan_expense"          // An expense pointing to a receipt that no longer exists
+	IssueExpenseOutOfSync      = "expense_out_of_sync"     // Expenses that don't add up to the receipt's amount
+	IssueOrphanCorrection      = "orphan_correction"       // A correction of a receipt that no longer exists
+	IssueOrphanRefundLink      = "orphan_refund_link"      // A refund whose original receipt no longer exists
+	IssueOrphanStatementMatch  = "orphan_statement_match"  // A statement transaction matched to a receipt that no longer exists
+	IssueOrphanBudgetAlert     = "orphan_budget_alert"     // A budget alert raised by a receipt that no longer exists
+)
+
+// ConsistencyIssue is one receipt or expense found in an inconsistent state
+type ConsistencyIssue struct {
+	Kind      string     `json:"kind"`
+	UserID    uuid.UUID  `json:"user_id"`
+	ReceiptID *uuid.UUID `json:"receipt_id,omitempty"`
+	ExpenseID *uuid.UUID `json:"expense_id,omitempty"`
+	// The correction, refund, statement transaction or budget alert pointing to a missing receipt
+	ReferenceID *uuid.UUID `json:"reference_id,omitempty"`
+	Detail      string     `json:"detail"`
+}
+
+// FindConsistencyIssues looks for receipts and expenses that don't agree, taking the configured
+// expense policies into account: receipts without expenses are expected when updates unlink them,
+// and expenses of archived receipts are expected when deletes keep them.
+func FindConsistencyIssues(tx *gorm.DB) ([]ConsistencyIssue, error) {
+	issues := []ConsistencyIssue{}
+
+	if ExpenseUpdatePolicy() != ExpensePolicyUnlink {
+		var receipts []Receipt
+		if err := tx.Omit("image").
+			Where("NOT EXISTS (SELECT 1 FROM expenses WHERE expenses.receipt_id = receipts.receipt_id)").
+			Find(&receipts).Error; err != nil {
+			return nil, fmt.Errorf("error looking up receipts without expense: %w", err)
+		}
+		for _, receipt := range receipts {
+			receiptID := receipt.ReceiptID
+			issues = append(issues, ConsistencyIssue{
+				Kind:      IssueReceiptWithoutExpense,
+				UserID:    receipt.UserID,
+				ReceiptID: &receiptID,
+				Detail:    fmt.Sprintf("receipt from %s on %s has no expense", receipt.Merchant, receipt.TransactionDate),
+			})
+		}
+	}
+
+	var expenses []Expense
+	if err := tx.Where("receipt_id IS NOT NULL").Where(missingReceipt("expenses.receipt_id")).
+		Find(&expenses).Error; err != nil {
+		return nil, fmt.Errorf("error looking up orphan expenses: %w", err)
+	}
+	for _, expense := range expenses {
+		expenseID := expense.ExpenseID
+		issues = append(issues, ConsistencyIssue{
+			Kind:      IssueOrphanExpense,
+			UserID:    expense.UserID,
+			ReceiptID: expense.ReceiptID,
+			ExpenseID: &expenseID,
+			Detail:    fmt.Sprintf("expense of %.2f points to deleted receipt %s", expense.Amount, *expense.ReceiptID),
+		})
+	}
+
+	if ExpenseUpdatePolicy() == ExpensePolicySync {
+		outOfSync, err := findExpensesOutOfSync(tx)
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, outOfSync...)
+	}
+
+	dangling, err := findDanglingReceiptReferences(tx)
+	if err != nil {
+		return nil, err
+	}
+	return append(issues, dangling...), nil
+}
+
+// missingReceipt is the condition that the receipt in the given column no longer exists. Archived
+// receipts still count as existing when the on_delete policy keeps them.
+func missingReceipt(column string) *gorm.DB {
+	return db.GetDBInstance().Where(
+		fmt.Sprintf("NOT EXISTS (SELECT 1 FROM receipts WHERE receipts.receipt_id = %s AND (receipts.deleted_at IS NULL OR ?))", column),
+		ExpenseDeletePolicy() == ExpensePolicyKeep)
+}
+
+// findDanglingReceiptReferences finds the corrections, refunds, statement transactions and budget
+// alerts that still point to a deleted receipt
+func findDanglingReceiptReferences(tx *gorm.DB) ([]ConsistencyIssue, error) {
+	issues := []ConsistencyIssue{}
+
+	var corrections []ReceiptCorrection
+	if err := tx.Where(missingReceipt("receipt_corrections.receipt_id")).Find(&corrections).Error; err != nil {
+		return nil, fmt.Errorf("error looking up orphan corrections: %w", err)
+	}
+	for _, correction := range corrections {
+		receiptID, correctionID := correction.ReceiptID, correction.CorrectionID
+		issues = append(issues, ConsistencyIssue{
+			Kind:        IssueOrphanCorrection,
+			UserID:      correction.UserID,
+			ReceiptID:   &receiptID,
+			ReferenceID: &correctionID,
+			Detail:      fmt.Sprintf("correction of %s points to deleted receipt %s", correction.Field, receiptID),
+		})
+	}
+
+	var refunds []Receipt
+	if err := tx.Omit("image", "ocr_text").Where("original_receipt_id IS NOT NULL").
+		Where(missingReceipt("receipts.original_receipt_id")).Find(&refunds).Error; err != nil {
+		return nil, fmt.Errorf("error looking up orphan refund links: %w", err)
+	}
+	for _, refund := range refunds {
+		refundID := refund.ReceiptID
+		issues = append(issues, ConsistencyIssue{
+			Kind:        IssueOrphanRefundLink,
+			UserID:      refund.UserID,
+			ReceiptID:   refund.OriginalReceiptID,
+			ReferenceID: &refundID,
+			Detail:      fmt.Sprintf("refund from %s points to deleted receipt %s", refund.Merchant, *refund.OriginalReceiptID),
+		})
+	}
+
+	var transactions []StatementTransaction
+	if err := tx.Where("receipt_id IS NOT NULL").Where(missingReceipt("statement_transactions.receipt_id")).
+		Find(&transactions).Error; err != nil {
+		return nil, fmt.Errorf("error looking up orphan statement matches: %w", err)
+	}
+	for _, transaction := range transactions {
+		transactionID := transaction.TransactionID
+		issues = append(issues, ConsistencyIssue{
+			Kind:        IssueOrphanStatementMatch,
+			UserID:      transaction.UserID,
+			ReceiptID:   transaction.ReceiptID,
+			ReferenceID: &transactionID,
+			Detail:      fmt.Sprintf("statement transaction of %.2f is matched to deleted receipt %s", transaction.Amount, *transaction.ReceiptID),
+		})
+	}
+
+	var alerts []BudgetAlert
+	if err := tx.Where("receipt_id IS NOT NULL").Where(missingReceipt("budget_alerts.receipt_id")).
+		Find(&alerts).Error; err != nil {
+		return nil, fmt.Errorf("error looking up orphan budget alerts: %w", err)
+	}
+	for _, alert := range alerts {
+		alertID := alert.AlertID
+		issues = append(issues, ConsistencyIssue{
+			Kind:        IssueOrphanBudgetAlert,
+			UserID:      alert.UserID,
+			ReceiptID:   alert.ReceiptID,
+			ReferenceID: &alertID,
+			Detail:      fmt.Sprintf("budget alert at %d%% points to deleted receipt %s", alert.Threshold, *alert.ReceiptID),
+		})
+	}
+	return issues, nil
+}
+
+// findExpensesOutOfSync finds receipts whose expenses don't add up to the receipt's expense amount
+func findExpensesOutOfSync(tx *gorm.DB) ([]ConsistencyIssue, error) {
+	var totals []struct {
+		ReceiptID uuid.UUID
+		Total     float64
+	}
+	if err := tx.Model(&Expense{}).Select("receipt_id, SUM(amount) AS total").
+		Where("receipt_id IS NOT NULL").Group("receipt_id").Scan(&totals).Error; err != nil {
+		return nil, fmt.Errorf("error adding up receipt expenses: %w", err)
+	}
+	expenseTotals := make(map[uuid.UUID]float64, len(totals))
+	receiptIDs := make([]uuid.UUID, 0, len(totals))
+	for _, total := range totals {
+		expenseTotals[total.ReceiptID] = total.Total
+		receiptIDs = append(receiptIDs, total.ReceiptID)
+	}
+
+	issues := []ConsistencyIssue{}
+	for start := 0; start < len(receiptIDs); start += 500 {
+		end := start + 500
+		if end > len(receiptIDs) {
+			end = len(receiptIDs)
+		}
+
+		var receipts []Receipt
+		if err := tx.Omit("image").Where("receipt_id IN ?", receiptIDs[start:end]).Find(&receipts).Error; err != nil {
+			return nil, fmt.Errorf("error loading receipts: %w", err)
+		}
+		for _, receipt := range receipts {
+			total := roundCents(expenseTotals[receipt.ReceiptID])
+			if total == roundCents(receipt.ExpenseAmount()) {
+				continue
+			}
+			receiptID := receipt.ReceiptID
+			issues = append(issues, ConsistencyIssue{
+				Kind:      IssueExpenseOutOfSync,
+				UserID:    receipt.UserID,
+				ReceiptID: &receiptID,
+				Detail:    fmt.Sprintf("expenses add up to %.2f but the receipt amounts to %.2f", total, receipt.ExpenseAmount()),
+			})
+		}
+	}
+	return issues, nil
+}
+
+// RepairConsistencyIssue fixes one issue: a missing expense is created, an orphan expense is deleted
+// or unlinked following the on_delete policy, out of sync expenses are updated from the receipt,
+// and references to a deleted receipt are cleared as deleting it does now
+func RepairConsistencyIssue(tx *gorm.DB, issue ConsistencyIssue) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		switch issue.Kind {
+		case IssueReceiptWithoutExpense:
+			var receipt Receipt
+			if err := tx.Omit("image").Where("receipt_id = ?", issue.ReceiptID).First(&receipt).Error; err != nil {
+				return fmt.Errorf("error loading receipt: %w", err)
+			}
+			if err := tx.Create(receipt.newExpense()).Error; err != nil {
+				return fmt.Errorf("error creating expense: %w", err)
+			}
+
+		case IssueOrphanExpense:
+			query := tx.Model(&Expense{}).Where("expense_id = ?", issue.ExpenseID)
+			if ExpenseDeletePolicy() == ExpensePolicyDelete {
+				if err := query.Delete(&Expense{}).Error; err != nil {
+					return fmt.Errorf("error deleting orphan expense: %w", err)
+				}
+				return nil
+			}
+			// Even with the keep policy there is no receipt left to point to
+			if err := query.Update("receipt_id", nil).Error; err != nil {
+				return fmt.Errorf("error unlinking orphan expense: %w", err)
+			}
+
+		case IssueExpenseOutOfSync:
+			var receipt Receipt
+			if err := tx.Omit("image").Where("receipt_id = ?", issue.ReceiptID).First(&receipt).Error; err != nil {
+				return fmt.Errorf("error loading receipt: %w", err)
+			}
+			var expenses int64
+			if err := tx.Model(&Expense{}).Where("receipt_id = ?", receipt.ReceiptID).Count(&expenses).Error; err != nil {
+				return fmt.Errorf("error counting expenses: %w", err)
+			}
+			var splits int64
+			if err := tx.Model(&ReceiptSplit{}).Where("receipt_id = ?", receipt.ReceiptID).Count(&splits).Error; err != nil {
+				return fmt.Errorf("error counting splits: %w", err)
+			}
+			if expenses > 1 && splits == 0 {
+				// Duplicates from before creation was transactional; keep the oldest one
+				var keep Expense
+				if err := tx.Where("receipt_id = ?", receipt.ReceiptID).Order("created_at ASC").First(&keep).Error; err != nil {
+					return fmt.Errorf("error loading expense: %w", err)
+				}
+				if err := tx.Where("receipt_id = ? AND expense_id <> ?", receipt.ReceiptID, keep.ExpenseID).
+					Delete(&Expense{}).Error; err != nil {
+					return fmt.Errorf("error deleting duplicate expenses: %w", err)
+				}
+			}
+			return syncReceiptExpense(tx, &receipt)
+
+		case IssueOrphanCorrection:
+			if err := tx.Where("correction_id = ?", issue.ReferenceID).Delete(&ReceiptCorrection{}).Error; err != nil {
+				return fmt.Errorf("error deleting orphan correction: %w", err)
+			}
+
+		case IssueOrphanRefundLink:
+			if err := tx.Model(&Receipt{}).Where("receipt_id = ?", issue.ReferenceID).
+				Update("original_receipt_id", nil).Error; err != nil {
+				return fmt.Errorf("error unlinking refund: %w", err)
+			}
+
+		case IssueOrphanStatementMatch:
+			if err := tx.Model(&StatementTransaction{}).Where("transaction_id = ?", issue.ReferenceID).
+				Updates(map[string]interface{}{
+					"receipt_id":       nil,
+					"match_status":     StatementUnmatched,
+					"match_confidence": 0,
+					"reviewed":         false,
+					"updated_at":       time.Now(),
+				}).Error; err != nil {
+				return fmt.Errorf("error unmatching statement transaction: %w", err)
+			}
+
+		case IssueOrphanBudgetAlert:
+			if err := tx.Model(&BudgetAlert{}).Where("alert_id = ?", issue.ReferenceID).
+				Update("receipt_id", nil).Error; err != nil {
+				return fmt.Errorf("error unlinking budget alert: %w", err)
+			}
+
+		default:
+			return fmt.Errorf("unknown issue kind %q", issue.Kind)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,231 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"receipt-mgmt/db"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrExpenseLinked is returned when a change to an expense has to be made on its receipt instead
+var ErrExpenseLinked = errors.New("the expense is linked to a receipt, change or delete the receipt instead")
+
+// ExpenseFilter holds the optional criteria for listing a user's expenses
+type ExpenseFilter struct {
+	CategoryID *uuid.UUID
+	ReceiptID  *uuid.UUID
+	Linked     *bool  // Only expenses with, or without, a receipt
+	From       string // Inclusive YYYY-MM-DD dates
+	To         string
+	MinAmount  *float64
+	MaxAmount  *float64
+	Search     string // Matched against the description
+}
+
+// ReceiptSummary is the part of a receipt embedded in an expense
+type ReceiptSummary struct {
+	ReceiptID       uuid.UUID  `json:"receipt_id"`
+	Merchant        string     `json:"merchant"`
+	MerchantID      *uuid.UUID `json:"merchant_id"`
+	TotalAmount     float64    `json:"total_amount"`
+	Currency        string     `json:"currency"`
+	TransactionDate string     `json:"transaction_date"`
+	Type            string     `json:"type"`
+	Status          string     `json:"status"`
+	PaymentMethod   string     `json:"payment_method"`
+	CardLastFour    string     `json:"card_last_four"`
+	Split           bool       `json:"split"` // The receipt is spread over several expenses
+}
+
+// ExpenseWithReceipt is an expense with its receipt summary, when it has a receipt and it was asked for
+type ExpenseWithReceipt struct {
+	Expense
+	Receipt *ReceiptSummary `json:"receipt,omitempty"`
+}
+
+// GetUserExpenses returns the user's expenses matching the filter, latest first
+func GetUserExpenses(userID uuid.UUID, filter ExpenseFilter) ([]Expense, error) {
+	DB := db.GetDBInstance()
+
+	query := DB.Where("user_id = ?", userID)
+	if filter.CategoryID != nil {
+		query = query.Where("category_id = ?", *filter.CategoryID)
+	}
+	if filter.ReceiptID != nil {
+		query = query.Where("receipt_id = ?", *filter.ReceiptID)
+	}
+	if filter.Linked != nil {
+		if *filter.Linked {
+			query = query.Where("receipt_id IS NOT NULL")
+		} else {
+			query = query.Where("receipt_id IS NULL")
+		}
+	}
+	if filter.From != "" {
+		query = query.Where("date >= ?", filter.From)
+	}
+	if filter.To != "" {
+		// Inclusive of the whole last day
+		query = query.Where("date < (?::date + INTERVAL '1 day')", filter.To)
+	}
+	if filter.MinAmount != nil {
+		query = query.Where("amount >= ?", *filter.MinAmount)
+	}
+	if filter.MaxAmount != nil {
+		query = query.Where("amount <= ?", *filter.MaxAmount)
+	}
+	if filter.Search != "" {
+		query = query.Where("description ILIKE ?", "%"+filter.Search+"%")
+	}
+
+	var expenses []Expense
+	err := query.Order("date DESC, created_at DESC").Find(&expenses).Error
+	return expenses, err
+}
+
+// GetExpenseByID returns one of the user's expenses
+func GetExpenseByID(expenseID, userID uuid.UUID) (*Expense, error) {
+	DB := db.GetDBInstance()
+
+	var expense Expense
+	if err := DB.Where("expense_id = ? AND user_id = ?", expenseID, userID).First(&expense).Error; err != nil {
+		return nil, err
+	}
+	return &expense, nil
+}
+
+// WithReceipts embeds the summary of each expense's receipt
+func WithReceipts(userID uuid.UUID, expenses []Expense) ([]ExpenseWithReceipt, error) {
+	DB := db.GetDBInstance()
+
+	receiptIDs := []uuid.UUID{}
+	for _, expense := range expenses {
+		if expense.ReceiptID != nil {
+			receiptIDs = append(receiptIDs, *expense.ReceiptID)
+		}
+	}
+
+	summaries := map[uuid.UUID]*ReceiptSummary{}
+	if len(receiptIDs) > 0 {
+		receipts, err := receiptSummaries(DB.Where("receipt_id IN ?", receiptIDs), userID)
+		if err != nil {
+			return nil, err
+		}
+		for i := range receipts {
+			summaries[receipts[i].ReceiptID] = &receipts[i]
+		}
+	}
+
+	results := make([]ExpenseWithReceipt, len(expenses))
+	for i, expense := range expenses {
+		results[i] = ExpenseWithReceipt{Expense: expense}
+		if expense.ReceiptID != nil {
+			results[i].Receipt = summaries[*expense.ReceiptID]
+		}
+	}
+	return results, nil
+}
+
+// receiptSummaries loads the summaries of the user's receipts selected by the query
+func receiptSummaries(query *gorm.DB, userID uuid.UUID) ([]ReceiptSummary, error) {
+	var receipts []ReceiptSummary
+	if err := query.Model(&Receipt{}).
+		Select("receipt_id, merchant, merchant_id, total_amount, currency, transaction_date, type, status, payment_method, card_last_four, "+
+			"EXISTS (SELECT 1 FROM receipt_splits WHERE receipt_splits.receipt_id = receipts.receipt_id) AS split").
+		Where("user_id = ?", userID).
+		Scan(&receipts).Error; err != nil {
+		return nil, fmt.Errorf("error loading receipts: %w", err)
+	}
+	return receipts, nil
+}
+
+// ExpenseChanges are the fields to change on an expense; nil fields are left unchanged
+type ExpenseChanges struct {
+	Amount      *float64
+	Date        *time.Time
+	Description *string
+	CategoryID  *uuid.UUID
+}
+
+// UpdateExpense applies the changes to an expense. The amount and date of a receipt's expense come
+// from the receipt and can't be changed here. Its category is changed on the receipt, or on the
+// split it belongs to, so the receipt stays in agreement.
+func UpdateExpense(expense *Expense, changes ExpenseChanges) error {
+	DB := db.GetDBInstance()
+
+	if expense.ReceiptID != nil && (changes.Amount != nil || changes.Date != nil) {
+		return ErrExpenseLinked
+	}
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{"updated_at": time.Now()}
+		if changes.Amount != nil {
+			expense.Amount = roundCents(*changes.Amount)
+			updates["amount"] = expense.Amount
+		}
+		if changes.Date != nil {
+			expense.Date = *changes.Date
+			updates["date"] = expense.Date
+		}
+		if changes.Description != nil {
+			expense.Description = *changes.Description
+			updates["description"] = expense.Description
+		}
+		if changes.CategoryID != nil && *changes.CategoryID != expense.CategoryID {
+			expense.CategoryID = *changes.CategoryID
+			updates["category_id"] = expense.CategoryID
+			if expense.ReceiptID != nil {
+				if err := moveReceiptExpenseCategory(tx, expense); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := tx.Model(&Expense{}).Where("expense_id = ?", expense.ExpenseID).Updates(updates).Error; err != nil {
+			return fmt.Errorf("error updating expense: %w", err)
+		}
+		expense.UpdatedAt = updates["updated_at"].(time.Time)
+		return nil
+	})
+}
+
+// moveReceiptExpenseCategory gives the expense's split, or its whole receipt, the expense's category
+func moveReceiptExpenseCategory(tx *gorm.DB, expense *Expense) error {
+	result := tx.Model(&ReceiptSplit{}).Where("expense_id = ?", expense.ExpenseID).Update("category_id", expense.CategoryID)
+	if result.Error != nil {
+		return fmt.Errorf("error updating receipt split: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+
+	var receipt Receipt
+	if err := tx.Omit("image").Where("receipt_id = ?", *expense.ReceiptID).First(&receipt).Error; err != nil {
+		return fmt.Errorf("error loading receipt: %w", err)
+	}
+	previousCategoryID := receipt.CategoryID
+	receipt.CategoryID = expense.CategoryID
+	if err := tx.Model(&Receipt{}).Where("receipt_id = ?", receipt.ReceiptID).Updates(map[string]interface{}{
+		"category_id":        receipt.CategoryID,
+		"category_suggested": false,
+	}).Error; err != nil {
+		return fmt.Errorf("error updating receipt category: %w", err)
+	}
+	return LearnCategoryChange(tx, &receipt, previousCategoryID)
+}
+
+// DeleteExpense deletes one of the user's expenses that isn't linked to a receipt
+func DeleteExpense(expense *Expense) error {
+	DB := db.GetDBInstance()
+
+	if expense.ReceiptID != nil {
+		return ErrExpenseLinked
+	}
+	if err := DB.Delete(expense).Error; err != nil {
+		return fmt.Errorf("error deleting expense: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"receipt-mgmt/db"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// ExpenseMatchWindowDays is how many days a manual expense may be logged before or after the receipt date
+	ExpenseMatchWindowDays = 7
+	// ExpenseMatchMinTolerance is the smallest amount difference accepted, for tips and rounding
+	ExpenseMatchMinTolerance = 1.00
+	// ExpenseMatchTolerancePercent widens the amount tolerance for larger amounts
+	ExpenseMatchTolerancePercent = 0.02
+	// ExpenseAutoLinkConfidence is the confidence above which an upload links the expense without asking,
+	// provided its description mentions the merchant
+	ExpenseAutoLinkConfidence = 0.85
+)
+
+// Evidence weights of an expense match
+const (
+	expenseMatchAmountWeight      = 0.6
+	expenseMatchDateWeight        = 0.3
+	expenseMatchDescriptionWeight = 0.1
+)
+
+// ExpenseMatchCandidate is an unlinked expense that may have been logged by hand for a receipt
+type ExpenseMatchCandidate struct {
+	Expense          Expense `json:"expense"`
+	Confidence       float64 `json:"confidence"`        // Between 0 and 1
+	AmountDifference float64 `json:"amount_difference"` // Expense amount minus the receipt's
+	DaysApart        int     `json:"days_apart"`
+	MerchantMatch    bool    `json:"merchant_match"` // The expense description mentions the receipt's merchant
+}
+
+// FindExpenseMatches returns the user's expenses without a receipt whose amount and date are
+// close to the receipt's, best match first
+func FindExpenseMatches(tx *gorm.DB, receipt *Receipt) ([]ExpenseMatchCandidate, error) {
+	amount := receipt.ExpenseAmount()
+	tolerance := math.Max(ExpenseMatchMinTolerance, math.Abs(amount)*ExpenseMatchTolerancePercent)
+	date := receipt.expenseDate()
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+	window := time.Duration(ExpenseMatchWindowDays) * 24 * time.Hour
+
+	var expenses []Expense
+	err := tx.Where("user_id = ? AND receipt_id IS NULL", receipt.UserID).
+		Where("amount BETWEEN ? AND ?", amount-tolerance, amount+tolerance).
+		Where("date >= ? AND date < ?", day.Add(-window), day.Add(window+24*time.Hour)).
+		Find(&expenses).Error
+	if err != nil {
+		return nil, fmt.Errorf("error looking up expenses: %w", err)
+	}
+
+	merchantWords := strings.Fields(normalizeKeywordText(receipt.Merchant))
+	candidates := make([]ExpenseMatchCandidate, 0, len(expenses))
+	for _, expense := range expenses {
+		difference := roundCents(expense.Amount - amount)
+		expenseDay := time.Date(expense.Date.Year(), expense.Date.Month(), expense.Date.Day(), 0, 0, 0, 0, day.Location())
+		daysApart := int(math.Abs(math.Round(expenseDay.Sub(day).Hours() / 24)))
+
+		confidence := expenseMatchAmountWeight*(1-math.Abs(difference)/tolerance) +
+			expenseMatchDateWeight*(1-float64(daysApart)/float64(ExpenseMatchWindowDays+1))
+		description := " " + normalizeKeywordText(expense.Description) + " "
+		merchantMatch := false
+		for _, word := range merchantWords {
+			if len(word) > 2 && strings.Contains(description, " "+word+" ") {
+				confidence += expenseMatchDescriptionWeight
+				merchantMatch = true
+				break
+			}
+		}
+
+		candidates = append(candidates, ExpenseMatchCandidate{
+			Expense:          expense,
+			Confidence:       roundConfidence(math.Max(0, confidence)),
+			AmountDifference: difference,
+			DaysApart:        daysApart,
+			MerchantMatch:    merchantMatch,
+		})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Confidence > candidates[j].Confidence
+	})
+	return candidates, nil
+}
+
+// AutoLinkCandidate returns the candidate to link without asking: the best one, when it is above
+// the threshold, clearly ahead of the next one and mentions the merchant. The amount and date
+// alone can reach the threshold, but any same-day purchase of the same amount would then be
+// linked.
+func AutoLinkCandidate(candidates []ExpenseMatchCandidate) *ExpenseMatchCandidate {
+	if len(candidates) == 0 || candidates[0].Confidence < ExpenseAutoLinkConfidence || !candidates[0].MerchantMatch {
+		return nil
+	}
+	if len(candidates) > 1 && candidates[1].Confidence >= ExpenseAutoLinkConfidence {
+		// Two expenses fit equally well, let the user pick
+		return nil
+	}
+	return &candidates[0]
+}
+
+// LinkReceiptExpense links a manual expense to the receipt in place of the expense created from
+// it. The expense takes the receipt's amount and keeps its description. A suggested receipt
+// category gives way to the category the user chose for the expense; otherwise the expense
+// moves to the receipt's category.
+func LinkReceiptExpense(receipt *Receipt, expenseID uuid.UUID) (*Expense, error) {
+	DB := db.GetDBInstance()
+
+	var expense *Expense
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		expense, err = linkReceiptExpense(tx, receipt, expenseID)
+		return err
+	})
+	return expense, err
+}
+
+// linkReceiptExpense links the expense to the receipt within the given transaction
+func linkReceiptExpense(tx *gorm.DB, receipt *Receipt, expenseID uuid.UUID) (*Expense, error) {
+	var splits int64
+	if err := tx.Model(&ReceiptSplit{}).Where("receipt_id = ?", receipt.ReceiptID).Count(&splits).Error; err != nil {
+		return nil, fmt.Errorf("error checking receipt splits: %w", err)
+	}
+	if splits > 0 {
+		return nil, errors.New("a split receipt can't be linked to a single expense, remove the split first")
+	}
+
+	var expense Expense
+	if err := tx.Where("expense_id = ? AND user_id = ?", expenseID, receipt.UserID).First(&expense).Error; err != nil {
+		return nil, fmt.Errorf("expense not found: %w", err)
+	}
+	if expense.ReceiptID != nil {
+		if *expense.ReceiptID == receipt.ReceiptID {
+			return &expense, nil
+		}
+		return nil, errors.New("the expense is already linked to another receipt")
+	}
+
+	if receipt.CategorySuggested {
+		receipt.CategoryID = expense.CategoryID
+		receipt.CategorySuggested = false
+		if err := tx.Model(&Receipt{}).Where("receipt_id = ?", receipt.ReceiptID).Updates(map[string]interface{}{
+			"category_id":        receipt.CategoryID,
+			"category_suggested": false,
+		}).Error; err != nil {
+			return nil, fmt.Errorf("error updating receipt category: %w", err)
+		}
+		if receipt.MerchantID != nil {
+			if err := LearnCategoryChoice(tx, receipt.UserID, *receipt.MerchantID, receipt.CategoryID, 1); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// The expense created from the receipt would now be a duplicate
+	if err := tx.Where("receipt_id = ? AND expense_id <> ?", receipt.ReceiptID, expense.ExpenseID).
+		Delete(&Expense{}).Error; err != nil {
+		return nil, fmt.Errorf("error deleting duplicate expense: %w", err)
+	}
+
+	expense.ReceiptID = &receipt.ReceiptID
+	expense.CategoryID = receipt.CategoryID
+	expense.Amount = receipt.ExpenseAmount()
+	expense.UpdatedAt = time.Now()
+	if err := tx.Model(&Expense{}).Where("expense_id = ?", expense.ExpenseID).Updates(map[string]interface{}{
+		"receipt_id":  expense.ReceiptID,
+		"category_id": expense.CategoryID,
+		"amount":      expense.Amount,
+		"updated_at":  expense.UpdatedAt,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("error linking expense: %w", err)
+	}
+	return &expense, nil
+}
@@ -0,0 +1,29 @@
+package models
+
+import "testing"
+
+func TestAutoLinkCandidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		candidates []ExpenseMatchCandidate
+		want       int // Index of the linked candidate, -1 for none
+	}{
+		{"no candidates", nil, -1},
+		{"merchant mentioned", []ExpenseMatchCandidate{{Confidence: 1, MerchantMatch: true}, {Confidence: 0.5}}, 0},
+		{"same amount and day only", []ExpenseMatchCandidate{{Confidence: 0.9}}, -1},
+		{"below the threshold", []ExpenseMatchCandidate{{Confidence: 0.8, MerchantMatch: true}}, -1},
+		{"two close candidates", []ExpenseMatchCandidate{{Confidence: 0.95, MerchantMatch: true}, {Confidence: 0.9}}, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := AutoLinkCandidate(tt.candidates)
+			switch {
+			case tt.want < 0 && got != nil:
+				t.Errorf("AutoLinkCandidate() = %+v; want nil", got)
+			case tt.want >= 0 && got != &tt.candidates[tt.want]:
+				t.Errorf("AutoLinkCandidate() = %+v; want candidate %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,391 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"receipt-mgmt/db"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Price bases: per kilogram or litre when every purchase has a size, per item otherwise
+const (
+	PricePerKg   = "per_kg"
+	PricePerL    = "per_l"
+	PricePerItem = "per_item"
+)
+
+var (
+	// A size printed in an item name, e.g. "4L", "500 G", "12 X 355ML" or "1,5 KG"
+	itemSizePattern = regexp.MustCompile(`(?:^|[^A-Z0-9.,])(?:(\d+)\s*[X×]\s*)?(\d+(?:[.,]\d+)?)\s*(KG|GR|G|LBS|LB|OZ|ML|CL|L)\b`)
+	// A per-weight price of a weighed item, e.g. "@ $1.74/KG", which makes the size the weight sold
+	itemWeighedPattern = regexp.MustCompile(`@\s*\$?\s*\d+(?:[.,]\d+)?\s*\$?\s*/\s*(?:KG|LB|100\s*G)\b.*$`)
+	itemPricePattern   = regexp.MustCompile(`\$\s*\d+(?:[.,]\d+)?|\b\d+[.,]\d{2}\b`)
+	itemPunctuation    = regexp.MustCompile(`[^A-Z0-9% ]+`)
+	itemCodePattern    = regexp.MustCompile(`^\d{4,}$`)
+)
+
+// Size units, with the factor to kilograms or litres
+var itemSizeUnits = map[string]struct {
+	unit   string
+	factor float64
+}{
+	"KG": {"kg", 1}, "G": {"kg", 0.001}, "GR": {"kg", 0.001},
+	"LB": {"kg", 0.45359237}, "LBS": {"kg", 0.45359237}, "OZ": {"kg", 0.028349523125},
+	"L": {"L", 1}, "ML": {"L", 0.001}, "CL": {"L", 0.01},
+}
+
+// itemNoiseWords are dropped when normalizing an item name
+var itemNoiseWords = map[string]bool{"EA": true, "EACH": true, "CH": true, "UN": true, "UNIT": true, "PK": true, "PACK": true}
+
+// ItemSize is the package size or weight printed in an item name, in kilograms or litres
+type ItemSize struct {
+	Amount  float64
+	Unit    string // kg or L
+	Weighed bool   // The size is the weight sold, not the size of one package
+}
+
+// ParseItemSize reads the size printed in an item name, reporting false when there is none
+func ParseItemSize(name string) (ItemSize, bool) {
+	upper := strings.ToUpper(stripAccents(name))
+	match := itemSizePattern.FindStringSubmatch(upper)
+	if match == nil {
+		return ItemSize{}, false
+	}
+
+	amount, err := strconv.ParseFloat(strings.Replace(match[2], ",", ".", 1), 64)
+	if err != nil || amount <= 0 {
+		return ItemSize{}, false
+	}
+	if match[1] != "" {
+		if count, err := strconv.Atoi(match[1]); err == nil && count > 0 {
+			amount *= float64(count)
+		}
+	}
+	unit := itemSizeUnits[match[3]]
+	return ItemSize{
+		Amount:  amount * unit.factor,
+		Unit:    unit.unit,
+		Weighed: itemWeighedPattern.MatchString(upper),
+	}, true
+}
+
+// NormalizeItemName reduces an item name to the words naming the product, so the same product
+// matches across receipts and stores: sizes, prices, codes and tax flags are dropped.
+func NormalizeItemName(name string) string {
+	upper := strings.ToUpper(stripAccents(name))
+	upper = itemWeighedPattern.ReplaceAllString(upper, " ")
+	upper = itemSizePattern.ReplaceAllString(upper, " ")
+	upper = itemPricePattern.ReplaceAllString(upper, " ")
+	upper = itemPunctuation.ReplaceAllString(upper, " ")
+
+	words := []string{}
+	for _, word := range strings.Fields(upper) {
+		if len(word) > 1 && !itemNoiseWords[word] && !itemCodePattern.MatchString(word) {
+			words = append(words, word)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// IndexItemNames fills in the normalized name of the items saved before it was stored
+func IndexItemNames() error {
+	DB := db.GetDBInstance()
+
+	var items []ReceiptItem
+	err := DB.Select("item_id, name").Where("normalized_name IS NULL").
+		FindInBatches(&items, 500, func(tx *gorm.DB, batch int) error {
+			for _, item := range items {
+				if err := tx.Model(&ReceiptItem{}).Where("item_id = ?", item.ItemID).
+					Update("normalized_name", NormalizeItemName(item.Name)).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return fmt.Errorf("error normalizing item names: %w", err)
+	}
+	return nil
+}
+
+// ItemPriceQuery identifies an item by name, product code or one of its line items, and the
+// period and currency to report its prices in
+type ItemPriceQuery struct {
+	Name        string
+	ProductCode string
+	ItemID      *uuid.UUID // Matches the item's product code or normalized name
+	From        string     // Inclusive YYYY-MM-DD transaction dates
+	To          string
+	Currency    string
+}
+
+// ItemPricePoint is one purchase of the item
+type ItemPricePoint struct {
+	ItemID          uuid.UUID  `json:"item_id"`
+	ReceiptID       uuid.UUID  `json:"receipt_id"`
+	Name            string     `json:"name"`
+	ProductCode     string     `json:"product_code,omitempty"`
+	TransactionDate string     `json:"transaction_date"`
+	MerchantID      *uuid.UUID `json:"merchant_id"`
+	Merchant        string     `json:"merchant"`
+	Quantity        float64    `json:"quantity"`
+	TotalPrice      float64    `json:"total_price"` // In the requested currency, discount deducted
+	Price           float64    `json:"price"`       // Paid per item
+	Size            float64    `json:"size,omitempty"`
+	SizeUnit        string     `json:"size_unit,omitempty"`      // kg or L
+	PricePerUnit    float64    `json:"price_per_unit,omitempty"` // Paid per kg or L
+	merchantKey     string     // Groups the purchases by merchant, see merchantGroup
+}
+
+// ItemPriceStats summarizes the prices of the item on the basis of the report
+type ItemPriceStats struct {
+	Min           float64  `json:"min"`
+	Max           float64  `json:"max"`
+	Average       float64  `json:"average"`
+	First         float64  `json:"first"`
+	Last          float64  `json:"last"`
+	Change        float64  `json:"change"`
+	ChangePercent *float64 `json:"change_percent"`
+}
+
+// ItemPriceHistory is the price of an item over time, oldest purchase first
+type ItemPriceHistory struct {
+	NormalizedName string           `json:"normalized_name"`
+	ProductCode    string           `json:"product_code,omitempty"`
+	Currency       string           `json:"currency"`
+	Basis          string           `json:"basis"` // per_kg, per_l or per_item
+	Points         []ItemPricePoint `json:"points"`
+	Stats          *ItemPriceStats  `json:"stats"` // Nil without purchases
+}
+
+// MerchantItemPrice is the price of the item at one merchant
+type MerchantItemPrice struct {
+	MerchantID   *uuid.UUID `json:"merchant_id"`
+	Merchant     string     `json:"merchant"`
+	Purchases    int        `json:"purchases"`
+	LatestPrice  float64    `json:"latest_price"`
+	LatestDate   string     `json:"latest_date"`
+	MinPrice     float64    `json:"min_price"`
+	AveragePrice float64    `json:"average_price"`
+	AboveLowest  float64    `json:"above_lowest"` // Latest price above the cheapest merchant's latest price
+}
+
+// ItemPriceComparison compares the item's price across merchants, cheapest latest price first
+type ItemPriceComparison struct {
+	NormalizedName string              `json:"normalized_name"`
+	ProductCode    string              `json:"product_code,omitempty"`
+	Currency       string              `json:"currency"`
+	Basis          string              `json:"basis"`
+	Merchants      []MerchantItemPrice `json:"merchants"`
+}
+
+// GetItemPriceHistory returns the user's purchases of the item with their prices
+func GetItemPriceHistory(userID uuid.UUID, query ItemPriceQuery) (*ItemPriceHistory, error) {
+	name, code, points, err := findItemPricePoints(userID, query)
+	if err != nil {
+		return nil, err
+	}
+
+	basis := itemPriceBasis(points)
+	history := &ItemPriceHistory{NormalizedName: name, ProductCode: code, Currency: query.Currency, Basis: basis, Points: points}
+	if len(points) == 0 {
+		return history, nil
+	}
+
+	stats := &ItemPriceStats{Min: math.MaxFloat64}
+	for _, point := range points {
+		price := point.priceOn(basis)
+		stats.Min = math.Min(stats.Min, price)
+		stats.Max = math.Max(stats.Max, price)
+		stats.Average += price
+	}
+	stats.Average = roundCents(stats.Average / float64(len(points)))
+	stats.First = points[0].priceOn(basis)
+	stats.Last = points[len(points)-1].priceOn(basis)
+	stats.Change = roundCents(stats.Last - stats.First)
+	stats.ChangePercent = percentChange(stats.Last, stats.First)
+	history.Stats = stats
+	return history, nil
+}
+
+// CompareItemPrices returns the item's prices at each merchant it was bought from
+func CompareItemPrices(userID uuid.UUID, query ItemPriceQuery) (*ItemPriceComparison, error) {
+	name, code, points, err := findItemPricePoints(userID, query)
+	if err != nil {
+		return nil, err
+	}
+
+	basis := itemPriceBasis(points)
+	comparison := &ItemPriceComparison{NormalizedName: name, ProductCode: code, Currency: query.Currency, Basis: basis,
+		Merchants: []MerchantItemPrice{}}
+
+	byMerchant := map[string]*MerchantItemPrice{}
+	order := []string{}
+	for _, point := range points {
+		key := point.merchantKey
+		merchant := byMerchant[key]
+		if merchant == nil {
+			merchant = &MerchantItemPrice{MerchantID: point.MerchantID, Merchant: point.Merchant, MinPrice: math.MaxFloat64}
+			byMerchant[key] = merchant
+			order = append(order, key)
+		}
+
+		// Points are oldest first, so the last one seen is the latest
+		price := point.priceOn(basis)
+		merchant.Purchases++
+		merchant.LatestPrice, merchant.LatestDate = price, point.TransactionDate
+		merchant.MinPrice = math.Min(merchant.MinPrice, price)
+		merchant.AveragePrice += price
+	}
+
+	for _, key := range order {
+		merchant := byMerchant[key]
+		merchant.AveragePrice = roundCents(merchant.AveragePrice / float64(merchant.Purchases))
+		comparison.Merchants = append(comparison.Merchants, *merchant)
+	}
+	sort.SliceStable(comparison.Merchants, func(i, j int) bool {
+		return comparison.Merchants[i].LatestPrice < comparison.Merchants[j].LatestPrice
+	})
+	for i := range comparison.Merchants {
+		comparison.Merchants[i].AboveLowest = roundCents(comparison.Merchants[i].LatestPrice - comparison.Merchants[0].LatestPrice)
+	}
+	return comparison, nil
+}
+
+// findItemPricePoints resolves the item's identity and loads its purchases, oldest first. Items
+// from refunds and from receipts without an exchange rate to the currency are left out.
+func findItemPricePoints(userID uuid.UUID, query ItemPriceQuery) (string, string, []ItemPricePoint, error) {
+	DB := db.GetDBInstance()
+
+	name, code := NormalizeItemName(query.Name), strings.TrimSpace(query.ProductCode)
+	if query.ItemID != nil {
+		var item ReceiptItem
+		if err := DB.Where("item_id = ? AND user_id = ?", *query.ItemID, userID).First(&item).Error; err != nil {
+			return "", "", nil, err
+		}
+		name, code = NormalizeItemName(item.Name), item.ProductCode
+	}
+
+	var rows []struct {
+		ItemID            uuid.UUID
+		ReceiptID         uuid.UUID
+		Name              string
+		ProductCode       string
+		Quantity          float64
+		TotalPrice        float64
+		TransactionDate   string
+		MerchantID        *uuid.UUID
+		Merchant          string
+		CanonicalName     *string
+		Currency          string
+		ConvertedCurrency string
+		ExchangeRate      float64
+	}
+	rowsQuery := DB.Table("receipt_items").
+		Select("receipt_items.item_id, receipt_items.receipt_id, receipt_items.name, receipt_items.product_code, "+
+			"receipt_items.quantity, receipt_items.total_price, receipts.transaction_date, receipts.merchant_id, "+
+			"receipts.merchant, merchants.canonical_name, receipts.currency, receipts.converted_currency, receipts.exchange_rate").
+		Joins("JOIN receipts ON receipts.receipt_id = receipt_items.receipt_id AND receipts.deleted_at IS NULL").
+		Joins("LEFT JOIN merchants ON merchants.merchant_id = receipts.merchant_id").
+		Where("receipt_items.user_id = ? AND receipts.type = ? AND receipt_items.total_price > 0", userID, ReceiptTypePurchase)
+	switch {
+	case code != "" && name != "":
+		rowsQuery = rowsQuery.Where("receipt_items.product_code = ? OR receipt_items.normalized_name = ?", code, name)
+	case code != "":
+		rowsQuery = rowsQuery.Where("receipt_items.product_code = ?", code)
+	case name != "":
+		rowsQuery = rowsQuery.Where("receipt_items.normalized_name = ?", name)
+	default:
+		return name, code, []ItemPricePoint{}, nil
+	}
+	if query.From != "" {
+		rowsQuery = rowsQuery.Where("receipts.transaction_date >= ?", query.From)
+	}
+	if query.To != "" {
+		rowsQuery = rowsQuery.Where("receipts.transaction_date <= ?", query.To)
+	}
+	if err := rowsQuery.Order("receipts.transaction_date ASC, receipts.transaction_time ASC, receipt_items.line_number ASC").
+		Scan(&rows).Error; err != nil {
+		return "", "", nil, fmt.Errorf("error loading item prices: %w", err)
+	}
+
+	// Receipts saved before currencies were detected are in the user's currency
+	userCurrency, err := GetUserCurrency(userID)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("error loading user currency: %w", err)
+	}
+
+	points := []ItemPricePoint{}
+	converter := newCurrencyConverter(query.Currency)
+	for _, row := range rows {
+		if row.Currency == "" {
+			row.Currency = userCurrency
+		}
+		rate, ok := converter.rate(row.Currency, row.ConvertedCurrency, row.ExchangeRate, row.TransactionDate)
+		if !ok {
+			continue
+		}
+		quantity := row.Quantity
+		if quantity <= 0 {
+			quantity = 1
+		}
+
+		point := ItemPricePoint{
+			ItemID:          row.ItemID,
+			ReceiptID:       row.ReceiptID,
+			Name:            row.Name,
+			ProductCode:     row.ProductCode,
+			TransactionDate: row.TransactionDate,
+			MerchantID:      row.MerchantID,
+			Quantity:        row.Quantity,
+			TotalPrice:      roundCents(row.TotalPrice * rate),
+			Price:           roundCents(row.TotalPrice * rate / quantity),
+		}
+		point.merchantKey, point.Merchant, _ = merchantGroup(row.MerchantID, row.CanonicalName, row.Merchant)
+		if size, ok := ParseItemSize(row.Name); ok {
+			// A fractional quantity is a weight, already the amount sold
+			measure := size.Amount
+			if !size.Weighed && quantity == math.Trunc(quantity) {
+				measure *= quantity
+			}
+			point.Size, point.SizeUnit = roundUnitPrice(size.Amount), size.Unit
+			point.PricePerUnit = roundUnitPrice(row.TotalPrice * rate / measure)
+		}
+		points = append(points, point)
+	}
+	return name, code, points, nil
+}
+
+// itemPriceBasis compares per kg or L when every purchase has a size of the same kind, per item otherwise
+func itemPriceBasis(points []ItemPricePoint) string {
+	if len(points) == 0 || points[0].SizeUnit == "" {
+		return PricePerItem
+	}
+	for _, point := range points {
+		if point.SizeUnit != points[0].SizeUnit {
+			return PricePerItem
+		}
+	}
+	if points[0].SizeUnit == "L" {
+		return PricePerL
+	}
+	return PricePerKg
+}
+
+func (p *ItemPricePoint) priceOn(basis string) float64 {
+	if basis == PricePerItem {
+		return p.Price
+	}
+	return p.PricePerUnit
+}
+
+// roundUnitPrice keeps four decimals, enough for the price per kg of a few grams
+func roundUnitPrice(amount float64) float64 {
+	return math.Round(amount*10000) / 10000
+}
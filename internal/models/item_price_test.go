@@ -0,0 +1,85 @@
+package models
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestParseItemSize(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   ItemSize
+		wantOK bool
+	}{
+		{"MILK 2% 4L", ItemSize{Amount: 4, Unit: "L"}, true},
+		{"YOGOURT 500 G", ItemSize{Amount: 0.5, Unit: "kg"}, true},
+		{"COKE 12 X 355ML", ItemSize{Amount: 4.26, Unit: "L"}, true},
+		{"FARINE 2,5 KG", ItemSize{Amount: 2.5, Unit: "kg"}, true},
+		{"CAFÉ MOULU 1 KG", ItemSize{Amount: 1, Unit: "kg"}, true},
+		{"BANANAS 1.23 KG @ $1.74/KG", ItemSize{Amount: 1.23, Unit: "kg", Weighed: true}, true},
+		{"GROUND BEEF 2 LB", ItemSize{Amount: 0.90718474, Unit: "kg"}, true},
+		{"WINE 75 CL", ItemSize{Amount: 0.75, Unit: "L"}, true},
+		{"PAINT ROLLER", ItemSize{}, false},
+		{"LADDER 6FT", ItemSize{}, false},
+		{"BOTTLE 0 L", ItemSize{}, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := ParseItemSize(tt.name)
+		if ok != tt.wantOK || got.Unit != tt.want.Unit || got.Weighed != tt.want.Weighed || math.Abs(got.Amount-tt.want.Amount) > 1e-9 {
+			t.Errorf("ParseItemSize(%q) = %+v, %v; want %+v, %v", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestNormalizeItemName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"MILK 2% 4L", "MILK 2%"},
+		{"Milk 2% 1 L H", "MILK 2%"},
+		{"BANANAS 1.23 KG @ $1.74/KG", "BANANAS"},
+		{"CAFÉ MOULU 1 KG", "CAFE MOULU"},
+		{"064420000125 BREAD EA 3.49", "BREAD"},
+		{"COKE 12 X 355ML", "COKE"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeItemName(tt.name); got != tt.want {
+			t.Errorf("NormalizeItemName(%q) = %q; want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMerchantGroup(t *testing.T) {
+	merchantID := uuid.New()
+	canonical := "Costco"
+
+	tests := []struct {
+		name          string
+		merchantID    *uuid.UUID
+		canonicalName *string
+		printed       string
+		wantKey       string
+		wantName      string
+		wantOK        bool
+	}{
+		{"resolved merchant", &merchantID, &canonical, "COSTCO WHOLESALE #503", "merchant:" + merchantID.String(), "Costco", true},
+		{"merchant without a canonical name", &merchantID, nil, " Costco Wholesale #503 ", "name:COSTCO WHOLESALE", "Costco Wholesale #503", true},
+		{"unresolved name", nil, nil, "Tim Hortons #0412", "name:TIM HORTONS", "Tim Hortons #0412", true},
+		{"name without words", nil, nil, "#0412", "name:", "#0412", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, name, ok := merchantGroup(tt.merchantID, tt.canonicalName, tt.printed)
+			if key != tt.wantKey || name != tt.wantName || ok != tt.wantOK {
+				t.Errorf("merchantGroup() = %q, %q, %v; want %q, %q, %v", key, name, ok, tt.wantKey, tt.wantName, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"receipt-mgmt/db"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Merchant is the canonical entry for a store or chain that receipts resolve to
+type Merchant struct {
+	MerchantID     uuid.UUID `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"merchant_id"`
+	CanonicalName  string    `gorm:"type:varchar(255);not null" json:"canonical_name"`
+	NormalizedName string    `gorm:"type:varchar(255);not null;uniqueIndex" json:"normalized_name"`
+	CreatedAt      time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// MerchantAlias maps a normalized merchant name, or a pattern, to a merchant.
+// Aliases without a user apply to everyone; user aliases override them for that user.
+type MerchantAlias struct {
+	AliasID    uuid.UUID  `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"alias_id"`
+	MerchantID uuid.UUID  `gorm:"type:uuid;not null;index" json:"merchant_id"`
+	UserID     *uuid.UUID `gorm:"type:uuid;index" json:"user_id,omitempty"`  // Nullable for global aliases
+	Pattern    string     `gorm:"type:varchar(255);not null" json:"pattern"` // Normalized name, or a regular expression when IsRegex
+	IsRegex    bool       `gorm:"default:false" json:"is_regex"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// MerchantSummary is a merchant together with how many of the user's receipts resolve to it
+type MerchantSummary struct {
+	MerchantID    uuid.UUID `json:"merchant_id"`
+	CanonicalName string    `json:"canonical_name"`
+	ReceiptCount  int       `json:"receipt_count"`
+}
+
+var (
+	merchantStoreNumber = regexp.MustCompile(`(?:#\s*|\b(?:STORE|STR|NO\.?|MAGASIN)\s*#?\s*)\d+\b`)
+	merchantJoiners     = regexp.MustCompile(`['’.\-]`)
+	merchantPunctuation = regexp.MustCompile(`[^A-Z0-9& ]+`)
+	merchantDigitsOnly  = regexp.MustCompile(`\b\d+\b`)
+)
+
+// merchantSuffixes are legal forms and store formats dropped from the end of a merchant name
+var merchantSuffixes = map[string]bool{
+	"INC": true, "INCORPORATED": true, "LTD": true, "LIMITED": true, "LLC": true,
+	"CORP": true, "CORPORATION": true, "COMPANY": true, "SUPERCENTRE": true, "SUPERCENTER": true,
+}
+
+// merchantBranchSuffixes are also dropped from the end, but only when at least two words remain:
+// they are often part of the name itself, as in "Canada Post" or "Dollar Store"
+var merchantBranchSuffixes = map[string]bool{
+	"CO": true, "CANADA": true, "CDA": true, "STORE": true, "STORES": true,
+}
+
+// NormalizeMerchantName reduces a printed merchant name to the key used for matching,
+// e.g. "WAL-MART #1234" and "Walmart Supercentre" both become "WALMART". Only a leading "THE"
+// and trailing suffixes are dropped, never the words that tell two merchants apart.
+func NormalizeMerchantName(name string) string {
+	upper := strings.ToUpper(stripAccents(name))
+	upper = merchantStoreNumber.ReplaceAllString(upper, " ")
+	upper = merchantJoiners.ReplaceAllString(upper, "")
+	upper = strings.ReplaceAll(upper, "&", " AND ")
+	upper = merchantPunctuation.ReplaceAllString(upper, " ")
+	upper = merchantDigitsOnly.ReplaceAllString(upper, " ")
+
+	words := strings.Fields(upper)
+	if len(words) > 2 && words[0] == "THE" {
+		words = words[1:]
+	}
+	for len(words) > 1 {
+		last := words[len(words)-1]
+		if !merchantSuffixes[last] && !(merchantBranchSuffixes[last] && len(words) > 2) {
+			break
+		}
+		words = words[:len(words)-1]
+	}
+	return strings.Join(words, " ")
+}
+
+// merchantGroup returns the key and name purchases are grouped under when reporting by merchant:
+// the canonical merchant when the printed name was resolved to one, the normalized printed name
+// otherwise. It reports false when there is neither, a name that normalizes to nothing.
+func merchantGroup(merchantID *uuid.UUID, canonicalName *string, printedName string) (string, string, bool) {
+	if merchantID != nil && canonicalName != nil {
+		return "merchant:" + merchantID.String(), *canonicalName, true
+	}
+	name := strings.TrimSpace(printedName)
+	normalized := NormalizeMerchantName(name)
+	return "name:" + normalized, name, normalized != ""
+}
+
+// canonicalDisplayName turns a normalized name into a readable one, e.g. "WALMART" into "Walmart"
+func canonicalDisplayName(normalized string) string {
+	words := strings.Fields(strings.ToLower(normalized))
+	for i, word := range words {
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		words[i] = string(runes)
+	}
+	return strings.Join(words, " ")
+}
+
+// stripAccents replaces accented letters with their plain equivalent
+func stripAccents(text string) string {
+	replacer := strings.NewReplacer(
+		"é", "e", "è", "e", "ê", "e", "ë", "e", "É", "E", "È", "E", "Ê", "E",
+		"à", "a", "â", "a", "À", "A", "Â", "A", "ç", "c", "Ç", "C",
+		"î", "i", "ï", "i", "Î", "I", "ô", "o", "Ô", "O", "ù", "u", "û", "u", "Ù", "U", "Û", "U",
+	)
+	return replacer.Replace(text)
+}
+
+// ResolveMerchant finds the canonical merchant for a printed merchant name, checking the
+// user's aliases first, then global aliases and names, and creating the merchant when new
+func ResolveMerchant(tx *gorm.DB, userID uuid.UUID, name string) (*Merchant, error) {
+	normalized := NormalizeMerchantName(name)
+	if normalized == "" || normalized == "UNKNOWN" {
+		return nil, nil
+	}
+
+	// Exact alias matches, with the user's own aliases taking precedence
+	var alias MerchantAlias
+	err := tx.Where("pattern = ? AND is_regex = false AND (user_id = ? OR user_id IS NULL)", normalized, userID).
+		Order("user_id IS NULL").First(&alias).Error
+	if err == nil {
+		return GetMerchantByID(tx, alias.MerchantID)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("error looking up merchant alias: %w", err)
+	}
+
+	// Pattern aliases, again user first
+	var patterns []MerchantAlias
+	if err := tx.Where("is_regex = true AND (user_id = ? OR user_id IS NULL)", userID).
+		Order("user_id IS NULL, created_at ASC").Find(&patterns).Error; err != nil {
+		return nil, fmt.Errorf("error loading merchant patterns: %w", err)
+	}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile("(?i)" + pattern.Pattern)
+		if err != nil {
+			continue
+		}
+		if re.MatchString(normalized) {
+			return GetMerchantByID(tx, pattern.MerchantID)
+		}
+	}
+
+	// Fall back to the merchant with the same normalized name, creating it when new
+	merchant := Merchant{
+		MerchantID:     uuid.New(),
+		CanonicalName:  canonicalDisplayName(normalized),
+		NormalizedName: normalized,
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&merchant).Error; err != nil {
+		return nil, fmt.Errorf("error creating merchant: %w", err)
+	}
+	if err := tx.Where("normalized_name = ?", normalized).First(&merchant).Error; err != nil {
+		return nil, fmt.Errorf("error loading merchant: %w", err)
+	}
+	return &merchant, nil
+}
+
+// GetMerchantByID returns a merchant by its ID
+func GetMerchantByID(tx *gorm.DB, merchantID uuid.UUID) (*Merchant, error) {
+	var merchant Merchant
+	if err := tx.Where("merchant_id = ?", merchantID).First(&merchant).Error; err != nil {
+		return nil, err
+	}
+	return &merchant, nil
+}
+
+// GetMerchantAliases returns the global aliases of a merchant and the user's own
+func GetMerchantAliases(merchantID, userID uuid.UUID) ([]MerchantAlias, error) {
+	DB := db.GetDBInstance()
+
+	var aliases []MerchantAlias
+	err := DB.Where("merchant_id = ? AND (user_id = ? OR user_id IS NULL)", merchantID, userID).
+		Order("created_at ASC").Find(&aliases).Error
+	return aliases, err
+}
+
+// GetUserMerchants lists the merchants the user's receipts resolve to
+func GetUserMerchants(userID uuid.UUID, search string) ([]MerchantSummary, error) {
+	DB := db.GetDBInstance()
+
+	query := DB.Table("merchants").
+		Select("merchants.merchant_id, merchants.canonical_name, COUNT(receipts.receipt_id) AS receipt_count").
+		Joins("JOIN receipts ON receipts.merchant_id = merchants.merchant_id AND receipts.deleted_at IS NULL").
+		Where("receipts.user_id = ?", userID)
+	if search != "" {
+		query = query.Where("merchants.canonical_name ILIKE ?", "%"+search+"%")
+	}
+
+	var merchants []MerchantSummary
+	err := query.Group("merchants.merchant_id, merchants.canonical_name").
+		Order("receipt_count DESC").Scan(&merchants).Error
+	return merchants, err
+}
+
+// AddUserAlias maps a name or pattern to a merchant for the given user only,
+// replacing any alias the user already had for it
+func AddUserAlias(tx *gorm.DB, userID, merchantID uuid.UUID, pattern string, isRegex bool) (*MerchantAlias, error) {
+	if !isRegex {
+		pattern = NormalizeMerchantName(pattern)
+	}
+	if pattern == "" {
+		return nil, fmt.Errorf("alias pattern is empty")
+	}
+	if isRegex {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("invalid alias pattern: %w", err)
+		}
+	}
+
+	if err := tx.Where("user_id = ? AND pattern = ? AND is_regex = ?", userID, pattern, isRegex).
+		Delete(&MerchantAlias{}).Error; err != nil {
+		return nil, fmt.Errorf("error replacing merchant alias: %w", err)
+	}
+
+	alias := MerchantAlias{
+		AliasID:    uuid.New(),
+		MerchantID: merchantID,
+		UserID:     &userID,
+		Pattern:    pattern,
+		IsRegex:    isRegex,
+	}
+	if err := tx.Create(&alias).Error; err != nil {
+		return nil, fmt.Errorf("error creating merchant alias: %w", err)
+	}
+	return &alias, nil
+}
+
+// MergeMerchants folds the source merchants into the target for the given user: the user's
+// receipts are moved to the target and user aliases are added so future receipts follow
+func MergeMerchants(userID, targetID uuid.UUID, sourceIDs []uuid.UUID) error {
+	DB := db.GetDBInstance()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		for _, sourceID := range sourceIDs {
+			if sourceID == targetID {
+				continue
+			}
+			source, err := GetMerchantByID(tx, sourceID)
+			if err != nil {
+				return fmt.Errorf("error loading merchant %s: %w", sourceID, err)
+			}
+
+			// Every name that resolved to the source now resolves to the target for this user
+			var aliases []MerchantAlias
+			if err := tx.Where("merchant_id = ? AND (user_id = ? OR user_id IS NULL)", sourceID, userID).
+				Find(&aliases).Error; err != nil {
+				return fmt.Errorf("error loading merchant aliases: %w", err)
+			}
+			patterns := []MerchantAlias{{Pattern: source.NormalizedName}}
+			patterns = append(patterns, aliases...)
+			for _, alias := range patterns {
+				if _, err := AddUserAlias(tx, userID, targetID, alias.Pattern, alias.IsRegex); err != nil {
+					return err
+				}
+			}
+
+			if err := tx.Model(&Receipt{}).Where("user_id = ? AND merchant_id = ?", userID, sourceID).
+				Update("merchant_id", targetID).Error; err != nil {
+				return fmt.Errorf("error moving receipts: %w", err)
+			}
+		}
+		return nil
+	})
+}
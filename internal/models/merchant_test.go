@@ -0,0 +1,35 @@
+package models
+
+import "testing"
+
+func TestNormalizeMerchantName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"WAL-MART #1234", "WALMART"},
+		{"Walmart Supercentre", "WALMART"},
+		{"Walmart Inc.", "WALMART"},
+		{"STORE 1234 WALMART", "WALMART"},
+		{"Canada Post", "CANADA POST"},
+		{"Canada Computers", "CANADA COMPUTERS"},
+		{"Costco Wholesale Canada", "COSTCO WHOLESALE"},
+		{"Best Buy Canada Ltd.", "BEST BUY"},
+		{"Hudson's Bay Company", "HUDSONS BAY"},
+		{"Dollar Store", "DOLLAR STORE"},
+		{"Apple Store", "APPLE STORE"},
+		{"Co-op", "COOP"},
+		{"The Home Depot", "HOME DEPOT"},
+		{"The Bay", "THE BAY"},
+		{"The Source Store", "SOURCE STORE"},
+		{"Marché Tradition #482", "MARCHE TRADITION"},
+		{"A&W", "A AND W"},
+		{"#0412", ""},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeMerchantName(tt.name); got != tt.want {
+			t.Errorf("NormalizeMerchantName(%q) = %q; want %q", tt.name, got, tt.want)
+		}
+	}
+}
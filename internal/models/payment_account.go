@@ -0,0 +1,96 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"receipt-mgmt/db"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PaymentAccount is a user's named card, matched to receipts by its last four digits
+type PaymentAccount struct {
+	AccountID uuid.UUID `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"account_id"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_payment_account_card" json:"user_id"`
+	Name      string    `gorm:"type:varchar(100);not null" json:"name"`                                  // e.g. "Personal Visa"
+	CardBrand string    `gorm:"type:varchar(20);uniqueIndex:idx_payment_account_card" json:"card_brand"` // Empty matches any brand
+	LastFour  string    `gorm:"type:char(4);not null;uniqueIndex:idx_payment_account_card" json:"last_four"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// GetPaymentAccounts returns the user's payment accounts
+func GetPaymentAccounts(userID uuid.UUID) ([]PaymentAccount, error) {
+	DB := db.GetDBInstance()
+
+	var accounts []PaymentAccount
+	err := DB.Where("user_id = ?", userID).Order("name ASC").Find(&accounts).Error
+	return accounts, err
+}
+
+// FindPaymentAccount returns the user's account for a card, preferring one with the same brand.
+// It returns nil when the user has no matching account.
+func FindPaymentAccount(tx *gorm.DB, userID uuid.UUID, cardBrand, lastFour string) (*PaymentAccount, error) {
+	if lastFour == "" {
+		return nil, nil
+	}
+
+	var account PaymentAccount
+	err := tx.Where("user_id = ? AND last_four = ? AND (card_brand = ? OR card_brand = '')", userID, lastFour, cardBrand).
+		Order("card_brand = '' ASC").First(&account).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// SavePaymentAccount creates or updates an account and links the user's receipts paid with that card
+func SavePaymentAccount(account *PaymentAccount) error {
+	DB := db.GetDBInstance()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(account).Error; err != nil {
+			return fmt.Errorf("error saving payment account: %w", err)
+		}
+
+		// Receipts already linked to this account but no longer matching its card are released
+		if err := tx.Model(&Receipt{}).
+			Where("payment_account_id = ? AND (card_last_four <> ? OR (? <> '' AND card_brand <> ?))",
+				account.AccountID, account.LastFour, account.CardBrand, account.CardBrand).
+			Update("payment_account_id", nil).Error; err != nil {
+			return fmt.Errorf("error unlinking receipts: %w", err)
+		}
+
+		query := tx.Model(&Receipt{}).Where("user_id = ? AND card_last_four = ? AND payment_account_id IS NULL",
+			account.UserID, account.LastFour)
+		if account.CardBrand != "" {
+			query = query.Where("card_brand = ?", account.CardBrand)
+		}
+		if err := query.Update("payment_account_id", account.AccountID).Error; err != nil {
+			return fmt.Errorf("error linking receipts: %w", err)
+		}
+		return nil
+	})
+}
+
+// DeletePaymentAccount removes a user's account and unlinks its receipts
+func DeletePaymentAccount(accountID, userID uuid.UUID) (bool, error) {
+	DB := db.GetDBInstance()
+
+	deleted := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("account_id = ? AND user_id = ?", accountID, userID).Delete(&PaymentAccount{})
+		if result.Error != nil {
+			return fmt.Errorf("error deleting payment account: %w", result.Error)
+		}
+		deleted = result.RowsAffected > 0
+		return tx.Model(&Receipt{}).Where("payment_account_id = ?", accountID).
+			Update("payment_account_id", nil).Error
+	})
+	return deleted, err
+}
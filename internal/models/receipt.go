@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"receipt-mgmt/db"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -16,17 +17,57 @@ type Receipt struct {
 	ReceiptID        uuid.UUID       `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"receipt_id"`
 	UserID           uuid.UUID       `gorm:"type:uuid;not null" json:"user_id"`
 	CategoryID       uuid.UUID       `gorm:"type:uuid;not null" json:"category_id"`
+	CategorySuggested bool           `gorm:"default:false" json:"category_suggested"`           // True while the category is an unconfirmed suggestion
+	CategoryConfidence float64       `gorm:"type:decimal(5,4)" json:"category_confidence"`      // Confidence of the suggested category
+	CategorySuggestions []CategorySuggestion `gorm:"-" json:"category_suggestions,omitempty"` // Suggestion and alternatives, returned on upload
+	ExpenseCandidates []ExpenseMatchCandidate `gorm:"-" json:"expense_candidates,omitempty"` // Manual expenses that may be this receipt, returned on upload
+	BudgetAlerts     []BudgetAlert   `gorm:"-" json:"budget_alerts,omitempty"` // Budget thresholds the receipt crossed, returned on upload
 	Image            []byte          `gorm:"type:bytea;not null" json:"image"`
 	Status           string          `gorm:"type:varchar(50);not null" json:"status"`
-	TotalAmount      float64         `gorm:"type:decimal(10,2)" json:"total_amount"`
+	Type             string          `gorm:"type:varchar(10);not null;default:'purchase';index" json:"type"` // purchase or refund
+	ReceiptNumber    string          `gorm:"type:varchar(50);index" json:"receipt_number"`      // Receipt or transaction number printed by the store
+	OriginalReceiptID *uuid.UUID     `gorm:"type:uuid;index" json:"original_receipt_id"`        // Purchase a refund was matched to
+	TotalAmount      float64         `gorm:"type:decimal(10,2)" json:"total_amount"`           // Amount in the receipt's own currency
+	Locale           string          `gorm:"type:varchar(5)" json:"locale"`                     // en-CA or fr-CA, as used to read the receipt
+	Currency         string          `gorm:"type:char(3)" json:"currency"`                      // Currency the receipt was paid in
+	ConvertedAmount  float64         `gorm:"type:decimal(10,2)" json:"converted_amount"`        // TotalAmount in ConvertedCurrency
+	ConvertedCurrency string         `gorm:"type:char(3)" json:"converted_currency"`            // The user's currency at upload time
+	ExchangeRate     float64         `gorm:"type:decimal(18,8)" json:"exchange_rate"`           // Rate applied, zero when no rate was available
 	Merchant         string          `gorm:"type:varchar(255)" json:"merchant"`
-	Items            json.RawMessage `gorm:"type:jsonb" json:"items"` // JSONB column
+	MerchantID       *uuid.UUID      `gorm:"type:uuid;index" json:"merchant_id"`                // Canonical merchant the printed name resolves to
+	MerchantAddress  string          `gorm:"type:text" json:"merchant_address"`        // Address as printed on the receipt
+	MerchantStreet   string          `gorm:"type:varchar(255)" json:"merchant_street"`
+	MerchantCity     string          `gorm:"type:varchar(100);index" json:"merchant_city"`
+	MerchantProvince string          `gorm:"type:varchar(2);index" json:"merchant_province"` // Province inferred from the merchant address
+	MerchantPostalCode string        `gorm:"type:varchar(10)" json:"merchant_postal_code"`
+	MerchantPhone    string          `gorm:"type:varchar(20)" json:"merchant_phone"`
+	StoreNumber      string          `gorm:"type:varchar(20)" json:"store_number"`      // Tells apart branches of the same chain
+	Items            json.RawMessage `gorm:"type:jsonb" json:"items"` // JSONB column, compatibility view of LineItems
+	LineItems        []ReceiptItem   `gorm:"foreignKey:ReceiptID;references:ReceiptID;constraint:OnDelete:CASCADE" json:"line_items,omitempty"`
 	ScannedDate      time.Time       `gorm:"not null;default:CURRENT_TIMESTAMP" json:"scanned_date"`
 	TransactionDate  string          `gorm:"type:varchar(50);not null" json:"transaction_date"`
 	TransactionTime  string          `gorm:"type:varchar(50);not null" json:"transaction_time"`
 	FileHash         string          `gorm:"type:varchar(64);unique;not null" json:"file_hash"`
+	PaymentMethod    string          `gorm:"type:varchar(20);index" json:"payment_method"`     // credit, debit, cash or gift_card
+	CardBrand        string          `gorm:"type:varchar(20)" json:"card_brand"`
+	CardLastFour     string          `gorm:"type:char(4);index" json:"card_last_four"`          // Never the full card number
+	CashTendered     float64         `gorm:"type:decimal(10,2)" json:"cash_tendered"`
+	ChangeDue        float64         `gorm:"type:decimal(10,2)" json:"change_due"`
+	PaymentAccountID *uuid.UUID      `gorm:"type:uuid;index" json:"payment_account_id"`         // User's named account for the card
 	Tax              float64         `gorm:"type:decimal(10,2)" json:"tax"`
+	Taxes            []ReceiptTax    `gorm:"foreignKey:ReceiptID;references:ReceiptID;constraint:OnDelete:CASCADE" json:"taxes,omitempty"` // GST/HST/PST/QST breakdown of Tax
+	Splits           []ReceiptSplit  `gorm:"foreignKey:ReceiptID;references:ReceiptID;constraint:OnDelete:CASCADE" json:"splits,omitempty"` // Per-category parts, each with its own expense
 	Discounts        float64         `gorm:"type:decimal(10,2)" json:"discounts"`
+	Subtotal         float64         `gorm:"type:decimal(10,2)" json:"subtotal"`        // Subtotal printed on the receipt
+	Tip              float64         `gorm:"type:decimal(10,2)" json:"tip"`
+	ItemsSubtotal    float64         `gorm:"type:decimal(10,2)" json:"items_subtotal"`  // Sum of the line item totals
+	Discrepancy      float64         `gorm:"type:decimal(10,2)" json:"discrepancy"`     // TotalAmount minus items + tax + tip - discounts
+	TotalsMismatch   bool            `gorm:"default:false" json:"totals_mismatch"`      // True when the discrepancy exceeds the tolerance
+	Tags             StringList      `gorm:"type:jsonb;not null;default:'[]'" json:"tags"` // Added by the user's rules
+	Flagged          bool            `gorm:"default:false;index" json:"flagged"`          // Marked for review by a rule
+	Notes            string          `gorm:"type:text" json:"notes"`                       // Free text added by the user
+	OCRText          string          `gorm:"type:text" json:"ocr_text,omitempty"`          // Text read from the image, card numbers masked
+	SearchVector     string          `gorm:"type:tsvector;index:,type:gin;->:false;<-:false" json:"-"` // Maintained by refreshReceiptSearch
 	CreatedAt        time.Time       `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt        time.Time       `gorm:"autoUpdateTime" json:"updated_at"`
 	DeletedAt        gorm.DeletedAt  `gorm:"index" json:"deleted_at,omitempty"`
@@ -61,6 +102,42 @@ type Expense struct {
 }
 
 
+// ExpenseAmount returns the amount to record as an expense, in the user's currency. A receipt in another
+// currency that couldn't be converted counts for nothing until its exchange rate is set.
+// Refunds are recorded as negative expenses.
+func (r *Receipt) ExpenseAmount() float64 {
+	amount := r.TotalAmount
+	if r.ExchangeRate > 0 {
+		amount = r.ConvertedAmount
+	} else if r.MissingExchangeRate() {
+		amount = 0
+	}
+	if r.Type == ReceiptTypeRefund {
+		return -amount
+	}
+	return amount
+}
+
+// ExpenseDescription describes the expense created from the receipt
+func (r *Receipt) ExpenseDescription() string {
+	if r.Type == ReceiptTypeRefund {
+		return fmt.Sprintf("Refund from receipt: %s", r.Merchant)
+	}
+	return fmt.Sprintf("Expense from receipt: %s", r.Merchant)
+}
+
+// MissingExchangeRate reports whether the receipt is in another currency than the user's and has no rate to convert it
+func (r *Receipt) MissingExchangeRate() bool {
+	return r.ExchangeRate <= 0 && r.Currency != "" && r.ConvertedCurrency != "" && r.Currency != r.ConvertedCurrency
+}
+
+// ApplyExchangeRate recomputes the converted amount from TotalAmount and the stored rate
+func (r *Receipt) ApplyExchangeRate() {
+	if r.ExchangeRate > 0 {
+		r.ConvertedAmount = roundCents(r.TotalAmount * r.ExchangeRate)
+	}
+}
+
 // CheckFileHashExists checks if a receipt with the given file hash already exists in the database
 func CheckFileHashExists(fileHash string) (bool, error) {
   // Use GetDBInstance to get the DB instance
@@ -76,12 +153,18 @@ func CheckFileHashExists(fileHash string) (bool, error) {
 }
 
 
-// IsCategoryIDValid checks if a category ID exists in the database
-func IsCategoryIDValid(categoryID string) (bool, error) {
+// IsCategoryIDValid checks that a category exists and is either a default category or one of the user's own
+func IsCategoryIDValid(categoryID string, userID uuid.UUID) (bool, error) {
 	DB := db.GetDBInstance()
 
+	// A malformed ID can't match any category
+	if _, err := uuid.Parse(categoryID); err != nil {
+		return false, nil
+	}
+
 	var count int64
-	err := DB.Model(&Category{}).Where("id = ?", categoryID).Count(&count).Error
+	err := DB.Model(&Category{}).Where("id = ?", categoryID).
+		Where("user_id = ? OR user_id IS NULL OR is_default = true", userID).Count(&count).Error
 	if err != nil {
 		// Return false and propagate the error
 		return false, err
@@ -91,34 +174,104 @@ func IsCategoryIDValid(categoryID string) (bool, error) {
 	return count > 0, nil
 }
 
-func CreateExpense(expense *Expense) error {
-	DB := db.GetDBInstance()
-	return DB.Create(expense).Error
+// ReceiptFilter holds the optional criteria for listing a user's receipts
+type ReceiptFilter struct {
+	MerchantCity       string
+	MerchantProvince   string
+	MerchantPostalCode string
+	MerchantPhone      string
+	StoreNumber        string
+	PaymentMethod      string
+	CardBrand          string
+	CardLastFour       string
+	PaymentAccountID   *uuid.UUID
+	Type               string
+	Tag                string
+	Flagged            *bool
+	From               string // Inclusive YYYY-MM-DD transaction dates
+	To                 string
+	Merchant           string // Part of the printed merchant name
+	MerchantID         *uuid.UUID
+	CategoryID         *uuid.UUID
+	MinAmount          *float64 // Receipt total, in the receipt's currency
+	MaxAmount          *float64
+	Status             string
 }
 
-
-func CreateReceipt(receipt *Receipt) error {
+// Get a page of the receipts for a user, without their images
+func GetReceiptsByUserID(userID uuid.UUID, filter ReceiptFilter, page ReceiptPageRequest) ([]Receipt, ReceiptPageResult, error) {
 	// Start a database transaction
 	DB := db.GetDBInstance()
 
-	return DB.Transaction(func(tx *gorm.DB) error {
-		// Create the receipt (including the JSON Items field)
-		if err := tx.Create(receipt).Error; err != nil {
-			log.Printf("Error creating receipt: %v", err)
-			return fmt.Errorf("error creating receipt: %w", err)
-		}
-		return nil
-	})
+	return findReceiptPage(filterReceipts(DB.Model(&Receipt{}).Where("user_id = ?", userID), filter), page)
 }
 
-// Get All receipts for a user
-func GetReceiptsByUserID(userID uuid.UUID) ([]Receipt, error) {
-	// Start a database transaction
-	DB := db.GetDBInstance()
+// filterReceipts narrows the receipt query to the filter's criteria
+func filterReceipts(query *gorm.DB, filter ReceiptFilter) *gorm.DB {
+	if filter.MerchantCity != "" {
+		query = query.Where("merchant_city ILIKE ?", filter.MerchantCity)
+	}
+	if filter.MerchantProvince != "" {
+		query = query.Where("merchant_province = ?", strings.ToUpper(filter.MerchantProvince))
+	}
+	if filter.MerchantPostalCode != "" {
+		// Match on the postal code prefix so "M5V" finds every receipt in that area
+		query = query.Where("REPLACE(merchant_postal_code, ' ', '') ILIKE ?", strings.ReplaceAll(filter.MerchantPostalCode, " ", "")+"%")
+	}
+	if filter.MerchantPhone != "" {
+		query = query.Where("merchant_phone = ?", filter.MerchantPhone)
+	}
+	if filter.StoreNumber != "" {
+		query = query.Where("store_number = ?", strings.TrimLeft(filter.StoreNumber, "#0"))
+	}
 
-	var receipts []Receipt
-	err := DB.Where("user_id = ?", userID).Find(&receipts).Error
-	return receipts, err
+	if filter.PaymentMethod != "" {
+		query = query.Where("payment_method = ?", strings.ToLower(filter.PaymentMethod))
+	}
+	if filter.CardBrand != "" {
+		query = query.Where("card_brand = ?", strings.ToUpper(filter.CardBrand))
+	}
+	if filter.CardLastFour != "" {
+		query = query.Where("card_last_four = ?", filter.CardLastFour)
+	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", strings.ToLower(filter.Type))
+	}
+	if filter.PaymentAccountID != nil {
+		query = query.Where("payment_account_id = ?", *filter.PaymentAccountID)
+	}
+	if filter.Tag != "" {
+		// Tags are matched case-insensitively, as rules add them
+		query = query.Where("EXISTS (SELECT 1 FROM jsonb_array_elements_text(tags) AS tag WHERE LOWER(tag) = LOWER(?))", filter.Tag)
+	}
+	if filter.Flagged != nil {
+		query = query.Where("flagged = ?", *filter.Flagged)
+	}
+	if filter.From != "" {
+		query = query.Where("transaction_date >= ?", filter.From)
+	}
+	if filter.To != "" {
+		query = query.Where("transaction_date <= ?", filter.To)
+	}
+	if filter.Merchant != "" {
+		query = query.Where("merchant ILIKE ?", "%"+filter.Merchant+"%")
+	}
+	if filter.MerchantID != nil {
+		query = query.Where("merchant_id = ?", *filter.MerchantID)
+	}
+	if filter.CategoryID != nil {
+		query = query.Where("category_id = ?", *filter.CategoryID)
+	}
+	if filter.MinAmount != nil {
+		query = query.Where("total_amount >= ?", *filter.MinAmount)
+	}
+	if filter.MaxAmount != nil {
+		query = query.Where("total_amount <= ?", *filter.MaxAmount)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	return query
 }
 
 // Get Single Receipt By ID
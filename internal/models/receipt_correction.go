@@ -0,0 +1,194 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"receipt-mgmt/db"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ReceiptCorrection records a manual change to a receipt field, keeping the value the OCR extracted
+type ReceiptCorrection struct {
+	CorrectionID   uuid.UUID `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"correction_id"`
+	ReceiptID      uuid.UUID `gorm:"type:uuid;not null;index" json:"receipt_id"`
+	UserID         uuid.UUID `gorm:"type:uuid;not null" json:"user_id"`
+	Field          string    `gorm:"type:varchar(50);not null" json:"field"`
+	OCRValue       string    `gorm:"type:text" json:"ocr_value"` // Value extracted at upload, kept across later corrections
+	PreviousValue  string    `gorm:"type:text" json:"previous_value"`
+	CorrectedValue string    `gorm:"type:text" json:"corrected_value"`
+	CreatedAt      time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// GetReceiptCorrections returns the correction history of a receipt, oldest first
+func GetReceiptCorrections(receiptID, userID uuid.UUID) ([]ReceiptCorrection, error) {
+	DB := db.GetDBInstance()
+
+	var corrections []ReceiptCorrection
+	err := DB.Where("receipt_id = ? AND user_id = ?", receiptID, userID).
+		Order("created_at ASC").Find(&corrections).Error
+	return corrections, err
+}
+
+// TransactionDateTime combines the receipt's transaction date and time, reporting false
+// when the receipt has no usable date
+func (r *Receipt) TransactionDateTime() (time.Time, bool) {
+	date, err := time.Parse("2006-01-02", r.TransactionDate)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if clock, err := time.Parse("15:04:05", r.TransactionTime); err == nil {
+		date = date.Add(time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute +
+			time.Duration(clock.Second())*time.Second)
+	}
+	return date, true
+}
+
+// ApplyReceiptCorrections saves the corrected receipt fields together with their audit entries.
+// The receipt must already hold the corrected values. beforeSave runs first in the same
+// transaction, e.g. to learn a merchant alias. Totals are reconciled again, the tax breakdown
+// follows a corrected tax and the linked expense is kept in sync.
+func ApplyReceiptCorrections(receipt *Receipt, corrections []ReceiptCorrection, beforeSave func(tx *gorm.DB) error) error {
+	DB := db.GetDBInstance()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if beforeSave != nil {
+			if err := beforeSave(tx); err != nil {
+				return err
+			}
+		}
+
+		for i := range corrections {
+			correction := &corrections[i]
+			correction.CorrectionID = uuid.New()
+			correction.ReceiptID = receipt.ReceiptID
+			correction.UserID = receipt.UserID
+
+			// A field corrected before keeps the value the OCR originally extracted
+			var first ReceiptCorrection
+			err := tx.Where("receipt_id = ? AND field = ?", receipt.ReceiptID, correction.Field).
+				Order("created_at ASC").First(&first).Error
+			if err == nil {
+				correction.OCRValue = first.OCRValue
+			} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("error loading previous corrections: %w", err)
+			}
+
+			if err := tx.Create(correction).Error; err != nil {
+				return fmt.Errorf("error recording correction: %w", err)
+			}
+		}
+
+		var items []ReceiptItem
+		if err := tx.Where("receipt_id = ?", receipt.ReceiptID).Order("line_number ASC").Find(&items).Error; err != nil {
+			return fmt.Errorf("error loading receipt items: %w", err)
+		}
+		receipt.Reconcile(items)
+		receipt.ApplyExchangeRate()
+		itemsView, err := ItemsView(items)
+		if err != nil {
+			return err
+		}
+		receipt.Items = itemsView
+
+		if err := rescaleReceiptTaxes(tx, receipt); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&Receipt{}).Where("receipt_id = ?", receipt.ReceiptID).Updates(map[string]interface{}{
+			"items":              receipt.Items,
+			"merchant":           receipt.Merchant,
+			"merchant_id":        receipt.MerchantID,
+			"category_id":        receipt.CategoryID,
+			"category_suggested": receipt.CategorySuggested,
+			"total_amount":       receipt.TotalAmount,
+			"converted_amount":   receipt.ConvertedAmount,
+			"converted_currency": receipt.ConvertedCurrency,
+			"exchange_rate":      receipt.ExchangeRate,
+			"tax":                receipt.Tax,
+			"discounts":          receipt.Discounts,
+			"transaction_date":   receipt.TransactionDate,
+			"transaction_time":   receipt.TransactionTime,
+			"items_subtotal":     receipt.ItemsSubtotal,
+			"discrepancy":        receipt.Discrepancy,
+			"totals_mismatch":    receipt.TotalsMismatch,
+			"status":             receipt.Status,
+			"notes":              receipt.Notes,
+		}).Error; err != nil {
+			return fmt.Errorf("error updating receipt: %w", err)
+		}
+		if err := refreshReceiptSearch(tx, receipt.ReceiptID); err != nil {
+			return err
+		}
+
+		return syncReceiptExpense(tx, receipt)
+	})
+}
+
+// rescaleReceiptTaxes spreads a corrected tax total over the receipt's tax components in proportion to their amounts
+func rescaleReceiptTaxes(tx *gorm.DB, receipt *Receipt) error {
+	var taxes []ReceiptTax
+	if err := tx.Where("receipt_id = ?", receipt.ReceiptID).Order("type ASC").Find(&taxes).Error; err != nil {
+		return fmt.Errorf("error loading receipt taxes: %w", err)
+	}
+
+	sum := 0.0
+	for _, tax := range taxes {
+		sum += tax.Amount
+	}
+	if len(taxes) == 0 || sum == 0 || roundCents(sum) == roundCents(receipt.Tax) {
+		return nil
+	}
+
+	allocated := 0.0
+	for i, tax := range taxes {
+		amount := roundCents(receipt.Tax * tax.Amount / sum)
+		if i == len(taxes)-1 {
+			// The last component absorbs the rounding
+			amount = roundCents(receipt.Tax - allocated)
+		}
+		allocated += amount
+		if err := tx.Model(&ReceiptTax{}).Where("tax_id = ?", tax.TaxID).Update("amount", amount).Error; err != nil {
+			return fmt.Errorf("error updating receipt tax: %w", err)
+		}
+	}
+	return nil
+}
+
+// syncReceiptExpense updates the expense created from the receipt with its amount, category, date and description,
+// or the expenses of its splits when the receipt is split. The on_update expense policy can instead
+// leave the expenses unchanged or unlink them.
+func syncReceiptExpense(tx *gorm.DB, receipt *Receipt) error {
+	switch ExpenseUpdatePolicy() {
+	case ExpensePolicyKeep:
+		return nil
+	case ExpensePolicyUnlink:
+		return unlinkReceiptExpenses(tx, receipt)
+	}
+
+	var splits []ReceiptSplit
+	if err := tx.Where("receipt_id = ?", receipt.ReceiptID).Order("created_at ASC, amount DESC").Find(&splits).Error; err != nil {
+		return fmt.Errorf("error loading receipt splits: %w", err)
+	}
+	if len(splits) > 0 {
+		// A split receipt keeps the category of each split
+		return syncSplitExpenses(tx, receipt, splits)
+	}
+
+	updates := map[string]interface{}{
+		"amount":      receipt.ExpenseAmount(),
+		"category_id": receipt.CategoryID,
+		"description": receipt.ExpenseDescription(),
+		"updated_at":  time.Now(),
+	}
+	if date, ok := receipt.TransactionDateTime(); ok {
+		updates["date"] = date
+	}
+
+	if err := tx.Model(&Expense{}).Where("receipt_id = ?", receipt.ReceiptID).Updates(updates).Error; err != nil {
+		return fmt.Errorf("error updating linked expense: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"receipt-mgmt/db"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ReceiptItem represents a single line item extracted from a receipt
+type ReceiptItem struct {
+	ItemID         uuid.UUID `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"item_id"`
+	ReceiptID      uuid.UUID `gorm:"type:uuid;not null;index" json:"receipt_id"`
+	UserID         uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
+	LineNumber     int       `gorm:"not null" json:"line_number"` // Position of the item on the receipt
+	Name           string    `gorm:"type:varchar(255)" json:"name"`
+	NormalizedName string    `gorm:"type:varchar(255);index" json:"normalized_name"`        // Matches the same product across receipts
+	ProductCode    string    `gorm:"type:varchar(100);index" json:"product_code,omitempty"` // SKU / product code when printed
+	Quantity       float64   `gorm:"type:decimal(10,3);not null;default:1" json:"quantity"`
+	UnitPrice      float64   `gorm:"type:decimal(10,2)" json:"unit_price"`
+	TotalPrice     float64   `gorm:"type:decimal(10,2)" json:"total_price"`
+	Discount       float64   `gorm:"type:decimal(10,2)" json:"discount"`
+	Confidence     float64   `gorm:"type:decimal(5,4)" json:"confidence"` // OCR confidence between 0 and 1
+	CreatedAt      time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// ItemFilter holds the optional criteria for querying items across receipts
+type ItemFilter struct {
+	Name        string
+	ProductCode string
+	Merchant    string
+	FromDate    string
+	ToDate      string
+}
+
+// ReceiptItemResult is a line item together with the receipt it was bought on
+type ReceiptItemResult struct {
+	ReceiptItem
+	Merchant        string `json:"merchant"`
+	TransactionDate string `json:"transaction_date"`
+}
+
+// GetItemsByReceiptID returns the line items of a user's receipt in printed order
+func GetItemsByReceiptID(receiptID, userID uuid.UUID) ([]ReceiptItem, error) {
+	DB := db.GetDBInstance()
+
+	var items []ReceiptItem
+	err := DB.Where("receipt_id = ? AND user_id = ?", receiptID, userID).
+		Order("line_number ASC").
+		Find(&items).Error
+	return items, err
+}
+
+// FindItems searches the user's line items across all of their receipts
+func FindItems(userID uuid.UUID, filter ItemFilter) ([]ReceiptItemResult, error) {
+	DB := db.GetDBInstance()
+
+	query := DB.Table("receipt_items").
+		Select("receipt_items.*, receipts.merchant, receipts.transaction_date").
+		Joins("JOIN receipts ON receipts.receipt_id = receipt_items.receipt_id AND receipts.deleted_at IS NULL").
+		Where("receipt_items.user_id = ?", userID)
+
+	if filter.Name != "" {
+		query = query.Where("receipt_items.name ILIKE ?", "%"+filter.Name+"%")
+	}
+	if filter.ProductCode != "" {
+		query = query.Where("receipt_items.product_code = ?", filter.ProductCode)
+	}
+	if filter.Merchant != "" {
+		query = query.Where("receipts.merchant ILIKE ?", "%"+filter.Merchant+"%")
+	}
+	if filter.FromDate != "" {
+		query = query.Where("receipts.transaction_date >= ?", filter.FromDate)
+	}
+	if filter.ToDate != "" {
+		query = query.Where("receipts.transaction_date <= ?", filter.ToDate)
+	}
+
+	var items []ReceiptItemResult
+	err := query.Order("receipts.transaction_date DESC, receipt_items.line_number ASC").Scan(&items).Error
+	return items, err
+}
+
+// ApplyItemChange runs an item edit and recomputes the items subtotal and the mismatch flag. The
+// printed total is the amount charged, so it is left as it is: a total that no longer adds up
+// puts the receipt up for review, and the total itself is only changed by a correction.
+func ApplyItemChange(receipt *Receipt, change func(tx *gorm.DB) error) error {
+	DB := db.GetDBInstance()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := change(tx); err != nil {
+			return err
+		}
+
+		var after []ReceiptItem
+		if err := tx.Where("receipt_id = ?", receipt.ReceiptID).Order("line_number ASC").Find(&after).Error; err != nil {
+			return fmt.Errorf("error loading receipt items: %w", err)
+		}
+
+		// Items assigned to a split can't be removed from under it
+		var splits []ReceiptSplit
+		if err := tx.Where("receipt_id = ?", receipt.ReceiptID).Find(&splits).Error; err != nil {
+			return fmt.Errorf("error loading receipt splits: %w", err)
+		}
+		if err := checkSplitItems(splits, after); err != nil {
+			return err
+		}
+
+		receipt.Reconcile(after)
+		receipt.LineItems = after
+		itemsView, err := ItemsView(after)
+		if err != nil {
+			return err
+		}
+		receipt.Items = itemsView
+
+		if err := tx.Model(&Receipt{}).Where("receipt_id = ?", receipt.ReceiptID).Updates(map[string]interface{}{
+			"items":           receipt.Items,
+			"items_subtotal":  receipt.ItemsSubtotal,
+			"discrepancy":     receipt.Discrepancy,
+			"totals_mismatch": receipt.TotalsMismatch,
+			"status":          receipt.Status,
+		}).Error; err != nil {
+			return fmt.Errorf("error updating receipt totals: %w", err)
+		}
+		if err := refreshReceiptSearch(tx, receipt.ReceiptID); err != nil {
+			return err
+		}
+
+		// Propagate changed item shares of a split to the expenses linked to this receipt
+		if hasItemSplits(splits) {
+			return syncReceiptExpense(tx, receipt)
+		}
+		return nil
+	})
+}
+
+// ItemsView builds the legacy items column (name and total price only) from the line items, as
+// it is built at upload
+func ItemsView(items []ReceiptItem) (json.RawMessage, error) {
+	view := []map[string]interface{}{}
+	for _, item := range items {
+		if item.Name == "" || item.TotalPrice == 0 {
+			continue
+		}
+		view = append(view, map[string]interface{}{
+			"name":       item.Name,
+			"totalPrice": item.TotalPrice,
+		})
+	}
+
+	data, err := json.Marshal(view)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding receipt items: %w", err)
+	}
+	return data, nil
+}
+
+// NextItemLineNumber returns the line number to use for an item appended to the receipt
+func NextItemLineNumber(tx *gorm.DB, receiptID uuid.UUID) (int, error) {
+	var maxLine int
+	err := tx.Model(&ReceiptItem{}).Where("receipt_id = ?", receiptID).
+		Select("COALESCE(MAX(line_number), 0)").Scan(&maxLine).Error
+	return maxLine + 1, err
+}
@@ -0,0 +1,178 @@
+package models
+
+import (
+	"fmt"
+	"receipt-mgmt/db"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// What happens to a receipt's expenses when the receipt is deleted or updated, set by the
+// receipts.expense_policy.on_delete and receipts.expense_policy.on_update settings
+const (
+	ExpensePolicyDelete = "delete" // Delete the expenses with the receipt
+	ExpensePolicySync   = "sync"   // Update the expenses to match the receipt
+	ExpensePolicyUnlink = "unlink" // Keep the expenses as they are, no longer linked to the receipt
+	ExpensePolicyKeep   = "keep"   // Keep the expenses as they are and linked; a deleted receipt is archived
+)
+
+// ExpenseDeletePolicy returns the configured policy for the expenses of a deleted receipt
+func ExpenseDeletePolicy() string {
+	return expensePolicy("receipts.expense_policy.on_delete", ExpensePolicyDelete)
+}
+
+// ExpenseUpdatePolicy returns the configured policy for the expenses of an updated receipt
+func ExpenseUpdatePolicy() string {
+	return expensePolicy("receipts.expense_policy.on_update", ExpensePolicySync)
+}
+
+func expensePolicy(key, fallback string) string {
+	if policy := strings.ToLower(strings.TrimSpace(viper.GetString(key))); policy != "" {
+		return policy
+	}
+	return fallback
+}
+
+// CheckExpensePolicies reports a misconfigured expense policy
+func CheckExpensePolicies() error {
+	if policy := ExpenseDeletePolicy(); policy != ExpensePolicyDelete && policy != ExpensePolicyUnlink && policy != ExpensePolicyKeep {
+		return fmt.Errorf("invalid receipts.expense_policy.on_delete %q, use delete, unlink or keep", policy)
+	}
+	if policy := ExpenseUpdatePolicy(); policy != ExpensePolicySync && policy != ExpensePolicyUnlink && policy != ExpensePolicyKeep {
+		return fmt.Errorf("invalid receipts.expense_policy.on_update %q, use sync, unlink or keep", policy)
+	}
+	return nil
+}
+
+// CreateReceiptWithExpense saves a new receipt, its line items and taxes together with its expense
+// as one unit of work. When linkExpenseID is set, that manual expense is linked to the receipt
+// instead of creating a new one. When learnCategory is set, the user chose the receipt's category
+// and it is learned for the merchant with the receipt.
+func CreateReceiptWithExpense(receipt *Receipt, linkExpenseID *uuid.UUID, learnCategory bool) (*Expense, error) {
+	DB := db.GetDBInstance()
+
+	var expense *Expense
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(receipt).Error; err != nil {
+			return fmt.Errorf("error creating receipt: %w", err)
+		}
+		if err := refreshReceiptSearch(tx, receipt.ReceiptID); err != nil {
+			return err
+		}
+		if learnCategory && receipt.MerchantID != nil {
+			if err := LearnCategoryChoice(tx, receipt.UserID, *receipt.MerchantID, receipt.CategoryID, 1); err != nil {
+				return err
+			}
+		}
+
+		if linkExpenseID != nil {
+			var err error
+			expense, err = linkReceiptExpense(tx, receipt, *linkExpenseID)
+			return err
+		}
+
+		expense = receipt.newExpense()
+		if err := tx.Create(expense).Error; err != nil {
+			return fmt.Errorf("error creating expense: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return expense, nil
+}
+
+// DeleteReceipt deletes a receipt and applies the on_delete policy to its expenses. With the keep
+// policy the receipt is archived (soft deleted) so the expenses still point to it; otherwise it
+// is deleted permanently together with its items, taxes, splits and corrections, and the refunds,
+// statement transactions and budget alerts pointing to it are cleared.
+func DeleteReceipt(receipt *Receipt) error {
+	DB := db.GetDBInstance()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		policy := ExpenseDeletePolicy()
+		switch policy {
+		case ExpensePolicyDelete:
+			if err := tx.Where("receipt_id = ?", receipt.ReceiptID).Delete(&Expense{}).Error; err != nil {
+				return fmt.Errorf("error deleting receipt expenses: %w", err)
+			}
+		case ExpensePolicyUnlink:
+			if err := unlinkReceiptExpenses(tx, receipt); err != nil {
+				return err
+			}
+		}
+
+		query := tx
+		if policy != ExpensePolicyKeep {
+			if err := clearReceiptReferences(tx, receipt.ReceiptID); err != nil {
+				return err
+			}
+			query = tx.Unscoped()
+		}
+		if err := query.Delete(receipt).Error; err != nil {
+			return fmt.Errorf("error deleting receipt: %w", err)
+		}
+		return nil
+	})
+}
+
+// clearReceiptReferences removes the receipt's corrections and clears the references other rows
+// hold to a receipt about to be deleted permanently. A matched statement transaction goes back to
+// unmatched so reconciliation can pair it again.
+func clearReceiptReferences(tx *gorm.DB, receiptID uuid.UUID) error {
+	if err := tx.Where("receipt_id = ?", receiptID).Delete(&ReceiptCorrection{}).Error; err != nil {
+		return fmt.Errorf("error deleting receipt corrections: %w", err)
+	}
+	if err := tx.Model(&Receipt{}).Where("original_receipt_id = ?", receiptID).
+		Update("original_receipt_id", nil).Error; err != nil {
+		return fmt.Errorf("error unlinking refunds: %w", err)
+	}
+	if err := tx.Model(&StatementTransaction{}).Where("receipt_id = ?", receiptID).
+		Updates(map[string]interface{}{
+			"receipt_id":       nil,
+			"match_status":     StatementUnmatched,
+			"match_confidence": 0,
+			"reviewed":         false,
+			"updated_at":       time.Now(),
+		}).Error; err != nil {
+		return fmt.Errorf("error unmatching statement transactions: %w", err)
+	}
+	if err := tx.Model(&StatementTransaction{}).Where("candidate_receipt_ids @> ?", StringList{receiptID.String()}).
+		Update("candidate_receipt_ids", gorm.Expr("candidate_receipt_ids - ?::text", receiptID.String())).Error; err != nil {
+		return fmt.Errorf("error updating statement candidates: %w", err)
+	}
+	if err := tx.Model(&BudgetAlert{}).Where("receipt_id = ?", receiptID).Update("receipt_id", nil).Error; err != nil {
+		return fmt.Errorf("error unlinking budget alerts: %w", err)
+	}
+	return nil
+}
+
+// unlinkReceiptExpenses detaches the receipt's expenses, which then stand on their own
+func unlinkReceiptExpenses(tx *gorm.DB, receipt *Receipt) error {
+	if err := tx.Where("receipt_id = ?", receipt.ReceiptID).Delete(&ReceiptSplit{}).Error; err != nil {
+		return fmt.Errorf("error deleting receipt splits: %w", err)
+	}
+	if err := tx.Model(&Expense{}).Where("receipt_id = ?", receipt.ReceiptID).
+		Updates(map[string]interface{}{"receipt_id": nil, "updated_at": time.Now()}).Error; err != nil {
+		return fmt.Errorf("error unlinking receipt expenses: %w", err)
+	}
+	return nil
+}
+
+// newExpense builds the single expense recorded for the receipt
+func (r *Receipt) newExpense() *Expense {
+	return &Expense{
+		ExpenseID:   uuid.New(),
+		UserID:      r.UserID,
+		CategoryID:  r.CategoryID,
+		Amount:      r.ExpenseAmount(), // In the user's currency, negative for refunds
+		Date:        r.expenseDate(),
+		Description: r.ExpenseDescription(),
+		ReceiptID:   &r.ReceiptID,
+	}
+}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Receipt list sort fields, mapped to their column
+var receiptSortColumns = map[string]string{
+	"transaction_date": "transaction_date",
+	"amount":           "total_amount",
+	"created_at":       "created_at",
+}
+
+// ErrInvalidCursor is returned for a cursor that wasn't issued for the same sort
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ReceiptPageRequest selects a page of receipts, either by page number or after a cursor
+type ReceiptPageRequest struct {
+	Sort   string // transaction_date, amount or created_at
+	Order  string // asc or desc
+	Limit  int
+	Page   int     // 1-based, used when Cursor is nil
+	Cursor *string // Empty for the first page of a cursor walk
+}
+
+// ReceiptPageResult describes the page returned
+type ReceiptPageResult struct {
+	TotalCount int
+	NextCursor string // Empty on the last page
+}
+
+// receiptCursor is the position after the last receipt of a page: its sort value and ID as a tie-breaker
+type receiptCursor struct {
+	Sort      string    `json:"s"`
+	Order     string    `json:"o"`
+	Value     string    `json:"v"`
+	ReceiptID uuid.UUID `json:"id"`
+}
+
+// ValidReceiptSort reports whether the receipts can be sorted on the field
+func ValidReceiptSort(sort string) bool {
+	_, ok := receiptSortColumns[sort]
+	return ok
+}
+
+// findReceiptPage counts the filtered receipts and loads the requested page, leaving the images and OCR text out
+func findReceiptPage(query *gorm.DB, page ReceiptPageRequest) ([]Receipt, ReceiptPageResult, error) {
+	result := ReceiptPageResult{}
+	column := receiptSortColumns[page.Sort]
+	direction, comparison := "DESC", "<"
+	if page.Order == "asc" {
+		direction, comparison = "ASC", ">"
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, result, fmt.Errorf("error counting receipts: %w", err)
+	}
+	result.TotalCount = int(total)
+
+	query = query.Omit("image", "ocr_text").Order(fmt.Sprintf("%s %s, receipt_id %s", column, direction, direction))
+	if page.Cursor == nil {
+		query = query.Offset((page.Page - 1) * page.Limit)
+	} else if *page.Cursor != "" {
+		cursor, err := decodeReceiptCursor(*page.Cursor)
+		if err != nil || cursor.Sort != page.Sort || cursor.Order != page.Order {
+			return nil, result, ErrInvalidCursor
+		}
+		value, err := cursor.sortValue()
+		if err != nil {
+			return nil, result, ErrInvalidCursor
+		}
+		query = query.Where(fmt.Sprintf("(%s, receipt_id) %s (?, ?)", column, comparison), value, cursor.ReceiptID)
+	}
+
+	// One more than asked tells whether there is a next page
+	var receipts []Receipt
+	if err := query.Limit(page.Limit + 1).Find(&receipts).Error; err != nil {
+		return nil, result, fmt.Errorf("error loading receipts: %w", err)
+	}
+	if len(receipts) > page.Limit {
+		receipts = receipts[:page.Limit]
+		if page.Cursor != nil {
+			result.NextCursor = encodeReceiptCursor(page, &receipts[len(receipts)-1])
+		}
+	}
+	return receipts, result, nil
+}
+
+func encodeReceiptCursor(page ReceiptPageRequest, last *Receipt) string {
+	cursor := receiptCursor{Sort: page.Sort, Order: page.Order, ReceiptID: last.ReceiptID}
+	switch page.Sort {
+	case "amount":
+		cursor.Value = fmt.Sprintf("%.2f", last.TotalAmount)
+	case "created_at":
+		cursor.Value = last.CreatedAt.UTC().Format(time.RFC3339Nano)
+	default:
+		cursor.Value = last.TransactionDate
+	}
+	encoded, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func decodeReceiptCursor(value string) (*receiptCursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	var cursor receiptCursor
+	if err := json.Unmarshal(decoded, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+// sortValue converts the cursor's value back to the type of its sort column
+func (c *receiptCursor) sortValue() (interface{}, error) {
+	switch c.Sort {
+	case "amount":
+		var amount float64
+		_, err := fmt.Sscanf(c.Value, "%f", &amount)
+		return amount, err
+	case "created_at":
+		return time.Parse(time.RFC3339Nano, c.Value)
+	}
+	return c.Value, nil
+}
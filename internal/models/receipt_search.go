@@ -0,0 +1,111 @@
+package models
+
+import (
+	"fmt"
+	"receipt-mgmt/db"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// receiptSearchDocument weighs the merchant name above the line items, the items above the user's
+// notes and the notes above the rest of the OCR text. The simple configuration doesn't stem, so
+// English and French receipts are indexed alike.
+const receiptSearchDocument = `setweight(to_tsvector('simple', coalesce(receipts.merchant, '')), 'A') ||
+	setweight(to_tsvector('simple', coalesce((SELECT string_agg(receipt_items.name, ' ') FROM receipt_items
+		WHERE receipt_items.receipt_id = receipts.receipt_id), '')), 'B') ||
+	setweight(to_tsvector('simple', coalesce(receipts.notes, '')), 'C') ||
+	setweight(to_tsvector('simple', coalesce(receipts.ocr_text, '')), 'D')`
+
+// receiptSearchText is the text snippets are cut from, in the same order as the document
+const receiptSearchText = `concat_ws(' ... ', receipts.merchant, (SELECT string_agg(receipt_items.name, ', ')
+	FROM receipt_items WHERE receipt_items.receipt_id = receipts.receipt_id), receipts.notes, receipts.ocr_text)`
+
+// Snippet options: matches are wrapped in <mark> tags, with up to two fragments per receipt
+const receiptSnippetOptions = "StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=12, MinWords=4, FragmentDelimiter=\" ... \""
+
+// ReceiptSearchResult is a receipt matching a search, with its relevance and the matching text
+type ReceiptSearchResult struct {
+	Receipt
+	Rank    float64 `json:"rank"`
+	Snippet string  `json:"snippet"` // Matched words wrapped in <mark> tags
+}
+
+// receiptSearchHit is the ranked part of a result, loaded before the receipts themselves
+type receiptSearchHit struct {
+	ReceiptID uuid.UUID
+	Rank      float64
+	Snippet   string
+}
+
+// SearchReceipts ranks the user's receipts matching the query, narrowed by the list filters. The
+// query uses web search syntax: quoted phrases, "or" and -excluded words.
+func SearchReceipts(userID uuid.UUID, text string, filter ReceiptFilter, page, limit int) ([]ReceiptSearchResult, int, error) {
+	DB := db.GetDBInstance()
+
+	query := filterReceipts(DB.Model(&Receipt{}).Where("user_id = ?", userID), filter).
+		Where("search_vector @@ websearch_to_tsquery('simple', ?)", text)
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("error counting search results: %w", err)
+	}
+
+	var hits []receiptSearchHit
+	err := query.Select(
+		"receipt_id, ts_rank_cd(search_vector, websearch_to_tsquery('simple', ?)) AS rank, "+
+			"ts_headline('simple', "+receiptSearchText+", websearch_to_tsquery('simple', ?), ?) AS snippet",
+		text, text, receiptSnippetOptions,
+	).Order("rank DESC, transaction_date DESC, receipt_id").
+		Offset((page - 1) * limit).Limit(limit).
+		Scan(&hits).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("error searching receipts: %w", err)
+	}
+	if len(hits) == 0 {
+		return []ReceiptSearchResult{}, int(total), nil
+	}
+
+	ids := make([]uuid.UUID, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.ReceiptID
+	}
+	var receipts []Receipt
+	if err := DB.Omit("image", "ocr_text").Where("receipt_id IN ?", ids).Find(&receipts).Error; err != nil {
+		return nil, 0, fmt.Errorf("error loading receipts: %w", err)
+	}
+	byID := make(map[uuid.UUID]Receipt, len(receipts))
+	for _, receipt := range receipts {
+		byID[receipt.ReceiptID] = receipt
+	}
+
+	results := make([]ReceiptSearchResult, 0, len(hits))
+	for _, hit := range hits {
+		if receipt, ok := byID[hit.ReceiptID]; ok {
+			results = append(results, ReceiptSearchResult{Receipt: receipt, Rank: hit.Rank, Snippet: hit.Snippet})
+		}
+	}
+	return results, int(total), nil
+}
+
+// refreshReceiptSearch rebuilds the search document of a receipt after its merchant, items or notes change
+func refreshReceiptSearch(tx *gorm.DB, receiptID uuid.UUID) error {
+	err := tx.Model(&Receipt{}).Where("receipt_id = ?", receiptID).
+		UpdateColumn("search_vector", gorm.Expr(receiptSearchDocument)).Error
+	if err != nil {
+		return fmt.Errorf("error indexing receipt for search: %w", err)
+	}
+	return nil
+}
+
+// IndexReceiptSearch builds the search document of the receipts saved before search existed
+func IndexReceiptSearch() error {
+	DB := db.GetDBInstance()
+
+	err := DB.Model(&Receipt{}).Unscoped().Where("search_vector IS NULL").
+		UpdateColumn("search_vector", gorm.Expr(receiptSearchDocument)).Error
+	if err != nil {
+		return fmt.Errorf("error indexing receipts for search: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,367 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"receipt-mgmt/db"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ReceiptSplit is the part of a receipt filed under one category. Each split has its own expense,
+// and the split amounts add up to the receipt total.
+type ReceiptSplit struct {
+	SplitID     uuid.UUID  `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"split_id"`
+	ReceiptID   uuid.UUID  `gorm:"type:uuid;not null;index" json:"receipt_id"`
+	UserID      uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	CategoryID  uuid.UUID  `gorm:"type:uuid;not null" json:"category_id"`
+	Amount      float64    `gorm:"type:decimal(10,2);not null" json:"amount"`        // In the receipt's currency, tax included
+	ItemIDs     StringList `gorm:"type:jsonb;not null;default:'[]'" json:"item_ids"` // Line items assigned to the split, empty for a manual amount
+	Description string     `gorm:"type:varchar(255)" json:"description"`
+	ExpenseID   *uuid.UUID `gorm:"type:uuid" json:"expense_id"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+var (
+	// ErrItemInSplit is returned when removing a line item assigned to one of the receipt's splits
+	ErrItemInSplit = errors.New("the item is assigned to a split of this receipt, change or clear the split first")
+	// ErrSplitOutdated is returned when the receipt's splits can't be rebuilt after a change
+	ErrSplitOutdated = errors.New("the receipt's split no longer adds up, split the receipt again")
+)
+
+// SplitInput describes one requested split. A split gets either line items, a manual amount,
+// or neither, in which case it takes what is left of the total.
+type SplitInput struct {
+	CategoryID  uuid.UUID
+	ItemIDs     []uuid.UUID
+	Amount      *float64
+	Description string
+}
+
+// GetReceiptSplits returns the splits of a user's receipt, empty when it isn't split
+func GetReceiptSplits(receiptID, userID uuid.UUID) ([]ReceiptSplit, error) {
+	DB := db.GetDBInstance()
+
+	var splits []ReceiptSplit
+	err := DB.Where("receipt_id = ? AND user_id = ?", receiptID, userID).Order("created_at ASC, amount DESC").Find(&splits).Error
+	return splits, err
+}
+
+// BuildReceiptSplits turns the requested splits into amounts that add up to the receipt total.
+// Line items carry their share of the receipt's tax, tip and discounts, so item splits are the
+// item totals scaled to the receipt total.
+func BuildReceiptSplits(receipt *Receipt, items []ReceiptItem, inputs []SplitInput) ([]ReceiptSplit, error) {
+	if len(inputs) < 2 {
+		return nil, errors.New("a split needs at least two parts")
+	}
+
+	itemsByID := map[uuid.UUID]ReceiptItem{}
+	for _, item := range items {
+		itemsByID[item.ItemID] = item
+	}
+	itemScale := 1.0
+	if subtotal := sumItemTotals(items); subtotal > 0 {
+		itemScale = receipt.TotalAmount / subtotal
+	}
+
+	splits := make([]ReceiptSplit, len(inputs))
+	assigned := map[uuid.UUID]bool{}
+	remainder := -1
+	allocated := 0.0
+	largestItemSplit := -1
+	for i, input := range inputs {
+		split := ReceiptSplit{
+			SplitID:     uuid.New(),
+			ReceiptID:   receipt.ReceiptID,
+			UserID:      receipt.UserID,
+			CategoryID:  input.CategoryID,
+			ItemIDs:     StringList{},
+			Description: input.Description,
+		}
+
+		switch {
+		case len(input.ItemIDs) > 0 && input.Amount != nil:
+			return nil, fmt.Errorf("split %d: give either item_ids or an amount, not both", i+1)
+		case len(input.ItemIDs) > 0:
+			itemsTotal := 0.0
+			for _, itemID := range input.ItemIDs {
+				item, ok := itemsByID[itemID]
+				if !ok {
+					return nil, fmt.Errorf("split %d: item %s is not on this receipt", i+1, itemID)
+				}
+				if assigned[itemID] {
+					return nil, fmt.Errorf("split %d: item %s is already assigned to another split", i+1, itemID)
+				}
+				assigned[itemID] = true
+				itemsTotal += item.TotalPrice
+				split.ItemIDs = append(split.ItemIDs, itemID.String())
+			}
+			split.Amount = roundCents(itemsTotal * itemScale)
+			if largestItemSplit < 0 || split.Amount > splits[largestItemSplit].Amount {
+				largestItemSplit = i
+			}
+		case input.Amount != nil:
+			if *input.Amount <= 0 {
+				return nil, fmt.Errorf("split %d: amount must be positive", i+1)
+			}
+			split.Amount = roundCents(*input.Amount)
+		default:
+			if remainder >= 0 {
+				return nil, errors.New("only one split can take the remainder of the total")
+			}
+			remainder = i
+		}
+		allocated += split.Amount
+		splits[i] = split
+	}
+
+	difference := roundCents(receipt.TotalAmount - allocated)
+	switch {
+	case remainder >= 0:
+		if difference <= 0 {
+			return nil, fmt.Errorf("nothing is left of the total %.2f for the remainder split", receipt.TotalAmount)
+		}
+		splits[remainder].Amount = difference
+	case difference == 0:
+	case largestItemSplit >= 0 && math.Abs(difference) <= 0.01*float64(len(splits)):
+		// Scaling items to the total can be off by a few cents; the largest item split absorbs them
+		splits[largestItemSplit].Amount = roundCents(splits[largestItemSplit].Amount + difference)
+	default:
+		return nil, fmt.Errorf("split amounts add up to %.2f but the receipt total is %.2f", roundCents(allocated), receipt.TotalAmount)
+	}
+	return splits, nil
+}
+
+// SaveReceiptSplits replaces the receipt's splits and its expenses with one expense per split
+func SaveReceiptSplits(receipt *Receipt, splits []ReceiptSplit) error {
+	DB := db.GetDBInstance()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := deleteReceiptExpenses(tx, receipt); err != nil {
+			return err
+		}
+
+		expenses := splitExpenses(receipt, splits)
+		for i := range splits {
+			if err := tx.Create(&expenses[i]).Error; err != nil {
+				return fmt.Errorf("error creating split expense: %w", err)
+			}
+			splits[i].ExpenseID = &expenses[i].ExpenseID
+			if err := tx.Create(&splits[i]).Error; err != nil {
+				return fmt.Errorf("error creating receipt split: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// ClearReceiptSplits removes the receipt's splits and files the whole receipt under its category again
+func ClearReceiptSplits(receipt *Receipt) error {
+	DB := db.GetDBInstance()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := deleteReceiptExpenses(tx, receipt); err != nil {
+			return err
+		}
+
+		if err := tx.Create(receipt.newExpense()).Error; err != nil {
+			return fmt.Errorf("error creating expense: %w", err)
+		}
+		return nil
+	})
+}
+
+// deleteReceiptExpenses removes the receipt's splits and every expense created from the receipt
+func deleteReceiptExpenses(tx *gorm.DB, receipt *Receipt) error {
+	if err := tx.Where("receipt_id = ?", receipt.ReceiptID).Delete(&ReceiptSplit{}).Error; err != nil {
+		return fmt.Errorf("error deleting receipt splits: %w", err)
+	}
+	if err := tx.Where("receipt_id = ?", receipt.ReceiptID).Delete(&Expense{}).Error; err != nil {
+		return fmt.Errorf("error deleting receipt expenses: %w", err)
+	}
+	return nil
+}
+
+// syncSplitExpenses keeps a split receipt's expenses in line with the receipt. Splits by line item
+// are rebuilt from the current items; otherwise a changed total is spread over the splits in
+// proportion to their amounts.
+func syncSplitExpenses(tx *gorm.DB, receipt *Receipt, splits []ReceiptSplit) error {
+	if hasItemSplits(splits) {
+		if err := rebuildItemSplits(tx, receipt, splits); err != nil {
+			return err
+		}
+	} else if err := rescaleSplits(tx, receipt, splits); err != nil {
+		return err
+	}
+
+	for _, expense := range splitExpenses(receipt, splits) {
+		if err := tx.Model(&Expense{}).Where("expense_id = ?", expense.ExpenseID).Updates(map[string]interface{}{
+			"amount":      expense.Amount,
+			"category_id": expense.CategoryID,
+			"date":        expense.Date,
+			"description": expense.Description,
+			"updated_at":  time.Now(),
+		}).Error; err != nil {
+			return fmt.Errorf("error updating split expense: %w", err)
+		}
+	}
+	return nil
+}
+
+// hasItemSplits reports whether any split is made of line items
+func hasItemSplits(splits []ReceiptSplit) bool {
+	for _, split := range splits {
+		if len(split.ItemIDs) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// rebuildItemSplits recomputes the splits with BuildReceiptSplits from the receipt's current items.
+// Manual amounts are kept, except the last, which takes what is left of the total.
+func rebuildItemSplits(tx *gorm.DB, receipt *Receipt, splits []ReceiptSplit) error {
+	var items []ReceiptItem
+	if err := tx.Where("receipt_id = ?", receipt.ReceiptID).Find(&items).Error; err != nil {
+		return fmt.Errorf("error loading receipt items: %w", err)
+	}
+	if err := checkSplitItems(splits, items); err != nil {
+		return err
+	}
+
+	inputs := make([]SplitInput, len(splits))
+	lastManual := -1
+	for i, split := range splits {
+		inputs[i] = SplitInput{CategoryID: split.CategoryID, Description: split.Description}
+		if len(split.ItemIDs) == 0 {
+			amount := split.Amount
+			inputs[i].Amount = &amount
+			lastManual = i
+			continue
+		}
+		for _, id := range split.ItemIDs {
+			itemID, err := uuid.Parse(id)
+			if err != nil {
+				return fmt.Errorf("invalid split item %q: %w", id, err)
+			}
+			inputs[i].ItemIDs = append(inputs[i].ItemIDs, itemID)
+		}
+	}
+	if lastManual >= 0 {
+		inputs[lastManual].Amount = nil
+	}
+
+	rebuilt, err := BuildReceiptSplits(receipt, items, inputs)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSplitOutdated, err)
+	}
+	for i := range splits {
+		splits[i].Amount = rebuilt[i].Amount
+		splits[i].ItemIDs = rebuilt[i].ItemIDs
+		if err := tx.Model(&ReceiptSplit{}).Where("split_id = ?", splits[i].SplitID).Updates(map[string]interface{}{
+			"amount":   splits[i].Amount,
+			"item_ids": splits[i].ItemIDs,
+		}).Error; err != nil {
+			return fmt.Errorf("error updating receipt split: %w", err)
+		}
+	}
+	return nil
+}
+
+// checkSplitItems returns ErrItemInSplit when a split refers to an item that is no longer on the receipt
+func checkSplitItems(splits []ReceiptSplit, items []ReceiptItem) error {
+	onReceipt := map[string]bool{}
+	for _, item := range items {
+		onReceipt[item.ItemID.String()] = true
+	}
+	for _, split := range splits {
+		for _, id := range split.ItemIDs {
+			if !onReceipt[id] {
+				return ErrItemInSplit
+			}
+		}
+	}
+	return nil
+}
+
+// rescaleSplits spreads a changed total over the splits in proportion to their amounts
+func rescaleSplits(tx *gorm.DB, receipt *Receipt, splits []ReceiptSplit) error {
+	allocated := 0.0
+	for _, split := range splits {
+		allocated += split.Amount
+	}
+	if roundCents(allocated) != roundCents(receipt.TotalAmount) {
+		rescaled := 0.0
+		for i := range splits {
+			amount := roundCents(receipt.TotalAmount / float64(len(splits)))
+			if allocated != 0 {
+				amount = roundCents(receipt.TotalAmount * splits[i].Amount / allocated)
+			}
+			if i == len(splits)-1 {
+				// The last split absorbs the rounding
+				amount = roundCents(receipt.TotalAmount - rescaled)
+			}
+			rescaled += amount
+			splits[i].Amount = amount
+			if err := tx.Model(&ReceiptSplit{}).Where("split_id = ?", splits[i].SplitID).
+				Update("amount", amount).Error; err != nil {
+				return fmt.Errorf("error updating receipt split: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// splitExpenses builds the expense of each split. The receipt's expense amount, converted and
+// signed, is shared in proportion to the split amounts, so the expenses add up to it exactly.
+func splitExpenses(receipt *Receipt, splits []ReceiptSplit) []Expense {
+	total := receipt.ExpenseAmount()
+	expenses := make([]Expense, len(splits))
+	allocated := 0.0
+	for i, split := range splits {
+		amount := 0.0
+		if receipt.TotalAmount != 0 {
+			amount = roundCents(total * split.Amount / receipt.TotalAmount)
+		}
+		if i == len(splits)-1 {
+			// The last split absorbs the rounding
+			amount = roundCents(total - allocated)
+		}
+		allocated += amount
+
+		description := receipt.ExpenseDescription()
+		if split.Description != "" {
+			description = fmt.Sprintf("%s (%s)", description, split.Description)
+		}
+
+		expenseID := uuid.New()
+		if split.ExpenseID != nil {
+			expenseID = *split.ExpenseID
+		}
+		expenses[i] = Expense{
+			ExpenseID:   expenseID,
+			UserID:      receipt.UserID,
+			CategoryID:  split.CategoryID,
+			Amount:      amount,
+			Date:        receipt.expenseDate(),
+			Description: description,
+			ReceiptID:   &receipt.ReceiptID,
+		}
+	}
+	return expenses
+}
+
+// expenseDate is the date recorded on the receipt's expenses, the scan date when the transaction date is unknown
+func (r *Receipt) expenseDate() time.Time {
+	if date, ok := r.TransactionDateTime(); ok {
+		return date
+	}
+	if !r.ScannedDate.IsZero() {
+		return r.ScannedDate
+	}
+	return time.Now()
+}
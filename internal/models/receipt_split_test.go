@@ -0,0 +1,169 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestBuildReceiptSplits(t *testing.T) {
+	groceries, household := uuid.New(), uuid.New()
+	milk := ReceiptItem{ItemID: uuid.New(), Name: "MILK", TotalPrice: 6}
+	bread := ReceiptItem{ItemID: uuid.New(), Name: "BREAD", TotalPrice: 4}
+	soap := ReceiptItem{ItemID: uuid.New(), Name: "SOAP", TotalPrice: 10}
+	items := []ReceiptItem{milk, bread, soap}
+	amount := func(value float64) *float64 { return &value }
+
+	tests := []struct {
+		name    string
+		total   float64
+		inputs  []SplitInput
+		want    []float64
+		wantErr bool
+	}{
+		{
+			name:  "items carry their share of the tax",
+			total: 22.60,
+			inputs: []SplitInput{
+				{CategoryID: groceries, ItemIDs: []uuid.UUID{milk.ItemID, bread.ItemID}},
+				{CategoryID: household, ItemIDs: []uuid.UUID{soap.ItemID}},
+			},
+			want: []float64{11.30, 11.30},
+		},
+		{
+			name:  "items scaled to the total",
+			total: 21.00,
+			inputs: []SplitInput{
+				{CategoryID: groceries, ItemIDs: []uuid.UUID{milk.ItemID}},
+				{CategoryID: groceries, ItemIDs: []uuid.UUID{bread.ItemID}},
+				{CategoryID: household, ItemIDs: []uuid.UUID{soap.ItemID}},
+			},
+			want: []float64{6.30, 4.20, 10.50},
+		},
+		{
+			name:  "remainder takes what the others leave",
+			total: 22.60,
+			inputs: []SplitInput{
+				{CategoryID: household, Amount: amount(5)},
+				{CategoryID: groceries},
+			},
+			want: []float64{5, 17.60},
+		},
+		{
+			name:  "items and a remainder",
+			total: 22.60,
+			inputs: []SplitInput{
+				{CategoryID: household, ItemIDs: []uuid.UUID{soap.ItemID}},
+				{CategoryID: groceries},
+			},
+			want: []float64{11.30, 11.30},
+		},
+		{
+			name:    "a single part",
+			total:   22.60,
+			inputs:  []SplitInput{{CategoryID: groceries}},
+			wantErr: true,
+		},
+		{
+			name:  "an item in two splits",
+			total: 22.60,
+			inputs: []SplitInput{
+				{CategoryID: groceries, ItemIDs: []uuid.UUID{milk.ItemID}},
+				{CategoryID: household, ItemIDs: []uuid.UUID{milk.ItemID, soap.ItemID}},
+			},
+			wantErr: true,
+		},
+		{
+			name:  "an item from another receipt",
+			total: 22.60,
+			inputs: []SplitInput{
+				{CategoryID: groceries, ItemIDs: []uuid.UUID{uuid.New()}},
+				{CategoryID: household},
+			},
+			wantErr: true,
+		},
+		{
+			name:  "items and an amount in one split",
+			total: 22.60,
+			inputs: []SplitInput{
+				{CategoryID: groceries, ItemIDs: []uuid.UUID{milk.ItemID}, Amount: amount(3)},
+				{CategoryID: household},
+			},
+			wantErr: true,
+		},
+		{
+			name:  "two remainders",
+			total: 22.60,
+			inputs: []SplitInput{
+				{CategoryID: groceries},
+				{CategoryID: household},
+			},
+			wantErr: true,
+		},
+		{
+			name:  "amounts short of the total",
+			total: 22.60,
+			inputs: []SplitInput{
+				{CategoryID: groceries, Amount: amount(10)},
+				{CategoryID: household, Amount: amount(10)},
+			},
+			wantErr: true,
+		},
+		{
+			name:  "nothing left for the remainder",
+			total: 22.60,
+			inputs: []SplitInput{
+				{CategoryID: groceries, Amount: amount(22.60)},
+				{CategoryID: household},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receipt := &Receipt{ReceiptID: uuid.New(), UserID: uuid.New(), TotalAmount: tt.total}
+			splits, err := BuildReceiptSplits(receipt, items, tt.inputs)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("BuildReceiptSplits() = %+v; want an error", splits)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BuildReceiptSplits() error = %v", err)
+			}
+
+			got := make([]float64, len(splits))
+			for i, split := range splits {
+				got[i] = split.Amount
+				if split.ReceiptID != receipt.ReceiptID || split.CategoryID != tt.inputs[i].CategoryID {
+					t.Errorf("split %d = %+v; not tied to the receipt and its category", i, split)
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("amounts = %v; want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("amounts = %v; want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestCheckSplitItems(t *testing.T) {
+	kept, removed := uuid.New(), uuid.New()
+	items := []ReceiptItem{{ItemID: kept}}
+
+	splits := []ReceiptSplit{{ItemIDs: StringList{kept.String()}}, {}}
+	if err := checkSplitItems(splits, items); err != nil {
+		t.Errorf("checkSplitItems() = %v; want nil", err)
+	}
+	splits = append(splits, ReceiptSplit{ItemIDs: StringList{removed.String()}})
+	if err := checkSplitItems(splits, items); err != ErrItemInSplit {
+		t.Errorf("checkSplitItems() = %v; want ErrItemInSplit", err)
+	}
+}
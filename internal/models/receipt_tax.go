@@ -0,0 +1,71 @@
+package models
+
+import (
+	"fmt"
+	"receipt-mgmt/db"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ReceiptTax represents a single sales tax component (GST, HST, PST or QST) charged on a receipt
+type ReceiptTax struct {
+	TaxID     uuid.UUID `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"tax_id"`
+	ReceiptID uuid.UUID `gorm:"type:uuid;not null;index" json:"receipt_id"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
+	Type      string    `gorm:"type:varchar(10);not null" json:"type"` // GST, HST, PST or QST
+	Rate      float64   `gorm:"type:decimal(6,3)" json:"rate"`         // Percentage, e.g. 9.975
+	Amount    float64   `gorm:"type:decimal(10,2);not null" json:"amount"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TaxPeriodSummary holds the tax paid by component over one reporting period
+type TaxPeriodSummary struct {
+	Period          string  `json:"period"` // First day of the period (YYYY-MM-DD)
+	GST             float64 `json:"gst"`
+	HST             float64 `json:"hst"`
+	PST             float64 `json:"pst"`
+	QST             float64 `json:"qst"`
+	InputTaxCredits float64 `json:"input_tax_credits"` // GST + HST, claimable by registrants
+	ReceiptCount    int     `json:"receipt_count"`
+}
+
+// TaxSummaryPeriods are the supported reporting periods for the tax summary
+var TaxSummaryPeriods = map[string]bool{"month": true, "quarter": true, "year": true}
+
+// GetTaxSummary totals the user's tax components per period between the given dates
+func GetTaxSummary(userID uuid.UUID, fromDate, toDate, period string) ([]TaxPeriodSummary, error) {
+	if !TaxSummaryPeriods[period] {
+		return nil, fmt.Errorf("unsupported period: %s", period)
+	}
+
+	DB := db.GetDBInstance()
+
+	// Taxes on refunds are given back, so they count against the period
+	signedAmount := fmt.Sprintf("CASE WHEN receipts.type = '%s' THEN -receipt_taxes.amount ELSE receipt_taxes.amount END", ReceiptTypeRefund)
+
+	// period is validated above, so it is safe to place in the query
+	periodExpr := fmt.Sprintf("to_char(date_trunc('%s', receipts.transaction_date::date), 'YYYY-MM-DD')", period)
+
+	query := DB.Table("receipt_taxes").
+		Select(fmt.Sprintf(`%[1]s AS period,
+			COALESCE(SUM(CASE WHEN receipt_taxes.type = 'GST' THEN %[2]s END), 0) AS gst,
+			COALESCE(SUM(CASE WHEN receipt_taxes.type = 'HST' THEN %[2]s END), 0) AS hst,
+			COALESCE(SUM(CASE WHEN receipt_taxes.type = 'PST' THEN %[2]s END), 0) AS pst,
+			COALESCE(SUM(CASE WHEN receipt_taxes.type = 'QST' THEN %[2]s END), 0) AS qst,
+			COALESCE(SUM(CASE WHEN receipt_taxes.type IN ('GST', 'HST') THEN %[2]s END), 0) AS input_tax_credits,
+			COUNT(DISTINCT receipt_taxes.receipt_id) AS receipt_count`, periodExpr, signedAmount)).
+		Joins("JOIN receipts ON receipts.receipt_id = receipt_taxes.receipt_id AND receipts.deleted_at IS NULL").
+		Where("receipt_taxes.user_id = ? AND receipts.transaction_date ~ '^\\d{4}-\\d{2}-\\d{2}$'", userID)
+
+	if fromDate != "" {
+		query = query.Where("receipts.transaction_date >= ?", fromDate)
+	}
+	if toDate != "" {
+		query = query.Where("receipts.transaction_date <= ?", toDate)
+	}
+
+	var summary []TaxPeriodSummary
+	err := query.Group("period").Order("period ASC").Scan(&summary).Error
+	return summary, err
+}
@@ -0,0 +1,58 @@
+package models
+
+import "math"
+
+// Receipt processing statuses
+const (
+	ReceiptStatusCompleted   = "completed"
+	ReceiptStatusNeedsReview = "needs_review" // Extracted amounts don't add up, or couldn't be converted, and should be checked by the user
+)
+
+// TotalsTolerance is the largest gap between the derived and printed totals still treated as consistent
+const TotalsTolerance = 0.05
+
+// Reconcile checks that sum(items) + tax + tip - discounts adds up to TotalAmount.
+// It stores the items subtotal and the discrepancy, and marks inconsistent receipts for review.
+// The printed subtotal stands in for the items when none were extracted.
+func (r *Receipt) Reconcile(items []ReceiptItem) {
+	r.ItemsSubtotal = sumItemTotals(items)
+
+	base := r.ItemsSubtotal
+	if len(items) == 0 {
+		base = r.Subtotal
+	}
+
+	// Nothing to check the total against
+	if base == 0 {
+		r.Discrepancy = 0
+		r.TotalsMismatch = false
+	} else {
+		r.Discrepancy = roundCents(r.TotalAmount - r.derivedTotal(base))
+		r.TotalsMismatch = math.Abs(r.Discrepancy) > TotalsTolerance
+	}
+
+	if r.TotalsMismatch || r.MissingExchangeRate() {
+		r.Status = ReceiptStatusNeedsReview
+	} else if r.Status == ReceiptStatusNeedsReview {
+		r.Status = ReceiptStatusCompleted
+	}
+}
+
+// derivedTotal computes the total implied by the given subtotal and the receipt's tax, tip and discounts
+func (r *Receipt) derivedTotal(subtotal float64) float64 {
+	return subtotal + r.Tax + r.Tip - math.Abs(r.Discounts)
+}
+
+// sumItemTotals adds up the total price of every item
+func sumItemTotals(items []ReceiptItem) float64 {
+	subtotal := 0.0
+	for _, item := range items {
+		subtotal += item.TotalPrice
+	}
+	return roundCents(subtotal)
+}
+
+// roundCents rounds an amount to two decimal places
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
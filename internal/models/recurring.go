@@ -0,0 +1,500 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"receipt-mgmt/db"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Statuses of a recurring series
+const (
+	RecurringDetected  = "detected"  // Found by the analyzer, not yet reviewed
+	RecurringConfirmed = "confirmed" // The user agrees it is a recurring charge
+	RecurringDismissed = "dismissed" // The user says it isn't; detection won't bring it back
+)
+
+const (
+	// RecurringMinConfidence is the confidence a series needs to be reported
+	RecurringMinConfidence = 0.7
+	// RecurringAmountSpread is how far, as a share, an amount may be from the others of its cluster
+	RecurringAmountSpread = 0.2
+	// RecurringPriceChange is the change from the previous amount, as a share, flagged as a new price
+	RecurringPriceChange = 0.02
+)
+
+// recurringFrequency describes how often a series repeats and how much slack it gets
+type recurringFrequency struct {
+	name           string
+	days           float64 // Typical number of days between occurrences
+	toleranceDays  float64
+	perYear        float64
+	minOccurrences int
+	next           func(time.Time) time.Time
+}
+
+var recurringFrequencies = []recurringFrequency{
+	{"weekly", 7, 2, 52, 3, func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }},
+	{"biweekly", 14, 3, 26, 3, func(t time.Time) time.Time { return t.AddDate(0, 0, 14) }},
+	{"monthly", 30.44, 5, 12, 3, func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+	{"quarterly", 91.31, 10, 4, 3, func(t time.Time) time.Time { return t.AddDate(0, 3, 0) }},
+	{"annual", 365.25, 20, 1, 2, func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }},
+}
+
+// RecurringSeries is a charge that comes back at a regular interval at one merchant for a similar
+// amount, such as a subscription, a membership or a weekly purchase
+type RecurringSeries struct {
+	SeriesID         uuid.UUID  `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"series_id"`
+	UserID           uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_recurring_series_key" json:"user_id"`
+	SeriesKey        string     `gorm:"type:varchar(300);not null;uniqueIndex:idx_recurring_series_key" json:"-"` // Merchant and frequency, stable across detections
+	MerchantID       *uuid.UUID `gorm:"type:uuid;index" json:"merchant_id"`
+	Name             string     `gorm:"type:varchar(255);not null" json:"name"`
+	CategoryID       uuid.UUID  `gorm:"type:uuid" json:"category_id"`               // Category of the latest occurrence
+	Frequency        string     `gorm:"type:varchar(10);not null" json:"frequency"` // weekly, biweekly, monthly, quarterly or annual
+	Amount           float64    `gorm:"type:decimal(10,2)" json:"amount"`           // Latest amount, the current price
+	AverageAmount    float64    `gorm:"type:decimal(10,2)" json:"average_amount"`
+	AnnualizedCost   float64    `gorm:"type:decimal(10,2)" json:"annualized_cost"`
+	Occurrences      int        `json:"occurrences"`
+	FirstDate        time.Time  `gorm:"type:date" json:"first_date"`
+	LastDate         time.Time  `gorm:"type:date" json:"last_date"`
+	NextExpectedDate time.Time  `gorm:"type:date" json:"next_expected_date"`
+	Confidence       float64    `gorm:"type:decimal(5,4)" json:"confidence"`
+	Status           string     `gorm:"type:varchar(10);not null;default:'detected';index" json:"status"`
+	PriceChanged     bool       `gorm:"default:false" json:"price_changed"` // The latest amount differs from the one before
+	PreviousAmount   float64    `gorm:"type:decimal(10,2)" json:"previous_amount"`
+	Missed           bool       `gorm:"-" json:"missed"`                                     // The next occurrence is overdue
+	MissedCount      int        `gorm:"-" json:"missed_count"`                               // Occurrences expected since the last one
+	ExpenseIDs       StringList `gorm:"type:jsonb;not null;default:'[]'" json:"expense_ids"` // Expenses of the occurrences, oldest first
+	DetectedAt       time.Time  `json:"detected_at"`
+	CreatedAt        time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt        time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// recurringOccurrence is one purchase, possibly spread over several expenses of a split receipt
+type recurringOccurrence struct {
+	date       time.Time
+	amount     float64
+	categoryID uuid.UUID
+	expenseIDs []string
+}
+
+// recurringGroup is the purchases at one merchant
+type recurringGroup struct {
+	key         string
+	merchantID  *uuid.UUID
+	name        string
+	occurrences []recurringOccurrence
+}
+
+// GetRecurringSeries returns the user's recurring series, dearest first. Dismissed series are only
+// returned when asked for by status.
+func GetRecurringSeries(userID uuid.UUID, status string) ([]RecurringSeries, error) {
+	DB := db.GetDBInstance()
+
+	query := DB.Where("user_id = ?", userID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	} else {
+		query = query.Where("status <> ?", RecurringDismissed)
+	}
+
+	var series []RecurringSeries
+	if err := query.Order("annualized_cost DESC, name ASC").Find(&series).Error; err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for i := range series {
+		series[i].checkMissed(now)
+	}
+	return series, nil
+}
+
+// GetRecurringSeriesByID returns one of the user's recurring series
+func GetRecurringSeriesByID(seriesID, userID uuid.UUID) (*RecurringSeries, error) {
+	DB := db.GetDBInstance()
+
+	var series RecurringSeries
+	if err := DB.Where("series_id = ? AND user_id = ?", seriesID, userID).First(&series).Error; err != nil {
+		return nil, err
+	}
+	series.checkMissed(time.Now())
+	return &series, nil
+}
+
+// GetRecurringOccurrences returns the expenses of the series' occurrences, oldest first
+func GetRecurringOccurrences(series *RecurringSeries) ([]Expense, error) {
+	DB := db.GetDBInstance()
+
+	expenses := []Expense{}
+	if len(series.ExpenseIDs) == 0 {
+		return expenses, nil
+	}
+	err := DB.Where("user_id = ? AND expense_id IN ?", series.UserID, []string(series.ExpenseIDs)).
+		Order("date ASC").Find(&expenses).Error
+	return expenses, err
+}
+
+// SetRecurringStatus confirms or dismisses a series
+func SetRecurringStatus(series *RecurringSeries, status string) error {
+	DB := db.GetDBInstance()
+
+	series.Status = status
+	series.UpdatedAt = time.Now()
+	if err := DB.Model(&RecurringSeries{}).Where("series_id = ?", series.SeriesID).Updates(map[string]interface{}{
+		"status":     status,
+		"updated_at": series.UpdatedAt,
+	}).Error; err != nil {
+		return fmt.Errorf("error updating recurring series: %w", err)
+	}
+	return nil
+}
+
+// DetectRecurringSeries analyzes the user's expenses for charges that repeat at a regular interval
+// for a similar amount and saves what it finds. Series the user confirmed or dismissed keep their
+// status; detected series that no longer hold up are removed.
+func DetectRecurringSeries(userID uuid.UUID) error {
+	return detectRecurringSeries(userID, nil)
+}
+
+// DetectMerchantRecurringSeries runs the detection on the user's purchases at one canonical merchant
+// only, so a new receipt doesn't make the whole history be analyzed again
+func DetectMerchantRecurringSeries(userID, merchantID uuid.UUID) error {
+	return detectRecurringSeries(userID, &merchantID)
+}
+
+// detectRecurringSeries analyzes the user's purchases, at one merchant when merchantID is set
+func detectRecurringSeries(userID uuid.UUID, merchantID *uuid.UUID) error {
+	DB := db.GetDBInstance()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		groups, err := loadRecurringGroups(tx, userID, merchantID)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		found := map[string]bool{}
+		for _, group := range groups {
+			for _, series := range analyzeRecurringGroup(group) {
+				series.UserID = userID
+				series.DetectedAt = now
+				found[series.SeriesKey] = true
+
+				var existing RecurringSeries
+				err := tx.Where("user_id = ? AND series_key = ?", userID, series.SeriesKey).First(&existing).Error
+				if err == nil {
+					series.SeriesID = existing.SeriesID
+					series.Status = existing.Status
+					series.CreatedAt = existing.CreatedAt
+				} else if errors.Is(err, gorm.ErrRecordNotFound) {
+					series.SeriesID = uuid.New()
+					series.Status = RecurringDetected
+				} else {
+					return fmt.Errorf("error loading recurring series: %w", err)
+				}
+				if err := tx.Save(&series).Error; err != nil {
+					return fmt.Errorf("error saving recurring series: %w", err)
+				}
+			}
+		}
+
+		keys := make([]string, 0, len(found))
+		for key := range found {
+			keys = append(keys, key)
+		}
+		query := tx.Where("user_id = ? AND status = ?", userID, RecurringDetected)
+		if merchantID != nil {
+			query = query.Where("series_key LIKE ?", "merchant:"+merchantID.String()+"|%")
+		}
+		if len(keys) > 0 {
+			query = query.Where("series_key NOT IN ?", keys)
+		}
+		if err := query.Delete(&RecurringSeries{}).Error; err != nil {
+			return fmt.Errorf("error removing stale recurring series: %w", err)
+		}
+		return nil
+	})
+}
+
+// loadRecurringGroups gathers the user's purchases by merchant: the canonical merchant for receipt
+// expenses, the normalized description for expenses logged by hand. Only the receipts at the
+// merchant are loaded when merchantID is set.
+func loadRecurringGroups(tx *gorm.DB, userID uuid.UUID, merchantID *uuid.UUID) ([]*recurringGroup, error) {
+	var rows []struct {
+		ExpenseID     uuid.UUID
+		Amount        float64
+		Date          time.Time
+		Description   string
+		CategoryID    uuid.UUID
+		ReceiptID     *uuid.UUID
+		MerchantID    *uuid.UUID
+		CanonicalName *string
+	}
+	query := tx.Table("expenses")
+	if merchantID != nil {
+		query = query.Where("receipts.merchant_id = ?", *merchantID)
+	}
+	if err := query.
+		Select("expenses.expense_id, expenses.amount, expenses.date, expenses.description, expenses.category_id, "+
+			"expenses.receipt_id, receipts.merchant_id, merchants.canonical_name").
+		Joins("LEFT JOIN receipts ON receipts.receipt_id = expenses.receipt_id AND receipts.deleted_at IS NULL").
+		Joins("LEFT JOIN merchants ON merchants.merchant_id = receipts.merchant_id").
+		Where("expenses.user_id = ? AND expenses.amount > 0", userID).
+		Order("expenses.date ASC").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("error loading expenses: %w", err)
+	}
+
+	groups := map[string]*recurringGroup{}
+	order := []string{}
+	// The expenses of a split receipt are one purchase
+	type receiptOccurrence struct {
+		group *recurringGroup
+		index int
+	}
+	byReceipt := map[uuid.UUID]receiptOccurrence{}
+	for _, row := range rows {
+		key, name, ok := merchantGroup(row.MerchantID, row.CanonicalName, strings.TrimPrefix(row.Description, "Expense from receipt:"))
+		if !ok {
+			continue
+		}
+
+		group := groups[key]
+		if group == nil {
+			group = &recurringGroup{key: key, merchantID: row.MerchantID, name: name}
+			groups[key] = group
+			order = append(order, key)
+		}
+
+		if row.ReceiptID != nil {
+			if seen, ok := byReceipt[*row.ReceiptID]; ok {
+				occurrence := &seen.group.occurrences[seen.index]
+				occurrence.amount += row.Amount
+				occurrence.expenseIDs = append(occurrence.expenseIDs, row.ExpenseID.String())
+				continue
+			}
+		}
+		group.occurrences = append(group.occurrences, recurringOccurrence{
+			date:       row.Date,
+			amount:     row.Amount,
+			categoryID: row.CategoryID,
+			expenseIDs: []string{row.ExpenseID.String()},
+		})
+		if row.ReceiptID != nil {
+			byReceipt[*row.ReceiptID] = receiptOccurrence{group: group, index: len(group.occurrences) - 1}
+		}
+	}
+
+	result := make([]*recurringGroup, 0, len(order))
+	for _, key := range order {
+		result = append(result, groups[key])
+	}
+	return result, nil
+}
+
+// analyzeRecurringGroup looks for series among a merchant's purchases. Purchases are first
+// clustered by amount, so a subscription stands out from other shopping at the same merchant.
+// Clusters that follow each other in time are then chained, so a price change, however large,
+// continues its series: amounts only tell series apart when their purchases overlap in time.
+// Each chain is tested against the known frequencies.
+func analyzeRecurringGroup(group *recurringGroup) []RecurringSeries {
+	byAmount := append([]recurringOccurrence(nil), group.occurrences...)
+	sort.SliceStable(byAmount, func(i, j int) bool { return byAmount[i].amount < byAmount[j].amount })
+
+	clusters := [][]recurringOccurrence{}
+	for _, occurrence := range byAmount {
+		last := len(clusters) - 1
+		if last >= 0 && occurrence.amount <= clusters[last][0].amount*(1+RecurringAmountSpread) {
+			clusters[last] = append(clusters[last], occurrence)
+			continue
+		}
+		clusters = append(clusters, []recurringOccurrence{occurrence})
+	}
+
+	for i, cluster := range clusters {
+		sort.SliceStable(cluster, func(i, j int) bool { return cluster[i].date.Before(cluster[j].date) })
+		clusters[i] = mergeSameDay(cluster)
+	}
+
+	found := map[string]RecurringSeries{}
+	for _, chain := range chainRecurringClusters(clusters) {
+		series, ok := recurringSeriesOf(group, chain)
+		if !ok {
+			continue
+		}
+		// One series per merchant and frequency, the most convincing one
+		if current, exists := found[series.SeriesKey]; !exists || series.Confidence > current.Confidence {
+			found[series.SeriesKey] = series
+		}
+	}
+
+	series := make([]RecurringSeries, 0, len(found))
+	for _, s := range found {
+		series = append(series, s)
+	}
+	sort.Slice(series, func(i, j int) bool { return series[i].SeriesKey < series[j].SeriesKey })
+	return series
+}
+
+// chainRecurringClusters joins the dated amount clusters that follow each other in time. A cluster
+// that starts after the last purchase of a chain of at least two purchases continues it, so one-off
+// purchases of different amounts aren't strung together; when several chains could take it, the
+// one whose latest amount is closest goes on. Clusters that overlap in time stay apart.
+func chainRecurringClusters(clusters [][]recurringOccurrence) [][]recurringOccurrence {
+	byStart := append([][]recurringOccurrence(nil), clusters...)
+	sort.SliceStable(byStart, func(i, j int) bool { return byStart[i][0].date.Before(byStart[j][0].date) })
+
+	chains := [][]recurringOccurrence{}
+	for _, cluster := range byStart {
+		start, best := cluster[0], -1
+		for i, chain := range chains {
+			latest := chain[len(chain)-1]
+			if len(chain) < 2 || latest.date.Format("2006-01-02") >= start.date.Format("2006-01-02") {
+				continue
+			}
+			if best < 0 || amountRatio(latest.amount, start.amount) < amountRatio(chains[best][len(chains[best])-1].amount, start.amount) {
+				best = i
+			}
+		}
+		if best < 0 {
+			chains = append(chains, append([]recurringOccurrence(nil), cluster...))
+			continue
+		}
+		chains[best] = append(chains[best], cluster...)
+	}
+	return chains
+}
+
+// amountRatio returns how many times the larger amount is the smaller one
+func amountRatio(a, b float64) float64 {
+	if a <= 0 || b <= 0 {
+		return math.Inf(1)
+	}
+	return math.Max(a, b) / math.Min(a, b)
+}
+
+// mergeSameDay combines purchases made on the same day into one occurrence
+func mergeSameDay(occurrences []recurringOccurrence) []recurringOccurrence {
+	merged := []recurringOccurrence{}
+	for _, occurrence := range occurrences {
+		last := len(merged) - 1
+		if last >= 0 && merged[last].date.Format("2006-01-02") == occurrence.date.Format("2006-01-02") {
+			merged[last].amount += occurrence.amount
+			merged[last].expenseIDs = append(merged[last].expenseIDs, occurrence.expenseIDs...)
+			continue
+		}
+		merged = append(merged, occurrence)
+	}
+	return merged
+}
+
+// recurringSeriesOf tests whether the dated occurrences repeat at one of the known frequencies
+func recurringSeriesOf(group *recurringGroup, occurrences []recurringOccurrence) (RecurringSeries, bool) {
+	if len(occurrences) < 2 {
+		return RecurringSeries{}, false
+	}
+
+	intervals := make([]float64, 0, len(occurrences)-1)
+	for i := 1; i < len(occurrences); i++ {
+		intervals = append(intervals, occurrences[i].date.Sub(occurrences[i-1].date).Hours()/24)
+	}
+	median := medianOf(intervals)
+
+	for _, frequency := range recurringFrequencies {
+		if len(occurrences) < frequency.minOccurrences || math.Abs(median-frequency.days) > frequency.toleranceDays {
+			continue
+		}
+
+		// A skipped occurrence leaves a double interval, which counts for half
+		regularity := 0.0
+		for _, interval := range intervals {
+			if math.Abs(interval-frequency.days) <= frequency.toleranceDays {
+				regularity++
+			} else if math.Abs(interval-2*frequency.days) <= frequency.toleranceDays {
+				regularity += 0.5
+			}
+		}
+		regularity /= float64(len(intervals))
+
+		amounts := make([]float64, len(occurrences))
+		total := 0.0
+		for i, occurrence := range occurrences {
+			amounts[i] = occurrence.amount
+			total += occurrence.amount
+		}
+		average := total / float64(len(amounts))
+		variance := 0.0
+		for _, amount := range amounts {
+			variance += (amount - average) * (amount - average)
+		}
+		similarity := math.Max(0, 1-math.Sqrt(variance/float64(len(amounts)))/average)
+
+		confidence := roundConfidence(0.6*regularity + 0.4*similarity)
+		if confidence < RecurringMinConfidence {
+			return RecurringSeries{}, false
+		}
+
+		first, latest := occurrences[0], occurrences[len(occurrences)-1]
+		series := RecurringSeries{
+			SeriesKey:        group.key + "|" + frequency.name,
+			MerchantID:       group.merchantID,
+			Name:             group.name,
+			CategoryID:       latest.categoryID,
+			Frequency:        frequency.name,
+			Amount:           roundCents(latest.amount),
+			AverageAmount:    roundCents(average),
+			AnnualizedCost:   roundCents(latest.amount * frequency.perYear),
+			Occurrences:      len(occurrences),
+			FirstDate:        first.date,
+			LastDate:         latest.date,
+			NextExpectedDate: frequency.next(latest.date),
+			Confidence:       confidence,
+			ExpenseIDs:       StringList{},
+		}
+		previous := occurrences[len(occurrences)-2]
+		if math.Abs(latest.amount-previous.amount) > previous.amount*RecurringPriceChange {
+			series.PriceChanged = true
+			series.PreviousAmount = roundCents(previous.amount)
+		}
+		for _, occurrence := range occurrences {
+			series.ExpenseIDs = append(series.ExpenseIDs, occurrence.expenseIDs...)
+		}
+		return series, true
+	}
+	return RecurringSeries{}, false
+}
+
+// checkMissed flags a series whose next occurrence is overdue and counts the occurrences missed
+func (s *RecurringSeries) checkMissed(now time.Time) {
+	s.Missed, s.MissedCount = false, 0
+	if s.Status == RecurringDismissed {
+		return
+	}
+	for _, frequency := range recurringFrequencies {
+		if frequency.name != s.Frequency {
+			continue
+		}
+		grace := time.Duration(frequency.toleranceDays*24) * time.Hour
+		for expected := s.NextExpectedDate; now.After(expected.Add(grace)); expected = frequency.next(expected) {
+			s.Missed = true
+			s.MissedCount++
+		}
+	}
+}
+
+// medianOf returns the median of the values
+func medianOf(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
@@ -0,0 +1,155 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+// monthlyOccurrences returns one purchase a month from the date, one per amount
+func monthlyOccurrences(from time.Time, amounts ...float64) []recurringOccurrence {
+	occurrences := make([]recurringOccurrence, len(amounts))
+	for i, amount := range amounts {
+		occurrences[i] = recurringOccurrence{date: from.AddDate(0, i, 0), amount: amount}
+	}
+	return occurrences
+}
+
+// weeklyOccurrences returns one purchase a week from the date, one per amount
+func weeklyOccurrences(from time.Time, amounts ...float64) []recurringOccurrence {
+	occurrences := make([]recurringOccurrence, len(amounts))
+	for i, amount := range amounts {
+		occurrences[i] = recurringOccurrence{date: from.AddDate(0, 0, 7*i), amount: amount}
+	}
+	return occurrences
+}
+
+func TestAnalyzeRecurringGroup(t *testing.T) {
+	january := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	type wantSeries struct {
+		frequency      string
+		occurrences    int
+		amount         float64
+		priceChanged   bool
+		previousAmount float64
+	}
+	tests := []struct {
+		name        string
+		occurrences []recurringOccurrence
+		want        []wantSeries
+	}{
+		{
+			name:        "steady subscription",
+			occurrences: monthlyOccurrences(january, 9.99, 9.99, 9.99, 9.99),
+			want:        []wantSeries{{"monthly", 4, 9.99, false, 0}},
+		},
+		{
+			name:        "price rise of more than the amount spread",
+			occurrences: monthlyOccurrences(january, 9.99, 9.99, 9.99, 9.99, 12.99),
+			want:        []wantSeries{{"monthly", 5, 12.99, true, 9.99}},
+		},
+		{
+			name:        "price drop",
+			occurrences: monthlyOccurrences(january, 20, 20, 20, 20, 20, 14),
+			want:        []wantSeries{{"monthly", 6, 14, true, 20}},
+		},
+		{
+			name: "subscription next to weekly shopping",
+			occurrences: append(monthlyOccurrences(january.AddDate(0, 0, 3), 15, 15, 15),
+				weeklyOccurrences(january, 84, 91, 88, 80, 86, 90, 83, 87, 92, 89, 85, 85)...),
+			want: []wantSeries{{"monthly", 3, 15, false, 0}, {"weekly", 12, 85, false, 0}},
+		},
+		{
+			name: "one-off purchases of different amounts",
+			occurrences: []recurringOccurrence{
+				{date: january, amount: 40},
+				{date: january.AddDate(0, 1, 0), amount: 55},
+				{date: january.AddDate(0, 2, 0), amount: 70},
+			},
+			want: nil,
+		},
+		{
+			name: "irregular purchases",
+			occurrences: []recurringOccurrence{
+				{date: january, amount: 25},
+				{date: january.AddDate(0, 0, 3), amount: 25},
+				{date: january.AddDate(0, 2, 1), amount: 25},
+				{date: january.AddDate(0, 2, 9), amount: 25},
+			},
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := analyzeRecurringGroup(&recurringGroup{key: "name:STREAMFLIX", name: "Streamflix", occurrences: tt.occurrences})
+			if len(got) != len(tt.want) {
+				t.Fatalf("analyzeRecurringGroup() = %d series; want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i, want := range tt.want {
+				series := got[i]
+				if series.Frequency != want.frequency || series.Occurrences != want.occurrences || series.Amount != want.amount ||
+					series.PriceChanged != want.priceChanged || series.PreviousAmount != want.previousAmount {
+					t.Errorf("analyzeRecurringGroup() series %d = %s, %d occurrences, %v, price changed %v from %v; want %+v", i,
+						series.Frequency, series.Occurrences, series.Amount, series.PriceChanged, series.PreviousAmount, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRecurringSeriesOf(t *testing.T) {
+	january := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	group := &recurringGroup{key: "name:GYM", name: "Gym"}
+
+	tests := []struct {
+		name           string
+		occurrences    []recurringOccurrence
+		wantOK         bool
+		wantFrequency  string
+		wantConfidence float64
+		wantNext       string
+	}{
+		{"weekly", weeklyOccurrences(january, 12, 12, 12), true, "weekly", 1, "2024-02-05"},
+		{"monthly", monthlyOccurrences(january, 50, 50, 50, 50), true, "monthly", 1, "2024-05-15"},
+		{
+			name: "skipped month counts for half",
+			occurrences: []recurringOccurrence{
+				{date: january, amount: 50},
+				{date: january.AddDate(0, 1, 0), amount: 50},
+				{date: january.AddDate(0, 3, 0), amount: 50},
+				{date: january.AddDate(0, 4, 0), amount: 50},
+			},
+			wantOK: true, wantFrequency: "monthly", wantConfidence: 0.9, wantNext: "2024-06-15",
+		},
+		{
+			name: "annual needs two occurrences",
+			occurrences: []recurringOccurrence{
+				{date: january, amount: 120},
+				{date: january.AddDate(1, 0, 0), amount: 120},
+			},
+			wantOK: true, wantFrequency: "annual", wantConfidence: 1, wantNext: "2026-01-15",
+		},
+		{"monthly needs three occurrences", monthlyOccurrences(january, 50, 50), false, "", 0, ""},
+		{"amounts too far apart", monthlyOccurrences(january, 10, 90, 10, 90), false, "", 0, ""},
+		{"single purchase", monthlyOccurrences(january, 50), false, "", 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			series, ok := recurringSeriesOf(group, tt.occurrences)
+			if ok != tt.wantOK {
+				t.Fatalf("recurringSeriesOf() ok = %v; want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if series.Frequency != tt.wantFrequency || series.Confidence != tt.wantConfidence ||
+				series.NextExpectedDate.Format("2006-01-02") != tt.wantNext || series.SeriesKey != "name:GYM|"+tt.wantFrequency {
+				t.Errorf("recurringSeriesOf() = %s %s, confidence %v, next %s; want %s, confidence %v, next %s", series.SeriesKey,
+					series.Frequency, series.Confidence, series.NextExpectedDate.Format("2006-01-02"),
+					tt.wantFrequency, tt.wantConfidence, tt.wantNext)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Receipt types
+const (
+	ReceiptTypePurchase = "purchase"
+	ReceiptTypeRefund   = "refund" // Return slip, recorded as a negative expense
+)
+
+// RefundMatchWindowDays is how far back a refund looks for the purchase it returns
+const RefundMatchWindowDays = 180
+
+// FindOriginalReceipt looks for the user's purchase that a refund returns, among the purchases
+// from the same merchant in the RefundMatchWindowDays before it: the receipt with the printed
+// original receipt number when there is one, otherwise the most recent purchase that contains the
+// returned items and is large enough to cover the refund. Receipt numbers repeat between stores,
+// so they are never matched across merchants. It returns nil when no purchase matches.
+func FindOriginalReceipt(tx *gorm.DB, refund *Receipt, originalNumber string) (*Receipt, error) {
+	if refund.MerchantID == nil && refund.Merchant == "" {
+		return nil, nil
+	}
+
+	if originalNumber != "" {
+		var original Receipt
+		err := refundPurchases(tx, refund).Where("receipt_number = ?", originalNumber).
+			Order("transaction_date DESC").Limit(1).Find(&original).Error
+		if err != nil {
+			return nil, fmt.Errorf("error looking up original receipt: %w", err)
+		}
+		if original.ReceiptID != uuid.Nil {
+			return &original, nil
+		}
+	}
+
+	// Without a matching receipt number, fall back to the returned items
+	query := refundPurchases(tx, refund).Preload("LineItems")
+
+	var candidates []Receipt
+	if err := query.Order("transaction_date DESC").Find(&candidates).Error; err != nil {
+		return nil, fmt.Errorf("error looking up purchases for refund: %w", err)
+	}
+
+	var best *Receipt
+	bestMatches := 0
+	for i := range candidates {
+		candidate := &candidates[i]
+		if candidate.TotalAmount+TotalsTolerance < refund.TotalAmount {
+			continue
+		}
+
+		matches := countReturnedItems(candidate.LineItems, refund.LineItems)
+		if len(refund.LineItems) > 0 && matches == 0 {
+			continue
+		}
+		// Candidates are newest first, so ties keep the most recent purchase
+		if best == nil || matches > bestMatches {
+			best, bestMatches = candidate, matches
+		}
+	}
+	return best, nil
+}
+
+// refundPurchases scopes a query to the user's purchases the refund may return: from the same
+// merchant, or the same printed name when it wasn't resolved, and within the match window
+func refundPurchases(tx *gorm.DB, refund *Receipt) *gorm.DB {
+	query := tx.Where("user_id = ? AND type = ? AND receipt_id <> ?", refund.UserID, ReceiptTypePurchase, refund.ReceiptID)
+	if refund.MerchantID != nil {
+		query = query.Where("merchant_id = ?", *refund.MerchantID)
+	} else {
+		query = query.Where("merchant ILIKE ?", refund.Merchant)
+	}
+	if refundDate, err := time.Parse("2006-01-02", refund.TransactionDate); err == nil {
+		from := refundDate.AddDate(0, 0, -RefundMatchWindowDays).Format("2006-01-02")
+		query = query.Where("transaction_date BETWEEN ? AND ?", from, refund.TransactionDate)
+	}
+	return query
+}
+
+// countReturnedItems counts the returned items that appear on the purchase, by product code or name
+func countReturnedItems(purchased, returned []ReceiptItem) int {
+	codes, names := map[string]bool{}, map[string]bool{}
+	for _, item := range purchased {
+		if item.ProductCode != "" {
+			codes[item.ProductCode] = true
+		}
+		if name := strings.ToUpper(strings.TrimSpace(item.Name)); name != "" {
+			names[name] = true
+		}
+	}
+
+	matches := 0
+	for _, item := range returned {
+		if (item.ProductCode != "" && codes[item.ProductCode]) || names[strings.ToUpper(strings.TrimSpace(item.Name))] {
+			matches++
+		}
+	}
+	return matches
+}
@@ -0,0 +1,538 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"receipt-mgmt/db"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Fields a rule condition can test
+const (
+	RuleFieldMerchant      = "merchant"       // Printed merchant name
+	RuleFieldTotal         = "total"          // Total in the receipt's currency
+	RuleFieldItem          = "item"           // Matches when any line item name matches
+	RuleFieldPaymentMethod = "payment_method" // credit, debit, cash or gift_card
+	RuleFieldCardBrand     = "card_brand"
+	RuleFieldDate          = "date"    // Transaction date, YYYY-MM-DD
+	RuleFieldWeekday       = "weekday" // Transaction weekday, e.g. "saturday"
+)
+
+// ruleFieldOperators lists the operators allowed for each field
+var ruleFieldOperators = map[string][]string{
+	RuleFieldMerchant:      {"equals", "contains", "starts_with", "matches"},
+	RuleFieldItem:          {"equals", "contains", "starts_with", "matches"},
+	RuleFieldPaymentMethod: {"equals", "in"},
+	RuleFieldCardBrand:     {"equals", "in"},
+	RuleFieldWeekday:       {"equals", "in"},
+	RuleFieldTotal:         {"eq", "gt", "gte", "lt", "lte", "between"},
+	RuleFieldDate:          {"eq", "before", "after", "between"},
+}
+
+// RuleCondition is a single test against a receipt, e.g. merchant contains "COSTCO".
+// Regular expressions may be written as /pattern/i for a case-insensitive match.
+type RuleCondition struct {
+	Field    string   `json:"field"`
+	Operator string   `json:"operator"`
+	Value    string   `json:"value,omitempty"`
+	Values   []string `json:"values,omitempty"` // For "in", and the bounds of "between"
+}
+
+// RuleConditions is the list of conditions of a rule, stored as jsonb
+type RuleConditions []RuleCondition
+
+// Value stores the conditions as a JSON array
+func (c RuleConditions) Value() (driver.Value, error) {
+	data, err := json.Marshal([]RuleCondition(c))
+	return string(data), err
+}
+
+// Scan reads the conditions from a JSON array
+func (c *RuleConditions) Scan(value interface{}) error {
+	return scanJSON(value, c)
+}
+
+// RuleActions is what a matching rule does to a receipt, stored as jsonb
+type RuleActions struct {
+	CategoryID *uuid.UUID `json:"category_id,omitempty"`
+	Tags       []string   `json:"tags,omitempty"`
+	Flag       bool       `json:"flag,omitempty"`
+}
+
+// Value stores the actions as a JSON object
+func (a RuleActions) Value() (driver.Value, error) {
+	data, err := json.Marshal(a)
+	return string(data), err
+}
+
+// Scan reads the actions from a JSON object
+func (a *RuleActions) Scan(value interface{}) error {
+	return scanJSON(value, a)
+}
+
+// Rule is a user-defined categorization and tagging rule. Enabled rules run on every new receipt
+// in ascending priority order.
+type Rule struct {
+	RuleID         uuid.UUID      `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"rule_id"`
+	UserID         uuid.UUID      `gorm:"type:uuid;not null;index" json:"user_id"`
+	Name           string         `gorm:"type:varchar(100);not null" json:"name"`
+	Priority       int            `gorm:"not null;default:100" json:"priority"` // Lower runs first
+	Enabled        bool           `gorm:"not null;default:true" json:"enabled"`
+	MatchAll       bool           `gorm:"not null;default:true" json:"match_all"`        // All conditions must match, otherwise any one
+	StopProcessing bool           `gorm:"not null;default:false" json:"stop_processing"` // Skip lower priority rules after a match
+	Conditions     RuleConditions `gorm:"type:jsonb;not null" json:"conditions"`
+	Actions        RuleActions    `gorm:"type:jsonb;not null" json:"actions"`
+	CreatedAt      time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// RuleOutcome is the result of running a user's rules on one receipt
+type RuleOutcome struct {
+	ReceiptID    uuid.UUID   `json:"receipt_id"`
+	Merchant     string      `json:"merchant"`
+	TotalAmount  float64     `json:"total_amount"`
+	MatchedRules []uuid.UUID `json:"matched_rules"`
+	CategoryID   *uuid.UUID  `json:"category_id,omitempty"` // Category set by the first matching rule that sets one
+	Tags         StringList  `json:"tags"`                  // Tags after the rules, existing tags included
+	Flagged      bool        `json:"flagged"`
+	Changed      bool        `json:"changed"` // Whether the receipt would be modified
+}
+
+// Validate checks the rule is complete and every condition can be evaluated
+func (r *Rule) Validate() error {
+	if strings.TrimSpace(r.Name) == "" || len(r.Name) > 100 {
+		return errors.New("name must be between 1 and 100 characters")
+	}
+	if len(r.Conditions) == 0 {
+		return errors.New("a rule needs at least one condition")
+	}
+	if r.Actions.CategoryID == nil && len(r.Actions.Tags) == 0 && !r.Actions.Flag {
+		return errors.New("a rule needs at least one action")
+	}
+	for i, condition := range r.Conditions {
+		if err := condition.validate(); err != nil {
+			return fmt.Errorf("condition %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (c RuleCondition) validate() error {
+	operators, ok := ruleFieldOperators[c.Field]
+	if !ok {
+		return fmt.Errorf("unknown field %q", c.Field)
+	}
+	if !containsString(operators, c.Operator) {
+		return fmt.Errorf("operator %q is not supported for %s, use one of %s", c.Operator, c.Field, strings.Join(operators, ", "))
+	}
+
+	switch {
+	case c.Operator == "between":
+		if len(c.Values) != 2 {
+			return errors.New("between needs two values")
+		}
+	case c.Operator == "in":
+		if len(c.Values) == 0 {
+			return errors.New("in needs at least one value")
+		}
+	case strings.TrimSpace(c.Value) == "":
+		return errors.New("value is required")
+	}
+
+	for _, value := range c.operands() {
+		switch c.Field {
+		case RuleFieldTotal:
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				return fmt.Errorf("%q is not an amount", value)
+			}
+		case RuleFieldDate:
+			if _, err := time.Parse("2006-01-02", value); err != nil {
+				return fmt.Errorf("%q is not a YYYY-MM-DD date", value)
+			}
+		}
+	}
+	if c.Operator == "matches" {
+		if _, err := compileRulePattern(c.Value); err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+	}
+	return nil
+}
+
+// operands returns the values the condition compares against
+func (c RuleCondition) operands() []string {
+	if c.Operator == "between" || c.Operator == "in" {
+		return c.Values
+	}
+	return []string{c.Value}
+}
+
+// Matches reports whether the receipt satisfies the rule's conditions. Item conditions are tested
+// against the receipt's loaded line items.
+func (r *Rule) Matches(receipt *Receipt) bool {
+	for _, condition := range r.Conditions {
+		matched := condition.matches(receipt)
+		if matched && !r.MatchAll {
+			return true
+		}
+		if !matched && r.MatchAll {
+			return false
+		}
+	}
+	return r.MatchAll
+}
+
+func (c RuleCondition) matches(receipt *Receipt) bool {
+	switch c.Field {
+	case RuleFieldMerchant:
+		return c.matchText(receipt.Merchant)
+	case RuleFieldItem:
+		for _, item := range receipt.LineItems {
+			if c.matchText(item.Name) {
+				return true
+			}
+		}
+		return false
+	case RuleFieldPaymentMethod:
+		return c.matchText(receipt.PaymentMethod)
+	case RuleFieldCardBrand:
+		return c.matchText(receipt.CardBrand)
+	case RuleFieldWeekday:
+		date, err := time.Parse("2006-01-02", receipt.TransactionDate)
+		return err == nil && c.matchText(date.Weekday().String())
+	case RuleFieldTotal:
+		return c.matchAmount(receipt.TotalAmount)
+	case RuleFieldDate:
+		return c.matchDate(receipt.TransactionDate)
+	}
+	return false
+}
+
+// matchText compares text case-insensitively
+func (c RuleCondition) matchText(text string) bool {
+	text = strings.ToLower(strings.TrimSpace(text))
+	if text == "" {
+		return false
+	}
+	value := strings.ToLower(strings.TrimSpace(c.Value))
+
+	switch c.Operator {
+	case "equals":
+		return text == value
+	case "contains":
+		return strings.Contains(text, value)
+	case "starts_with":
+		return strings.HasPrefix(text, value)
+	case "in":
+		for _, candidate := range c.Values {
+			if text == strings.ToLower(strings.TrimSpace(candidate)) {
+				return true
+			}
+		}
+	case "matches":
+		// The pattern is validated when the rule is saved
+		pattern, err := compileRulePattern(c.Value)
+		return err == nil && pattern.MatchString(text)
+	}
+	return false
+}
+
+func (c RuleCondition) matchAmount(amount float64) bool {
+	bounds := make([]float64, 0, 2)
+	for _, value := range c.operands() {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return false
+		}
+		bounds = append(bounds, parsed)
+	}
+
+	switch c.Operator {
+	case "eq":
+		return roundCents(amount) == roundCents(bounds[0])
+	case "gt":
+		return amount > bounds[0]
+	case "gte":
+		return amount >= bounds[0]
+	case "lt":
+		return amount < bounds[0]
+	case "lte":
+		return amount <= bounds[0]
+	case "between":
+		return amount >= bounds[0] && amount <= bounds[1]
+	}
+	return false
+}
+
+// matchDate compares YYYY-MM-DD dates, which order the same as text
+func (c RuleCondition) matchDate(date string) bool {
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return false
+	}
+
+	switch c.Operator {
+	case "eq":
+		return date == c.Value
+	case "before":
+		return date < c.Value
+	case "after":
+		return date > c.Value
+	case "between":
+		return date >= c.Values[0] && date <= c.Values[1]
+	}
+	return false
+}
+
+// compileRulePattern compiles a regular expression, accepting the /pattern/i form
+func compileRulePattern(pattern string) (*regexp.Regexp, error) {
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") {
+		if end := strings.LastIndex(pattern, "/"); end > 0 {
+			flags := pattern[end+1:]
+			if strings.Trim(flags, "i") != "" {
+				return nil, fmt.Errorf("unsupported flags %q", flags)
+			}
+			pattern = pattern[1:end]
+		}
+	}
+	// Text is lower-cased before matching, so every pattern is case-insensitive
+	return regexp.Compile("(?i)" + pattern)
+}
+
+// EvaluateRules runs the rules on a receipt in priority order without changing it. The first matching
+// rule that sets a category wins, tags accumulate and any matching rule can flag the receipt.
+func EvaluateRules(rules []Rule, receipt *Receipt) RuleOutcome {
+	outcome := RuleOutcome{
+		ReceiptID:    receipt.ReceiptID,
+		Merchant:     receipt.Merchant,
+		TotalAmount:  receipt.TotalAmount,
+		MatchedRules: []uuid.UUID{},
+		Tags:         receipt.Tags.Merge(),
+		Flagged:      receipt.Flagged,
+	}
+
+	for i := range rules {
+		rule := &rules[i]
+		if !rule.Enabled || !rule.Matches(receipt) {
+			continue
+		}
+		outcome.MatchedRules = append(outcome.MatchedRules, rule.RuleID)
+		if rule.Actions.CategoryID != nil && outcome.CategoryID == nil {
+			outcome.CategoryID = rule.Actions.CategoryID
+		}
+		outcome.Tags = outcome.Tags.Merge(rule.Actions.Tags...)
+		outcome.Flagged = outcome.Flagged || rule.Actions.Flag
+		if rule.StopProcessing {
+			break
+		}
+	}
+
+	outcome.Changed = (outcome.CategoryID != nil && *outcome.CategoryID != receipt.CategoryID) ||
+		outcome.Flagged != receipt.Flagged || len(outcome.Tags) != len(receipt.Tags.Merge())
+	return outcome
+}
+
+// ApplyTo copies the outcome onto the receipt. A rule's category replaces a suggested one, and is
+// kept as the user's own choice.
+func (o RuleOutcome) ApplyTo(receipt *Receipt) {
+	if o.CategoryID != nil {
+		receipt.CategoryID = *o.CategoryID
+		receipt.CategorySuggested = false
+	}
+	receipt.Tags = o.Tags
+	receipt.Flagged = o.Flagged
+}
+
+// GetUserRules returns the user's rules in the order they run
+func GetUserRules(userID uuid.UUID, enabledOnly bool) ([]Rule, error) {
+	DB := db.GetDBInstance()
+
+	query := DB.Where("user_id = ?", userID)
+	if enabledOnly {
+		query = query.Where("enabled = true")
+	}
+
+	var rules []Rule
+	err := query.Order("priority ASC, created_at ASC").Find(&rules).Error
+	return rules, err
+}
+
+// GetApplicableRules returns the user's enabled rules in the order they run, ready to apply
+func GetApplicableRules(userID uuid.UUID) ([]Rule, error) {
+	rules, err := GetUserRules(userID, true)
+	if err != nil {
+		return nil, err
+	}
+	return applicableRules(db.GetDBInstance(), userID, rules)
+}
+
+// applicableRules drops the category action of rules whose category the user can no longer use,
+// so that a deleted category is never put back on a receipt. The other actions still apply.
+func applicableRules(tx *gorm.DB, userID uuid.UUID, rules []Rule) ([]Rule, error) {
+	categoryIDs := []uuid.UUID{}
+	for _, rule := range rules {
+		if rule.Actions.CategoryID != nil {
+			categoryIDs = append(categoryIDs, *rule.Actions.CategoryID)
+		}
+	}
+	if len(categoryIDs) == 0 {
+		return rules, nil
+	}
+
+	var validIDs []uuid.UUID
+	if err := tx.Model(&Category{}).Where("id IN ?", categoryIDs).
+		Where("user_id = ? OR user_id IS NULL OR is_default = true", userID).
+		Pluck("id", &validIDs).Error; err != nil {
+		return nil, fmt.Errorf("error checking rule categories: %w", err)
+	}
+	valid := map[uuid.UUID]bool{}
+	for _, id := range validIDs {
+		valid[id] = true
+	}
+
+	applicable := make([]Rule, len(rules))
+	for i, rule := range rules {
+		if rule.Actions.CategoryID != nil && !valid[*rule.Actions.CategoryID] {
+			rule.Actions.CategoryID = nil
+		}
+		applicable[i] = rule
+	}
+	return applicable, nil
+}
+
+// GetRuleByID returns one of the user's rules
+func GetRuleByID(ruleID, userID uuid.UUID) (*Rule, error) {
+	DB := db.GetDBInstance()
+
+	var rule Rule
+	if err := DB.Where("rule_id = ? AND user_id = ?", ruleID, userID).First(&rule).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// SaveRule creates or updates a rule
+func SaveRule(rule *Rule) error {
+	DB := db.GetDBInstance()
+
+	if err := DB.Save(rule).Error; err != nil {
+		return fmt.Errorf("error saving rule: %w", err)
+	}
+	return nil
+}
+
+// DeleteRule deletes one of the user's rules
+func DeleteRule(rule *Rule) error {
+	DB := db.GetDBInstance()
+
+	if err := DB.Delete(rule).Error; err != nil {
+		return fmt.Errorf("error deleting rule: %w", err)
+	}
+	return nil
+}
+
+// RuleHistoryFilter limits which of the user's past receipts rules are run on
+type RuleHistoryFilter struct {
+	From string // Inclusive YYYY-MM-DD transaction date
+	To   string
+}
+
+// userReceiptsForRules loads the user's receipts with their line items, without the images
+func userReceiptsForRules(tx *gorm.DB, userID uuid.UUID, filter RuleHistoryFilter) ([]Receipt, error) {
+	query := tx.Omit("image").Preload("LineItems").Where("user_id = ?", userID)
+	if filter.From != "" {
+		query = query.Where("transaction_date >= ?", filter.From)
+	}
+	if filter.To != "" {
+		query = query.Where("transaction_date <= ?", filter.To)
+	}
+
+	var receipts []Receipt
+	if err := query.Order("transaction_date ASC").Find(&receipts).Error; err != nil {
+		return nil, fmt.Errorf("error loading receipts: %w", err)
+	}
+	return receipts, nil
+}
+
+// PreviewRules runs the rules on the user's past receipts without saving anything and returns
+// the receipts they match
+func PreviewRules(userID uuid.UUID, rules []Rule, filter RuleHistoryFilter) ([]RuleOutcome, error) {
+	DB := db.GetDBInstance()
+
+	rules, err := applicableRules(DB, userID, rules)
+	if err != nil {
+		return nil, err
+	}
+	receipts, err := userReceiptsForRules(DB, userID, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	outcomes := []RuleOutcome{}
+	for i := range receipts {
+		if outcome := EvaluateRules(rules, &receipts[i]); len(outcome.MatchedRules) > 0 {
+			outcomes = append(outcomes, outcome)
+		}
+	}
+	return outcomes, nil
+}
+
+// ApplyRulesToHistory runs the rules on the user's past receipts and saves the changes, keeping the
+// linked expenses in the receipt's category. It returns the receipts that changed.
+func ApplyRulesToHistory(userID uuid.UUID, rules []Rule, filter RuleHistoryFilter) ([]RuleOutcome, error) {
+	DB := db.GetDBInstance()
+
+	changed := []RuleOutcome{}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		rules, err := applicableRules(tx, userID, rules)
+		if err != nil {
+			return err
+		}
+		receipts, err := userReceiptsForRules(tx, userID, filter)
+		if err != nil {
+			return err
+		}
+
+		for i := range receipts {
+			receipt := &receipts[i]
+			outcome := EvaluateRules(rules, receipt)
+			if !outcome.Changed {
+				continue
+			}
+			outcome.ApplyTo(receipt)
+
+			if err := tx.Model(&Receipt{}).Where("receipt_id = ?", receipt.ReceiptID).Updates(map[string]interface{}{
+				"category_id":        receipt.CategoryID,
+				"category_suggested": receipt.CategorySuggested,
+				"tags":               receipt.Tags,
+				"flagged":            receipt.Flagged,
+			}).Error; err != nil {
+				return fmt.Errorf("error updating receipt: %w", err)
+			}
+			if outcome.CategoryID != nil {
+				if err := syncReceiptExpense(tx, receipt); err != nil {
+					return err
+				}
+			}
+			changed = append(changed, outcome)
+		}
+		return nil
+	})
+	return changed, err
+}
+
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
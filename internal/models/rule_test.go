@@ -0,0 +1,141 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestEvaluateRules(t *testing.T) {
+	groceries, dining, current := uuid.New(), uuid.New(), uuid.New()
+	costco := Rule{
+		RuleID:     uuid.New(),
+		Enabled:    true,
+		MatchAll:   true,
+		Conditions: RuleConditions{{Field: RuleFieldMerchant, Operator: "contains", Value: "costco"}},
+		Actions:    RuleActions{CategoryID: &groceries, Tags: []string{"bulk"}},
+	}
+	large := Rule{
+		RuleID:     uuid.New(),
+		Enabled:    true,
+		MatchAll:   true,
+		Conditions: RuleConditions{{Field: RuleFieldTotal, Operator: "gt", Value: "100"}},
+		Actions:    RuleActions{CategoryID: &dining, Flag: true},
+	}
+	weekend := Rule{
+		RuleID:     uuid.New(),
+		Enabled:    true,
+		MatchAll:   false,
+		Conditions: RuleConditions{{Field: RuleFieldWeekday, Operator: "in", Values: []string{"saturday", "sunday"}}},
+		Actions:    RuleActions{Tags: []string{"weekend"}},
+	}
+	stopping := costco
+	stopping.RuleID = uuid.New()
+	stopping.StopProcessing = true
+	disabled := large
+	disabled.RuleID = uuid.New()
+	disabled.Enabled = false
+
+	tests := []struct {
+		name     string
+		rules    []Rule
+		receipt  Receipt
+		matched  []uuid.UUID
+		category *uuid.UUID
+		tags     StringList
+		flagged  bool
+		changed  bool
+	}{
+		{
+			name:     "first category wins and tags accumulate",
+			rules:    []Rule{costco, large, weekend},
+			receipt:  Receipt{Merchant: "COSTCO WHOLESALE", TotalAmount: 250, TransactionDate: "2024-03-16", CategoryID: current},
+			matched:  []uuid.UUID{costco.RuleID, large.RuleID, weekend.RuleID},
+			category: &groceries,
+			tags:     StringList{"bulk", "weekend"},
+			flagged:  true,
+			changed:  true,
+		},
+		{
+			name:     "stop processing skips lower priority rules",
+			rules:    []Rule{stopping, large},
+			receipt:  Receipt{Merchant: "Costco", TotalAmount: 250, CategoryID: current},
+			matched:  []uuid.UUID{stopping.RuleID},
+			category: &groceries,
+			tags:     StringList{"bulk"},
+			changed:  true,
+		},
+		{
+			name:    "disabled rules are skipped",
+			rules:   []Rule{disabled},
+			receipt: Receipt{Merchant: "Keg", TotalAmount: 180, CategoryID: current},
+			matched: []uuid.UUID{},
+			tags:    StringList{},
+		},
+		{
+			name:     "same category and tags is unchanged",
+			rules:    []Rule{costco},
+			receipt:  Receipt{Merchant: "Costco", CategoryID: groceries, Tags: StringList{"bulk"}},
+			matched:  []uuid.UUID{costco.RuleID},
+			category: &groceries,
+			tags:     StringList{"bulk"},
+		},
+		{
+			name:    "no match",
+			rules:   []Rule{costco, large, weekend},
+			receipt: Receipt{Merchant: "Metro", TotalAmount: 40, TransactionDate: "2024-03-13", CategoryID: current},
+			matched: []uuid.UUID{},
+			tags:    StringList{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outcome := EvaluateRules(tt.rules, &tt.receipt)
+			if !reflect.DeepEqual(outcome.MatchedRules, tt.matched) {
+				t.Errorf("MatchedRules = %v; want %v", outcome.MatchedRules, tt.matched)
+			}
+			if !reflect.DeepEqual(outcome.CategoryID, tt.category) {
+				t.Errorf("CategoryID = %v; want %v", outcome.CategoryID, tt.category)
+			}
+			if !reflect.DeepEqual(outcome.Tags, tt.tags) {
+				t.Errorf("Tags = %v; want %v", outcome.Tags, tt.tags)
+			}
+			if outcome.Flagged != tt.flagged || outcome.Changed != tt.changed {
+				t.Errorf("Flagged, Changed = %v, %v; want %v, %v", outcome.Flagged, outcome.Changed, tt.flagged, tt.changed)
+			}
+		})
+	}
+}
+
+func TestRuleConditionMatches(t *testing.T) {
+	receipt := &Receipt{
+		Merchant:        "Tim Hortons #0412",
+		TotalAmount:     12.5,
+		TransactionDate: "2024-03-15",
+		PaymentMethod:   "credit",
+		LineItems:       []ReceiptItem{{Name: "DOUBLE DOUBLE"}, {Name: "TIMBITS 10"}},
+	}
+
+	tests := []struct {
+		condition RuleCondition
+		want      bool
+	}{
+		{RuleCondition{Field: RuleFieldMerchant, Operator: "starts_with", Value: "tim hortons"}, true},
+		{RuleCondition{Field: RuleFieldMerchant, Operator: "matches", Value: `/^TIM\s+HORTONS/i`}, true},
+		{RuleCondition{Field: RuleFieldMerchant, Operator: "equals", Value: "tim hortons"}, false},
+		{RuleCondition{Field: RuleFieldItem, Operator: "contains", Value: "timbits"}, true},
+		{RuleCondition{Field: RuleFieldTotal, Operator: "between", Values: []string{"10", "12.50"}}, true},
+		{RuleCondition{Field: RuleFieldTotal, Operator: "lt", Value: "12.5"}, false},
+		{RuleCondition{Field: RuleFieldDate, Operator: "before", Value: "2024-04-01"}, true},
+		{RuleCondition{Field: RuleFieldWeekday, Operator: "equals", Value: "Friday"}, true},
+		{RuleCondition{Field: RuleFieldPaymentMethod, Operator: "in", Values: []string{"debit", "cash"}}, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.condition.matches(receipt); got != tt.want {
+			t.Errorf("%+v matches = %v; want %v", tt.condition, got, tt.want)
+		}
+	}
+}
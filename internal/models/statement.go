@@ -0,0 +1,636 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"receipt-mgmt/db"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Match statuses of a statement transaction
+const (
+	StatementMatched   = "matched"   // Paired with a receipt
+	StatementUnmatched = "unmatched" // No receipt was found for it
+	StatementAmbiguous = "ambiguous" // Several receipts fit equally well, the user has to pick
+	StatementIgnored   = "ignored"   // Needs no receipt, e.g. a card payment or a bank fee
+)
+
+const (
+	// StatementMatchMinConfidence is the confidence a receipt needs to be considered for a transaction
+	StatementMatchMinConfidence = 0.6
+	// StatementAmbiguityMargin is how close two candidates may score before the match is left to the user
+	StatementAmbiguityMargin = 0.05
+	// StatementPostingDaysBefore is how many days before the receipt date a transaction may post (time zones)
+	StatementPostingDaysBefore = 1
+	// StatementPostingDaysAfter is how many days a card transaction may take to post after the purchase
+	StatementPostingDaysAfter = 5
+	// StatementAmountTolerance is the largest amount difference accepted, as a share of the receipt amount
+	StatementAmountTolerance = 0.02
+)
+
+// Evidence weights of a statement match
+const (
+	statementMatchAmountWeight   = 0.5
+	statementMatchDateWeight     = 0.25
+	statementMatchMerchantWeight = 0.25
+)
+
+// ErrReceiptAlreadyMatched is returned when a receipt is matched to a second transaction
+var ErrReceiptAlreadyMatched = errors.New("the receipt is already matched to another statement transaction")
+
+// StatementImport is one bank or card statement file imported by a user
+type StatementImport struct {
+	ImportID         uuid.UUID              `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"import_id"`
+	UserID           uuid.UUID              `gorm:"type:uuid;not null;index" json:"user_id"`
+	PaymentAccountID *uuid.UUID             `gorm:"type:uuid;index" json:"payment_account_id"`
+	FileName         string                 `gorm:"type:varchar(255)" json:"file_name"`
+	Format           string                 `gorm:"type:varchar(10);not null" json:"format"` // csv or ofx
+	PeriodStart      *time.Time             `gorm:"type:date" json:"period_start"`           // Earliest posted date in the file
+	PeriodEnd        *time.Time             `gorm:"type:date" json:"period_end"`
+	TransactionCount int                    `json:"transaction_count"` // New transactions saved
+	DuplicateCount   int                    `json:"duplicate_count"`   // Transactions already imported from another file
+	Transactions     []StatementTransaction `gorm:"foreignKey:ImportID;references:ImportID;constraint:OnDelete:CASCADE" json:"transactions,omitempty"`
+	CreatedAt        time.Time              `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// StatementTransaction is one transaction of an imported statement and the receipt it was matched to.
+// Amount is positive for purchases and negative for refunds and payments.
+type StatementTransaction struct {
+	TransactionID       uuid.UUID  `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"transaction_id"`
+	UserID              uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_statement_transaction_fingerprint" json:"user_id"`
+	ImportID            uuid.UUID  `gorm:"type:uuid;not null;index" json:"import_id"`
+	PaymentAccountID    *uuid.UUID `gorm:"type:uuid;index" json:"payment_account_id"`
+	PostedDate          time.Time  `gorm:"type:date;not null;index" json:"posted_date"`
+	Amount              float64    `gorm:"type:decimal(10,2);not null" json:"amount"`
+	Description         string     `gorm:"type:varchar(255)" json:"description"`
+	NormalizedMerchant  string     `gorm:"type:varchar(255)" json:"normalized_merchant"` // Description reduced like merchant names
+	Reference           string     `gorm:"type:varchar(100)" json:"reference"`           // Bank transaction ID, when given
+	CardLastFour        string     `gorm:"type:char(4)" json:"card_last_four"`
+	Fingerprint         string     `gorm:"type:varchar(64);not null;uniqueIndex:idx_statement_transaction_fingerprint" json:"-"` // Skips transactions imported twice
+	ReceiptID           *uuid.UUID `gorm:"type:uuid;index" json:"receipt_id"`
+	MatchStatus         string     `gorm:"type:varchar(20);not null;default:'unmatched';index" json:"match_status"`
+	MatchConfidence     float64    `gorm:"type:decimal(5,4)" json:"match_confidence"`
+	CandidateReceiptIDs StringList `gorm:"type:jsonb;not null;default:'[]'" json:"candidate_receipt_ids"` // Receipts that fit an ambiguous transaction
+	Reviewed            bool       `gorm:"default:false" json:"reviewed"`                                 // Matched or dismissed by the user; reconciliation leaves it alone
+	CreatedAt           time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt           time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// StatementFilter holds the optional criteria for listing and reconciling statement transactions
+type StatementFilter struct {
+	ImportID         *uuid.UUID
+	PaymentAccountID *uuid.UUID
+	Status           string
+	From             string // Inclusive YYYY-MM-DD posted dates
+	To               string
+}
+
+// StatementMatch is a matched transaction with its receipt
+type StatementMatch struct {
+	Transaction StatementTransaction `json:"transaction"`
+	Receipt     *ReceiptSummary      `json:"receipt"`
+}
+
+// AmbiguousStatementMatch is a transaction with the receipts it may belong to
+type AmbiguousStatementMatch struct {
+	Transaction StatementTransaction `json:"transaction"`
+	Candidates  []ReceiptSummary     `json:"candidates"`
+}
+
+// ReconciliationReport tells which card transactions have a receipt, which don't, and which card
+// receipts never showed up on a statement
+type ReconciliationReport struct {
+	From                       string                    `json:"from"`
+	To                         string                    `json:"to"`
+	Matched                    []StatementMatch          `json:"matched"`
+	Unmatched                  []StatementTransaction    `json:"unmatched"`
+	Ambiguous                  []AmbiguousStatementMatch `json:"ambiguous"`
+	Ignored                    int                       `json:"ignored"`
+	ReceiptsWithoutTransaction []ReceiptSummary          `json:"receipts_without_transaction"`
+}
+
+// statementCandidate is a receipt scored against a transaction
+type statementCandidate struct {
+	transaction int
+	receipt     int
+	confidence  float64
+}
+
+// ImportStatement saves the transactions of a statement file. Transactions already imported, from
+// this file or an overlapping one, are skipped. Reconciliation is run afterwards by the caller.
+func ImportStatement(statement *StatementImport, transactions []StatementTransaction) error {
+	DB := db.GetDBInstance()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var account *PaymentAccount
+		if statement.PaymentAccountID != nil {
+			account = &PaymentAccount{}
+			if err := tx.Where("account_id = ? AND user_id = ?", *statement.PaymentAccountID, statement.UserID).
+				First(account).Error; err != nil {
+				return fmt.Errorf("payment account not found: %w", err)
+			}
+		}
+
+		statement.ImportID = uuid.New()
+		if err := tx.Create(statement).Error; err != nil {
+			return fmt.Errorf("error creating statement import: %w", err)
+		}
+
+		// Identical rows in one file are separate purchases, e.g. two coffees on the same day
+		occurrences := map[string]int{}
+		for i := range transactions {
+			transaction := &transactions[i]
+			transaction.TransactionID = uuid.New()
+			transaction.UserID = statement.UserID
+			transaction.ImportID = statement.ImportID
+			transaction.PaymentAccountID = statement.PaymentAccountID
+			transaction.Amount = roundCents(transaction.Amount)
+			transaction.NormalizedMerchant = NormalizeMerchantName(transaction.Description)
+			transaction.MatchStatus = StatementUnmatched
+			if account != nil && transaction.CardLastFour == "" {
+				transaction.CardLastFour = account.LastFour
+			}
+
+			key := transaction.fingerprintKey()
+			occurrences[key]++
+			transaction.Fingerprint = fingerprint(fmt.Sprintf("%s#%d", key, occurrences[key]))
+
+			result := tx.Where("user_id = ? AND fingerprint = ?", transaction.UserID, transaction.Fingerprint).
+				FirstOrCreate(transaction)
+			if result.Error != nil {
+				return fmt.Errorf("error saving statement transaction: %w", result.Error)
+			}
+			if result.RowsAffected == 0 {
+				statement.DuplicateCount++
+				continue
+			}
+			statement.TransactionCount++
+
+			posted := transaction.PostedDate
+			if statement.PeriodStart == nil || posted.Before(*statement.PeriodStart) {
+				statement.PeriodStart = &posted
+			}
+			if statement.PeriodEnd == nil || posted.After(*statement.PeriodEnd) {
+				statement.PeriodEnd = &posted
+			}
+		}
+
+		if err := tx.Model(&StatementImport{}).Where("import_id = ?", statement.ImportID).Updates(map[string]interface{}{
+			"transaction_count": statement.TransactionCount,
+			"duplicate_count":   statement.DuplicateCount,
+			"period_start":      statement.PeriodStart,
+			"period_end":        statement.PeriodEnd,
+		}).Error; err != nil {
+			return fmt.Errorf("error updating statement import: %w", err)
+		}
+		return nil
+	})
+}
+
+// fingerprintKey identifies a transaction across files: by the bank's ID when there is one,
+// otherwise by its date, amount, card and description
+func (t *StatementTransaction) fingerprintKey() string {
+	if t.Reference != "" {
+		return "ref|" + t.CardLastFour + "|" + t.Reference
+	}
+	return fmt.Sprintf("%s|%.2f|%s|%s", t.PostedDate.Format("2006-01-02"), t.Amount, t.CardLastFour,
+		strings.ToUpper(strings.Join(strings.Fields(t.Description), " ")))
+}
+
+func fingerprint(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+// GetStatementImports returns the user's imported statements, latest first
+func GetStatementImports(userID uuid.UUID) ([]StatementImport, error) {
+	DB := db.GetDBInstance()
+
+	var imports []StatementImport
+	err := DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&imports).Error
+	return imports, err
+}
+
+// DeleteStatementImport deletes an imported statement together with its transactions
+func DeleteStatementImport(importID, userID uuid.UUID) error {
+	DB := db.GetDBInstance()
+
+	result := DB.Where("import_id = ? AND user_id = ?", importID, userID).Delete(&StatementImport{})
+	if result.Error != nil {
+		return fmt.Errorf("error deleting statement import: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetStatementTransactions returns the user's statement transactions matching the filter, latest first
+func GetStatementTransactions(userID uuid.UUID, filter StatementFilter) ([]StatementTransaction, error) {
+	DB := db.GetDBInstance()
+
+	var transactions []StatementTransaction
+	err := statementQuery(DB, userID, filter).Order("posted_date DESC, created_at DESC").Find(&transactions).Error
+	return transactions, err
+}
+
+// GetStatementTransactionByID returns one of the user's statement transactions
+func GetStatementTransactionByID(transactionID, userID uuid.UUID) (*StatementTransaction, error) {
+	DB := db.GetDBInstance()
+
+	var transaction StatementTransaction
+	if err := DB.Where("transaction_id = ? AND user_id = ?", transactionID, userID).First(&transaction).Error; err != nil {
+		return nil, err
+	}
+	return &transaction, nil
+}
+
+func statementQuery(tx *gorm.DB, userID uuid.UUID, filter StatementFilter) *gorm.DB {
+	query := tx.Where("user_id = ?", userID)
+	if filter.ImportID != nil {
+		query = query.Where("import_id = ?", *filter.ImportID)
+	}
+	if filter.PaymentAccountID != nil {
+		query = query.Where("payment_account_id = ?", *filter.PaymentAccountID)
+	}
+	if filter.Status != "" {
+		query = query.Where("match_status = ?", filter.Status)
+	}
+	if filter.From != "" {
+		query = query.Where("posted_date >= ?", filter.From)
+	}
+	if filter.To != "" {
+		query = query.Where("posted_date <= ?", filter.To)
+	}
+	return query
+}
+
+// ReconcileStatements matches the user's statement transactions to receipts on amount, posting
+// date and merchant. Matches the user made or dismissed are kept; all others are worked out again,
+// best scoring pairs first, and a transaction that fits several receipts equally well is left
+// ambiguous for the user to settle.
+func ReconcileStatements(userID uuid.UUID, filter StatementFilter) error {
+	DB := db.GetDBInstance()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		filter.Status = ""
+		var transactions []StatementTransaction
+		if err := statementQuery(tx, userID, filter).Where("NOT reviewed").
+			Order("posted_date ASC, created_at ASC").Find(&transactions).Error; err != nil {
+			return fmt.Errorf("error loading statement transactions: %w", err)
+		}
+		if len(transactions) == 0 {
+			return nil
+		}
+
+		receipts, err := statementCandidateReceipts(tx, userID, transactions)
+		if err != nil {
+			return err
+		}
+
+		candidates := []statementCandidate{}
+		byTransaction := make([][]statementCandidate, len(transactions))
+		byReceipt := make([][]statementCandidate, len(receipts))
+		for t := range transactions {
+			for r := range receipts {
+				confidence, ok := scoreStatementMatch(&transactions[t], &receipts[r])
+				if !ok || confidence < StatementMatchMinConfidence {
+					continue
+				}
+				candidate := statementCandidate{transaction: t, receipt: r, confidence: confidence}
+				candidates = append(candidates, candidate)
+				byTransaction[t] = append(byTransaction[t], candidate)
+				byReceipt[r] = append(byReceipt[r], candidate)
+			}
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].confidence > candidates[j].confidence
+		})
+
+		for t := range transactions {
+			transactions[t].ReceiptID = nil
+			transactions[t].MatchStatus = StatementUnmatched
+			transactions[t].MatchConfidence = 0
+			transactions[t].CandidateReceiptIDs = StringList{}
+		}
+		decided := make([]bool, len(transactions))
+		taken := make([]bool, len(receipts))
+		for _, candidate := range candidates {
+			if decided[candidate.transaction] || taken[candidate.receipt] {
+				continue
+			}
+			transaction := &transactions[candidate.transaction]
+			decided[candidate.transaction] = true
+
+			// Another free receipt, or another open transaction, fits about as well
+			rivals := StringList{}
+			for _, other := range byTransaction[candidate.transaction] {
+				if other.receipt != candidate.receipt && !taken[other.receipt] &&
+					other.confidence >= candidate.confidence-StatementAmbiguityMargin {
+					rivals = append(rivals, receipts[other.receipt].ReceiptID.String())
+				}
+			}
+			contested := false
+			for _, other := range byReceipt[candidate.receipt] {
+				if other.transaction != candidate.transaction && !decided[other.transaction] &&
+					other.confidence >= candidate.confidence-StatementAmbiguityMargin {
+					contested = true
+				}
+			}
+			if len(rivals) > 0 || contested {
+				transaction.MatchStatus = StatementAmbiguous
+				transaction.MatchConfidence = candidate.confidence
+				transaction.CandidateReceiptIDs = append(StringList{receipts[candidate.receipt].ReceiptID.String()}, rivals...)
+				continue
+			}
+
+			taken[candidate.receipt] = true
+			receiptID := receipts[candidate.receipt].ReceiptID
+			transaction.ReceiptID = &receiptID
+			transaction.MatchStatus = StatementMatched
+			transaction.MatchConfidence = candidate.confidence
+		}
+
+		for _, transaction := range transactions {
+			if err := tx.Model(&StatementTransaction{}).Where("transaction_id = ?", transaction.TransactionID).
+				Updates(map[string]interface{}{
+					"receipt_id":            transaction.ReceiptID,
+					"match_status":          transaction.MatchStatus,
+					"match_confidence":      transaction.MatchConfidence,
+					"candidate_receipt_ids": transaction.CandidateReceiptIDs,
+					"updated_at":            time.Now(),
+				}).Error; err != nil {
+				return fmt.Errorf("error saving statement match: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// statementCandidateReceipts loads the user's card receipts, and those with an unknown payment method,
+// dated around the transactions that the user hasn't already matched by hand
+func statementCandidateReceipts(tx *gorm.DB, userID uuid.UUID, transactions []StatementTransaction) ([]Receipt, error) {
+	first, last := transactions[0].PostedDate, transactions[0].PostedDate
+	for _, transaction := range transactions {
+		if transaction.PostedDate.Before(first) {
+			first = transaction.PostedDate
+		}
+		if transaction.PostedDate.After(last) {
+			last = transaction.PostedDate
+		}
+	}
+
+	var receipts []Receipt
+	err := tx.Omit("image", "items").
+		Where("user_id = ? AND (payment_method IS NULL OR payment_method NOT IN ?)", userID, []string{"cash", "gift_card"}).
+		Where("transaction_date BETWEEN ? AND ?",
+			first.AddDate(0, 0, -StatementPostingDaysAfter).Format("2006-01-02"),
+			last.AddDate(0, 0, StatementPostingDaysBefore).Format("2006-01-02")).
+		Where("receipt_id NOT IN (SELECT receipt_id FROM statement_transactions WHERE user_id = ? AND reviewed AND receipt_id IS NOT NULL)", userID).
+		Find(&receipts).Error
+	if err != nil {
+		return nil, fmt.Errorf("error loading receipts: %w", err)
+	}
+	return receipts, nil
+}
+
+// scoreStatementMatch rates how likely the receipt is the transaction's purchase. It reports false
+// when they can't be the same payment: another card, another sign, or too far apart.
+func scoreStatementMatch(transaction *StatementTransaction, receipt *Receipt) (float64, bool) {
+	if transaction.PaymentAccountID != nil && receipt.PaymentAccountID != nil && *transaction.PaymentAccountID != *receipt.PaymentAccountID {
+		return 0, false
+	}
+	if transaction.CardLastFour != "" && receipt.CardLastFour != "" && transaction.CardLastFour != receipt.CardLastFour {
+		return 0, false
+	}
+
+	amount := receipt.ExpenseAmount()
+	if (amount < 0) != (transaction.Amount < 0) {
+		return 0, false
+	}
+	difference := math.Abs(transaction.Amount - amount)
+	tolerance := math.Max(0.01, math.Abs(amount)*StatementAmountTolerance)
+	if difference > tolerance {
+		return 0, false
+	}
+
+	purchased, ok := receipt.TransactionDateTime()
+	if !ok {
+		return 0, false
+	}
+	purchaseDay := time.Date(purchased.Year(), purchased.Month(), purchased.Day(), 0, 0, 0, 0, time.UTC)
+	postedDay := time.Date(transaction.PostedDate.Year(), transaction.PostedDate.Month(), transaction.PostedDate.Day(), 0, 0, 0, 0, time.UTC)
+	lag := int(math.Round(postedDay.Sub(purchaseDay).Hours() / 24))
+	if lag < -StatementPostingDaysBefore || lag > StatementPostingDaysAfter {
+		return 0, false
+	}
+
+	amountScore := 1.0
+	if difference > 0.005 {
+		amountScore = 0.5 * (1 - difference/tolerance)
+	}
+	dateScore := 1 - math.Abs(float64(lag))/float64(StatementPostingDaysAfter+1)
+	merchantScore := merchantOverlap(receipt, transaction.NormalizedMerchant)
+
+	return roundConfidence(statementMatchAmountWeight*amountScore +
+		statementMatchDateWeight*dateScore +
+		statementMatchMerchantWeight*merchantScore), true
+}
+
+// merchantOverlap is the share of the receipt merchant's words found in the statement description.
+// Statements truncate names, so a word also counts when one is the start of the other.
+func merchantOverlap(receipt *Receipt, described string) float64 {
+	merchantWords := strings.Fields(NormalizeMerchantName(receipt.Merchant))
+	describedWords := strings.Fields(described)
+	if len(merchantWords) == 0 || len(describedWords) == 0 {
+		return 0
+	}
+
+	found := 0
+	for _, word := range merchantWords {
+		for _, describedWord := range describedWords {
+			if word == describedWord ||
+				len(describedWord) >= 3 && strings.HasPrefix(word, describedWord) ||
+				len(word) >= 3 && strings.HasPrefix(describedWord, word) {
+				found++
+				break
+			}
+		}
+	}
+	// Descriptions often join words, e.g. "SHOPPERSDRUGMART" for "SHOPPERS DRUG MART"
+	if found == 0 && strings.Contains(strings.ReplaceAll(described, " ", ""), strings.Join(merchantWords, "")) {
+		return 1
+	}
+	return float64(found) / float64(len(merchantWords))
+}
+
+// MatchStatementTransaction pairs a transaction with a receipt chosen by the user
+func MatchStatementTransaction(transaction *StatementTransaction, receiptID uuid.UUID) error {
+	DB := db.GetDBInstance()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var receipt Receipt
+		if err := tx.Omit("image").Where("receipt_id = ? AND user_id = ?", receiptID, transaction.UserID).
+			First(&receipt).Error; err != nil {
+			return fmt.Errorf("receipt not found: %w", err)
+		}
+
+		var matched int64
+		if err := tx.Model(&StatementTransaction{}).
+			Where("receipt_id = ? AND transaction_id <> ? AND reviewed", receiptID, transaction.TransactionID).
+			Count(&matched).Error; err != nil {
+			return fmt.Errorf("error checking receipt matches: %w", err)
+		}
+		if matched > 0 {
+			return ErrReceiptAlreadyMatched
+		}
+		// An automatic match on the receipt gives way to the user's choice
+		if err := tx.Model(&StatementTransaction{}).
+			Where("receipt_id = ? AND transaction_id <> ?", receiptID, transaction.TransactionID).
+			Updates(map[string]interface{}{"receipt_id": nil, "match_status": StatementUnmatched, "match_confidence": 0}).Error; err != nil {
+			return fmt.Errorf("error clearing previous match: %w", err)
+		}
+
+		transaction.ReceiptID = &receipt.ReceiptID
+		transaction.MatchStatus = StatementMatched
+		transaction.MatchConfidence = 1
+		return saveReviewedMatch(tx, transaction)
+	})
+}
+
+// UnmatchStatementTransaction removes a transaction's match. Ignored transactions are ones that need
+// no receipt; either way reconciliation won't match the transaction again.
+func UnmatchStatementTransaction(transaction *StatementTransaction, ignore bool) error {
+	DB := db.GetDBInstance()
+
+	transaction.ReceiptID = nil
+	transaction.MatchStatus = StatementUnmatched
+	if ignore {
+		transaction.MatchStatus = StatementIgnored
+	}
+	transaction.MatchConfidence = 0
+	return saveReviewedMatch(DB, transaction)
+}
+
+func saveReviewedMatch(tx *gorm.DB, transaction *StatementTransaction) error {
+	transaction.Reviewed = true
+	transaction.CandidateReceiptIDs = StringList{}
+	transaction.UpdatedAt = time.Now()
+	if err := tx.Model(&StatementTransaction{}).Where("transaction_id = ?", transaction.TransactionID).
+		Updates(map[string]interface{}{
+			"receipt_id":            transaction.ReceiptID,
+			"match_status":          transaction.MatchStatus,
+			"match_confidence":      transaction.MatchConfidence,
+			"candidate_receipt_ids": transaction.CandidateReceiptIDs,
+			"reviewed":              true,
+			"updated_at":            transaction.UpdatedAt,
+		}).Error; err != nil {
+		return fmt.Errorf("error saving statement match: %w", err)
+	}
+	return nil
+}
+
+// GetReconciliationReport sorts the user's statement transactions into matched, unmatched and
+// ambiguous, and lists the card receipts of the same period that no transaction accounts for
+func GetReconciliationReport(userID uuid.UUID, filter StatementFilter) (*ReconciliationReport, error) {
+	DB := db.GetDBInstance()
+
+	filter.Status = ""
+	transactions, err := GetStatementTransactions(userID, filter)
+	if err != nil {
+		return nil, fmt.Errorf("error loading statement transactions: %w", err)
+	}
+
+	report := &ReconciliationReport{
+		From:                       filter.From,
+		To:                         filter.To,
+		Matched:                    []StatementMatch{},
+		Unmatched:                  []StatementTransaction{},
+		Ambiguous:                  []AmbiguousStatementMatch{},
+		ReceiptsWithoutTransaction: []ReceiptSummary{},
+	}
+	if len(transactions) == 0 {
+		return report, nil
+	}
+
+	receiptIDs := []uuid.UUID{}
+	for _, transaction := range transactions {
+		if transaction.ReceiptID != nil {
+			receiptIDs = append(receiptIDs, *transaction.ReceiptID)
+		}
+		for _, id := range transaction.CandidateReceiptIDs {
+			if parsedID, err := uuid.Parse(id); err == nil {
+				receiptIDs = append(receiptIDs, parsedID)
+			}
+		}
+	}
+	summaries, err := receiptSummaries(DB.Where("receipt_id IN ?", receiptIDs), userID)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uuid.UUID]*ReceiptSummary, len(summaries))
+	for i := range summaries {
+		byID[summaries[i].ReceiptID] = &summaries[i]
+	}
+
+	first, last := transactions[0].PostedDate, transactions[0].PostedDate
+	for _, transaction := range transactions {
+		if transaction.PostedDate.Before(first) {
+			first = transaction.PostedDate
+		}
+		if transaction.PostedDate.After(last) {
+			last = transaction.PostedDate
+		}
+
+		switch transaction.MatchStatus {
+		case StatementMatched:
+			var summary *ReceiptSummary
+			if transaction.ReceiptID != nil {
+				summary = byID[*transaction.ReceiptID]
+			}
+			report.Matched = append(report.Matched, StatementMatch{Transaction: transaction, Receipt: summary})
+		case StatementAmbiguous:
+			ambiguous := AmbiguousStatementMatch{Transaction: transaction, Candidates: []ReceiptSummary{}}
+			for _, id := range transaction.CandidateReceiptIDs {
+				if parsedID, err := uuid.Parse(id); err == nil && byID[parsedID] != nil {
+					ambiguous.Candidates = append(ambiguous.Candidates, *byID[parsedID])
+				}
+			}
+			report.Ambiguous = append(report.Ambiguous, ambiguous)
+		case StatementIgnored:
+			report.Ignored++
+		default:
+			report.Unmatched = append(report.Unmatched, transaction)
+		}
+	}
+	if report.From == "" {
+		report.From = first.Format("2006-01-02")
+	}
+	if report.To == "" {
+		report.To = last.Format("2006-01-02")
+	}
+
+	// Purchases made in the last days of the period may only post on the next statement
+	through := report.To
+	if end, err := time.Parse("2006-01-02", report.To); err == nil {
+		through = end.AddDate(0, 0, -StatementPostingDaysAfter).Format("2006-01-02")
+	}
+	query := DB.Where("payment_method IN ?", []string{"credit", "debit"}).
+		Where("transaction_date BETWEEN ? AND ?", report.From, through).
+		Where("receipt_id NOT IN (SELECT receipt_id FROM statement_transactions WHERE user_id = ? AND receipt_id IS NOT NULL)", userID)
+	if filter.PaymentAccountID != nil {
+		query = query.Where("payment_account_id = ?", *filter.PaymentAccountID)
+	}
+	if report.ReceiptsWithoutTransaction, err = receiptSummaries(query.Order("transaction_date ASC"), userID); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
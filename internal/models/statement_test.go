@@ -0,0 +1,34 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestStatementCandidateReceipts(t *testing.T) {
+	tx, statements := dryRunDB(t)
+	transactions := []StatementTransaction{
+		{PostedDate: time.Date(2024, 3, 12, 0, 0, 0, 0, time.UTC)},
+		{PostedDate: time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)},
+	}
+	if _, err := statementCandidateReceipts(tx, uuid.New(), transactions); err != nil {
+		t.Fatalf("statementCandidateReceipts() = %v", err)
+	}
+	if len(*statements) != 1 {
+		t.Fatalf("statementCandidateReceipts() ran %d statements; want 1", len(*statements))
+	}
+
+	// A receipt whose tender wasn't read has no payment method, and NULL NOT IN (...) never holds
+	statement := (*statements)[0]
+	for _, want := range []string{
+		"(payment_method IS NULL OR payment_method NOT IN ('cash','gift_card'))",
+		"transaction_date BETWEEN '2024-02-28' AND '2024-03-13'",
+	} {
+		if !strings.Contains(statement, want) {
+			t.Errorf("statementCandidateReceipts() query = %s; want it to contain %s", statement, want)
+		}
+	}
+}
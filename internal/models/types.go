@@ -0,0 +1,56 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// StringList is a list of strings stored as a jsonb array
+type StringList []string
+
+// Value stores the list as a JSON array, never as null
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal([]string(l))
+	return string(data), err
+}
+
+// Scan reads the list from a JSON array
+func (l *StringList) Scan(value interface{}) error {
+	return scanJSON(value, l)
+}
+
+// Merge returns the list with the given values added, without duplicates and sorted
+func (l StringList) Merge(values ...string) StringList {
+	seen := map[string]bool{}
+	merged := StringList{}
+	for _, value := range append(append([]string{}, l...), values...) {
+		value = strings.TrimSpace(value)
+		if value == "" || seen[strings.ToLower(value)] {
+			continue
+		}
+		seen[strings.ToLower(value)] = true
+		merged = append(merged, value)
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+// scanJSON decodes a jsonb column into the destination
+func scanJSON(value interface{}, dest interface{}) error {
+	switch data := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(data, dest)
+	case string:
+		return json.Unmarshal([]byte(data), dest)
+	default:
+		return fmt.Errorf("unsupported jsonb value of type %T", value)
+	}
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"receipt-mgmt/db"
 	"time"
 
 	"github.com/google/uuid"
@@ -19,3 +20,21 @@ type User struct {
 	ResetPasswordExpires time.Time `json:"reset_password_expires"`
 	Currency          string    `gorm:"type:char(3);default:CAD;check:currency in ('CAD', 'USD')" json:"currency"`
 }
+
+
+// DefaultCurrency is used when a user has no currency set
+const DefaultCurrency = "CAD"
+
+// GetUserCurrency returns the currency the user reports their spending in
+func GetUserCurrency(userID uuid.UUID) (string, error) {
+	DB := db.GetDBInstance()
+
+	var user User
+	if err := DB.Select("currency").Where("user_id = ?", userID).First(&user).Error; err != nil {
+		return "", err
+	}
+	if user.Currency == "" {
+		return DefaultCurrency, nil
+	}
+	return user.Currency, nil
+}
@@ -19,7 +19,154 @@ func ReceiptRoutes(router *gin.Engine) {
 	{
 		receiptsGroup.POST("/upload", controller.UploadReceipt)
 		receiptsGroup.GET("/", controller.GetAllReceipts)       // Get all receipts
+		receiptsGroup.GET("/search", controller.SearchReceipts) // Full-text search, best match first
 		receiptsGroup.GET("/:id", controller.GetReceiptByID)   // Get single receipt
+		receiptsGroup.PATCH("/:id", controller.UpdateReceipt)  // Correct receipt fields
+		receiptsGroup.GET("/:id/corrections", controller.GetReceiptCorrections) // Audit of OCR vs corrected values
+		receiptsGroup.GET("/:id/items", controller.GetReceiptItems) // Get line items of a receipt
+		receiptsGroup.POST("/:id/items", controller.CreateReceiptItem) // Add a missing line item
+		receiptsGroup.PATCH("/:id/items/:itemId", controller.UpdateReceiptItem) // Correct a line item
+		receiptsGroup.DELETE("/:id/items/:itemId", controller.DeleteReceiptItem) // Remove a line item
+		receiptsGroup.PATCH("/:id/merchant", controller.CorrectReceiptMerchant) // Correct the merchant and learn an alias
+		receiptsGroup.GET("/:id/category-suggestions", controller.GetReceiptCategorySuggestions) // Ranked category suggestions
+		receiptsGroup.POST("/:id/category/accept", controller.AcceptReceiptCategory) // Confirm the suggested category
+		receiptsGroup.GET("/:id/splits", controller.GetReceiptSplits) // Per-category parts of the receipt
+		receiptsGroup.PUT("/:id/splits", controller.SplitReceipt) // Split the receipt across categories
+		receiptsGroup.DELETE("/:id/splits", controller.DeleteReceiptSplits) // Undo a split
+		receiptsGroup.GET("/:id/expense-matches", controller.GetReceiptExpenseMatches) // Manual expenses that may be this receipt
+		receiptsGroup.POST("/:id/expense/link", controller.LinkReceiptExpense) // Link a manual expense instead of a duplicate
 		receiptsGroup.DELETE("/:id", controller.DeleteReceipt) // Delete receipt
 	}
 }
+
+func ItemRoutes(router *gin.Engine) {
+	itemsGroup := router.Group("/api/v1/items")
+	itemsGroup.Use(middleware.AuthMiddleware())
+	{
+		itemsGroup.GET("/", controller.SearchItems) // Search line items across receipts
+		itemsGroup.GET("/price-history", controller.GetItemPriceHistory) // An item's price over time
+		itemsGroup.GET("/price-comparison", controller.CompareItemPrices) // An item's price at each merchant
+	}
+}
+
+func TaxRoutes(router *gin.Engine) {
+	taxesGroup := router.Group("/api/v1/taxes")
+	taxesGroup.Use(middleware.AuthMiddleware())
+	{
+		taxesGroup.GET("/summary", controller.GetTaxSummary) // GST/HST/PST/QST totals per period
+	}
+}
+
+func MerchantRoutes(router *gin.Engine) {
+	merchantsGroup := router.Group("/api/v1/merchants")
+	merchantsGroup.Use(middleware.AuthMiddleware())
+	{
+		merchantsGroup.GET("/", controller.GetMerchants)                                // List the user's merchants
+		merchantsGroup.GET("/:id", controller.GetMerchantByID)                          // Get a merchant and its aliases
+		merchantsGroup.POST("/:id/aliases", controller.AddMerchantAlias)                // Add a user alias
+		merchantsGroup.DELETE("/:id/aliases/:aliasId", controller.DeleteMerchantAlias) // Remove a user alias
+		merchantsGroup.POST("/:id/merge", controller.MergeMerchants)                    // Merge other merchants into this one
+	}
+}
+
+func PaymentAccountRoutes(router *gin.Engine) {
+	accountsGroup := router.Group("/api/v1/payment-accounts")
+	accountsGroup.Use(middleware.AuthMiddleware())
+	{
+		accountsGroup.GET("/", controller.GetPaymentAccounts)         // List the user's named cards
+		accountsGroup.POST("/", controller.CreatePaymentAccount)      // Name a card by its last four digits
+		accountsGroup.PATCH("/:id", controller.UpdatePaymentAccount)  // Rename or re-point an account
+		accountsGroup.DELETE("/:id", controller.DeletePaymentAccount) // Remove an account
+	}
+}
+
+func CategoryRoutes(router *gin.Engine) {
+	categoriesGroup := router.Group("/api/v1/categories")
+	categoriesGroup.Use(middleware.AuthMiddleware())
+	{
+		categoriesGroup.GET("/", controller.GetCategories)         // List default and user categories
+		categoriesGroup.GET("/:id", controller.GetCategoryByID)    // Get a category
+		categoriesGroup.POST("/", controller.CreateCategory)       // Create a user category
+		categoriesGroup.PATCH("/:id", controller.UpdateCategory)   // Edit a user category
+		categoriesGroup.DELETE("/:id", controller.DeleteCategory)  // Delete a user category, reassigning its receipts
+	}
+}
+
+func RuleRoutes(router *gin.Engine) {
+	rulesGroup := router.Group("/api/v1/rules")
+	rulesGroup.Use(middleware.AuthMiddleware())
+	{
+		rulesGroup.GET("/", controller.GetRules)               // List the user's rules in priority order
+		rulesGroup.POST("/", controller.CreateRule)            // Add a rule
+		rulesGroup.POST("/dry-run", controller.DryRunRules)    // Preview rules against past receipts
+		rulesGroup.POST("/apply", controller.ApplyRules)       // Apply rules to past receipts
+		rulesGroup.GET("/:id", controller.GetRuleByID)         // Get a rule
+		rulesGroup.PATCH("/:id", controller.UpdateRule)        // Edit a rule
+		rulesGroup.DELETE("/:id", controller.DeleteRule)       // Remove a rule
+	}
+}
+
+func ExpenseRoutes(router *gin.Engine) {
+	expensesGroup := router.Group("/api/v1/expenses")
+	expensesGroup.Use(middleware.AuthMiddleware())
+	{
+		expensesGroup.GET("/", controller.GetExpenses)         // List and filter the user's expenses
+		expensesGroup.GET("/:id", controller.GetExpenseByID)   // Get an expense, ?expand=receipt embeds its receipt
+		expensesGroup.PATCH("/:id", controller.UpdateExpense)  // Edit an expense
+		expensesGroup.DELETE("/:id", controller.DeleteExpense) // Delete an expense without a receipt
+	}
+}
+
+func StatementRoutes(router *gin.Engine) {
+	statementsGroup := router.Group("/api/v1/statements")
+	statementsGroup.Use(middleware.AuthMiddleware())
+	{
+		statementsGroup.POST("/imports", controller.ImportStatement)                              // Import a CSV, OFX or QFX statement and reconcile it
+		statementsGroup.GET("/imports", controller.GetStatementImports)                           // List imported statements
+		statementsGroup.DELETE("/imports/:id", controller.DeleteStatementImport)                  // Delete a statement and its transactions
+		statementsGroup.GET("/transactions", controller.GetStatementTransactions)                 // List and filter statement transactions
+		statementsGroup.PUT("/transactions/:id/match", controller.MatchStatementTransaction)      // Match a transaction to a receipt by hand
+		statementsGroup.DELETE("/transactions/:id/match", controller.UnmatchStatementTransaction) // Unmatch, or ?ignore=true when no receipt is needed
+		statementsGroup.POST("/reconcile", controller.ReconcileStatements)                        // Match transactions to receipts again
+		statementsGroup.GET("/reconciliation", controller.GetReconciliationReport)                // Matched, unmatched and ambiguous report
+	}
+}
+
+func RecurringRoutes(router *gin.Engine) {
+	recurringGroup := router.Group("/api/v1/recurring")
+	recurringGroup.Use(middleware.AuthMiddleware())
+	{
+		recurringGroup.GET("/", controller.GetRecurringSeries)                 // Recurring charges and their annualized cost
+		recurringGroup.POST("/detect", controller.DetectRecurringSeries)       // Analyze the expenses again
+		recurringGroup.GET("/:id", controller.GetRecurringSeriesByID)          // A series with its occurrences
+		recurringGroup.POST("/:id/confirm", controller.ConfirmRecurringSeries) // Confirm a detected series
+		recurringGroup.POST("/:id/dismiss", controller.DismissRecurringSeries) // Dismiss a detected series
+	}
+}
+
+func BudgetRoutes(router *gin.Engine) {
+	budgetsGroup := router.Group("/api/v1/budgets")
+	budgetsGroup.Use(middleware.AuthMiddleware())
+	{
+		budgetsGroup.GET("/", controller.GetBudgets)                                    // Budgets with spent and remaining for the period
+		budgetsGroup.POST("/", controller.CreateBudget)                                 // Set a limit for a category
+		budgetsGroup.GET("/alerts", controller.GetBudgetAlerts)                         // Threshold alerts raised by uploads
+		budgetsGroup.POST("/alerts/:id/acknowledge", controller.AcknowledgeBudgetAlert) // Mark an alert as seen
+		budgetsGroup.GET("/:id", controller.GetBudgetByID)                              // A budget's progress, ?date= for another period
+		budgetsGroup.PATCH("/:id", controller.UpdateBudget)                             // Edit a budget
+		budgetsGroup.DELETE("/:id", controller.DeleteBudget)                            // Remove a budget
+	}
+}
+
+func AnalyticsRoutes(router *gin.Engine) {
+	analyticsGroup := router.Group("/api/v1/analytics")
+	analyticsGroup.Use(middleware.AuthMiddleware())
+	{
+		analyticsGroup.GET("/summary", controller.GetSpendingSummary)       // Spending, refund, tax and discount totals
+		analyticsGroup.GET("/categories", controller.GetSpendingByCategory) // Net spending per category
+		analyticsGroup.GET("/merchants", controller.GetSpendingByMerchant)  // Top merchants, ?limit=
+		analyticsGroup.GET("/monthly", controller.GetSpendingByMonth)       // Spending of every month in the range
+		analyticsGroup.GET("/patterns", controller.GetSpendingPatterns)     // Day-of-week and hour-of-day spending
+		analyticsGroup.GET("/compare", controller.CompareSpending)          // Against the previous period or compare_from/compare_to
+	}
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+)
+
+// usStateCodes are the two-letter codes of US states, used to spot US merchant addresses
+var usStateCodes = map[string]bool{
+	"AL": true, "AK": true, "AZ": true, "AR": true, "CA": true, "CO": true, "CT": true, "DE": true,
+	"DC": true, "FL": true, "GA": true, "HI": true, "ID": true, "IL": true, "IN": true, "IA": true,
+	"KS": true, "KY": true, "LA": true, "ME": true, "MD": true, "MA": true, "MI": true, "MN": true,
+	"MS": true, "MO": true, "MT": true, "NE": true, "NV": true, "NH": true, "NJ": true, "NM": true,
+	"NY": true, "NC": true, "ND": true, "OH": true, "OK": true, "OR": true, "PA": true, "RI": true,
+	"SC": true, "SD": true, "TN": true, "TX": true, "UT": true, "VT": true, "VA": true, "WA": true,
+	"WV": true, "WI": true, "WY": true,
+}
+
+// currencyMarkers maps the currency codes and symbols printed on receipts to an ISO code.
+// Plain "$" is ambiguous and deliberately left out.
+var currencyMarkers = []struct {
+	pattern  *regexp.Regexp
+	currency string
+}{
+	{regexp.MustCompile(`(?i)\b(USD|US\s?\$|U\.S\.\s?DOLLARS?)`), "USD"},
+	{regexp.MustCompile(`(?i)\b(CAD|CDN\s?\$?|C\$|CA\$)`), "CAD"},
+	{regexp.MustCompile(`(?i)(\bEUR\b|€)`), "EUR"},
+	{regexp.MustCompile(`(?i)(\bGBP\b|£)`), "GBP"},
+	{regexp.MustCompile(`(?i)\bMXN\b`), "MXN"},
+}
+
+var usStatePattern = regexp.MustCompile(`\b([A-Z]{2})\s+\d{5}(?:-\d{4})?\b`)
+
+// DetectCurrency works out the receipt currency from the analyzer's valueCurrency, then the
+// currency codes and symbols printed on the receipt, then the merchant's country and the locale.
+// It returns an empty string when nothing points to a currency.
+func DetectCurrency(fields map[string]interface{}, lines []string, merchant MerchantDetails, locale string) string {
+	if total, ok := fields["Total"].(map[string]interface{}); ok {
+		if value, ok := total["valueCurrency"].(map[string]interface{}); ok {
+			if code, ok := value["currencyCode"].(string); ok && len(code) == 3 {
+				return strings.ToUpper(code)
+			}
+		}
+	}
+
+	// Count the printed markers so a single stray mention doesn't win
+	counts := map[string]int{}
+	for _, line := range lines {
+		for _, marker := range currencyMarkers {
+			if marker.pattern.MatchString(line) {
+				counts[marker.currency]++
+			}
+		}
+	}
+	best, bestCount := "", 0
+	for _, marker := range currencyMarkers {
+		if counts[marker.currency] > bestCount {
+			best, bestCount = marker.currency, counts[marker.currency]
+		}
+	}
+	if best != "" {
+		return best
+	}
+
+	if currency := countryCurrency(merchant); currency != "" {
+		return currency
+	}
+
+	// French-Canadian receipts print "12,99 $" for Canadian dollars
+	if locale == LocaleFrCA {
+		return "CAD"
+	}
+	return ""
+}
+
+// countryCurrency infers the currency from the merchant's address
+func countryCurrency(merchant MerchantDetails) string {
+	if merchant.Province != "" || postalCodePattern.MatchString(strings.ToUpper(merchant.PostalCode)) {
+		return "CAD"
+	}
+	if match := usStatePattern.FindStringSubmatch(strings.ToUpper(merchant.Address)); match != nil && usStateCodes[match[1]] {
+		return "USD"
+	}
+	return ""
+}
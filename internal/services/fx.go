@@ -0,0 +1,198 @@
+package services
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// RateProvider returns the exchange rate to convert one unit of a currency into another on a given day
+type RateProvider interface {
+	Rate(from, to string, on time.Time) (float64, error)
+}
+
+// RateProviderFactory builds a rate provider from the application configuration
+type RateProviderFactory func() (RateProvider, error)
+
+var (
+	rateProviderFactories = map[string]RateProviderFactory{
+		"file": func() (RateProvider, error) {
+			return LoadFileRateProvider(viper.GetString("fx.rates_file"))
+		},
+	}
+	rateProvider      RateProvider
+	rateProviderMutex sync.Mutex
+)
+
+// defaultBaseCurrency is the currency rates are triangulated through when fx.base_currency isn't set
+const defaultBaseCurrency = "CAD"
+
+// RegisterRateProvider makes a rate provider available under the given name for the fx.provider setting
+func RegisterRateProvider(name string, factory RateProviderFactory) {
+	rateProviderFactories[name] = factory
+}
+
+// GetRateProvider returns the rate provider selected by the fx.provider setting, loading it on first use.
+// A provider that fails to load is retried on the next call rather than kept failing.
+func GetRateProvider() (RateProvider, error) {
+	rateProviderMutex.Lock()
+	defer rateProviderMutex.Unlock()
+	if rateProvider != nil {
+		return rateProvider, nil
+	}
+
+	name := viper.GetString("fx.provider")
+	if name == "" {
+		name = "file"
+	}
+	factory, ok := rateProviderFactories[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown fx rate provider: %s", name)
+	}
+	provider, err := factory()
+	if err != nil {
+		return nil, err
+	}
+	rateProvider = provider
+	return rateProvider, nil
+}
+
+// ConvertAmount converts an amount between currencies using the rate on the given day.
+// It returns the converted amount and the rate that was applied.
+func ConvertAmount(provider RateProvider, amount float64, from, to string, on time.Time) (float64, float64, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	if from == to {
+		return amount, 1, nil
+	}
+
+	rate, err := CrossRate(provider, from, to, on, viper.GetString("fx.base_currency"))
+	if err != nil {
+		return 0, 0, err
+	}
+	return roundCents(amount * rate), rate, nil
+}
+
+// CrossRate returns the rate between two currencies on the given day, going through the base
+// currency (CAD by default) when the provider has no rate for the pair itself, e.g. EUR to USD
+// from the EUR/CAD and USD/CAD rates
+func CrossRate(provider RateProvider, from, to string, on time.Time, base string) (float64, error) {
+	rate, err := provider.Rate(from, to, on)
+	if err == nil {
+		return rate, nil
+	}
+
+	base = strings.ToUpper(base)
+	if base == "" {
+		base = defaultBaseCurrency
+	}
+	if from == base || to == base {
+		return 0, err
+	}
+	fromBase, fromErr := provider.Rate(from, base, on)
+	toBase, toErr := provider.Rate(base, to, on)
+	if fromErr != nil || toErr != nil {
+		return 0, err
+	}
+	return fromBase * toBase, nil
+}
+
+// datedRate is the rate of a currency pair from a given day onwards
+type datedRate struct {
+	date time.Time
+	rate float64
+}
+
+// FileRateProvider serves rates from an offline table, so conversions are reproducible without network access.
+// The file is a CSV of date,from,to,rate rows; a row applies from its date until the next row for the pair.
+type FileRateProvider struct {
+	rates map[string][]datedRate // Keyed by "FROM/TO", sorted by date
+}
+
+// LoadFileRateProvider reads the rates table from the given CSV file
+func LoadFileRateProvider(path string) (*FileRateProvider, error) {
+	if path == "" {
+		return nil, fmt.Errorf("fx rates file is not configured")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open fx rates file: %v", err)
+	}
+	defer file.Close()
+
+	return ParseRatesTable(file)
+}
+
+// ParseRatesTable reads a date,from,to,rate CSV table, skipping the header and comment lines
+func ParseRatesTable(reader io.Reader) (*FileRateProvider, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.Comment = '#'
+	csvReader.FieldsPerRecord = 4
+	csvReader.TrimLeadingSpace = true
+
+	provider := &FileRateProvider{rates: map[string][]datedRate{}}
+	for line := 1; ; line++ {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fx rates: %v", err)
+		}
+		if line == 1 && strings.EqualFold(record[0], "date") {
+			continue
+		}
+
+		date, err := time.Parse("2006-01-02", record[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid date %q in fx rates: %v", record[0], err)
+		}
+		rate, err := strconv.ParseFloat(record[3], 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("invalid rate %q in fx rates", record[3])
+		}
+
+		key := strings.ToUpper(record[1]) + "/" + strings.ToUpper(record[2])
+		provider.rates[key] = append(provider.rates[key], datedRate{date: date, rate: rate})
+	}
+
+	for key := range provider.rates {
+		rates := provider.rates[key]
+		sort.Slice(rates, func(i, j int) bool { return rates[i].date.Before(rates[j].date) })
+	}
+	return provider, nil
+}
+
+// Rate returns the latest rate on or before the given day, using the inverse pair when only it is listed
+func (p *FileRateProvider) Rate(from, to string, on time.Time) (float64, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	if from == to {
+		return 1, nil
+	}
+
+	if rate, ok := p.lookup(from+"/"+to, on); ok {
+		return rate, nil
+	}
+	if rate, ok := p.lookup(to+"/"+from, on); ok {
+		return 1 / rate, nil
+	}
+	return 0, fmt.Errorf("no %s/%s exchange rate on or before %s", from, to, on.Format("2006-01-02"))
+}
+
+// lookup finds the rate of a pair in effect on the given day
+func (p *FileRateProvider) lookup(key string, on time.Time) (float64, bool) {
+	rates := p.rates[key]
+	index := sort.Search(len(rates), func(i int) bool { return rates[i].date.After(on) })
+	if index == 0 {
+		return 0, false
+	}
+	return rates[index-1].rate, true
+}
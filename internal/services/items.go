@@ -0,0 +1,167 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ReceiptLineItem is a single purchased item extracted from the receipt
+type ReceiptLineItem struct {
+	Name        string  `json:"name"`
+	ProductCode string  `json:"productCode,omitempty"`
+	Quantity    float64 `json:"quantity"`
+	UnitPrice   float64 `json:"unitPrice"`
+	TotalPrice  float64 `json:"totalPrice"`
+	Discount    float64 `json:"discount,omitempty"`
+	Confidence  float64 `json:"confidence"`
+}
+
+// parseLineItems extracts every item and its sub-fields from the analyzer's Items field
+func parseLineItems(items map[string]interface{}, locale string) ([]ReceiptLineItem, error) {
+	lineItems := []ReceiptLineItem{}
+
+	// Check if items have the expected structure
+	valueArray, ok := items["valueArray"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid items structure")
+	}
+
+	for _, item := range valueArray {
+		itemMap, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		valueObject, ok := itemMap["valueObject"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		lineItem := ReceiptLineItem{}
+		confidences := []float64{}
+
+		// Extract Name (using valueString, then text)
+		if name, ok := valueObject["Name"].(map[string]interface{}); ok {
+			lineItem.Name = fieldString(name)
+			confidences = appendConfidence(confidences, name)
+		}
+
+		// Extract the product code (SKU) when the analyzer found one
+		if code, ok := valueObject["ProductCode"].(map[string]interface{}); ok {
+			lineItem.ProductCode = fieldString(code)
+			confidences = appendConfidence(confidences, code)
+		}
+
+		// Extract Quantity, Price (unit price), TotalPrice and Discount
+		if quantity, ok := valueObject["Quantity"].(map[string]interface{}); ok {
+			lineItem.Quantity, _ = fieldNumber(quantity, locale)
+			confidences = appendConfidence(confidences, quantity)
+		}
+		if price, ok := valueObject["Price"].(map[string]interface{}); ok {
+			lineItem.UnitPrice, _ = fieldNumber(price, locale)
+			confidences = appendConfidence(confidences, price)
+		}
+		hasTotal := false
+		if totalPrice, ok := valueObject["TotalPrice"].(map[string]interface{}); ok {
+			lineItem.TotalPrice, hasTotal = fieldNumber(totalPrice, locale)
+			confidences = appendConfidence(confidences, totalPrice)
+		}
+		if discount, ok := valueObject["Discount"].(map[string]interface{}); ok {
+			discountAmount, _ := fieldNumber(discount, locale)
+			lineItem.Discount = math.Abs(discountAmount)
+			confidences = appendConfidence(confidences, discount)
+		}
+
+		// Skip entries that carry neither a name nor any amount
+		if lineItem.Name == "" && !hasTotal && lineItem.UnitPrice == 0 {
+			continue
+		}
+
+		// Fill in whatever the analyzer left out from the other values
+		if lineItem.Quantity <= 0 {
+			lineItem.Quantity = 1
+		}
+		if !hasTotal && lineItem.UnitPrice != 0 {
+			lineItem.TotalPrice = roundCents(lineItem.UnitPrice*lineItem.Quantity - lineItem.Discount)
+		}
+		if lineItem.UnitPrice == 0 && lineItem.TotalPrice != 0 {
+			lineItem.UnitPrice = roundCents((lineItem.TotalPrice + lineItem.Discount) / lineItem.Quantity)
+		}
+
+		// Prefer the item-level confidence, otherwise average the sub-fields
+		if confidence, ok := itemMap["confidence"].(float64); ok {
+			lineItem.Confidence = confidence
+		} else if len(confidences) > 0 {
+			sum := 0.0
+			for _, c := range confidences {
+				sum += c
+			}
+			lineItem.Confidence = sum / float64(len(confidences))
+		}
+
+		lineItems = append(lineItems, lineItem)
+	}
+
+	return lineItems, nil
+}
+
+// cleanItems builds the legacy items view (name and total price only) from the parsed line items
+func cleanItems(lineItems []ReceiptLineItem) []map[string]interface{} {
+	cleanedItems := []map[string]interface{}{}
+
+	for _, item := range lineItems {
+		// Only add the item if it has both name and price
+		if item.Name == "" || item.TotalPrice == 0 {
+			continue
+		}
+		cleanedItems = append(cleanedItems, map[string]interface{}{
+			"name":       item.Name,
+			"totalPrice": item.TotalPrice,
+		})
+	}
+
+	return cleanedItems
+}
+
+// fieldString returns the string value of an analyzer field, falling back to its raw text
+func fieldString(field map[string]interface{}) string {
+	if val, ok := field["valueString"].(string); ok && strings.TrimSpace(val) != "" {
+		return strings.TrimSpace(val)
+	}
+	if val, ok := field["text"].(string); ok {
+		return strings.TrimSpace(val)
+	}
+	return ""
+}
+
+// fieldNumber returns the numeric value of an analyzer field, falling back to parsing its text in the receipt locale
+func fieldNumber(field map[string]interface{}, locale string) (float64, bool) {
+	if val, ok := field["valueNumber"].(float64); ok {
+		return val, true
+	}
+	if val, ok := field["valueInteger"].(float64); ok {
+		return val, true
+	}
+	for _, key := range []string{"valueString", "text"} {
+		if text, ok := field[key].(string); ok {
+			if val, ok := ParseAmount(text, locale); ok {
+				return val, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// appendConfidence adds the field's confidence score to the list when present
+func appendConfidence(confidences []float64, field map[string]interface{}) []float64 {
+	if confidence, ok := field["confidence"].(float64); ok {
+		return append(confidences, confidence)
+	}
+	return confidences
+}
+
+// roundCents rounds an amount to two decimal places
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,268 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported receipt locales
+const (
+	LocaleEnCA = "en-CA"
+	LocaleFrCA = "fr-CA"
+)
+
+// NormalizeLocale maps a locale hint such as "fr", "fr_CA" or "EN-ca" to a supported locale.
+// It returns an empty string when the hint isn't supported.
+func NormalizeLocale(hint string) string {
+	language := strings.ToLower(strings.TrimSpace(hint))
+	if index := strings.IndexAny(language, "-_"); index >= 0 {
+		language = language[:index]
+	}
+
+	switch language {
+	case "fr":
+		return LocaleFrCA
+	case "en":
+		return LocaleEnCA
+	}
+	return ""
+}
+
+var (
+	frenchMarkers  = regexp.MustCompile(`(?i)\b(TPS|TVQ|TVH|SOUS[- ]TOTAL|MERCI|MONNAIE|COMPTANT|ACHAT|ARTICLES?|CAISSE|FACTURE|RABAIS|ÉPARGNE|EPARGNE)\b`)
+	englishMarkers = regexp.MustCompile(`(?i)\b(GST|HST|PST|QST|SUBTOTAL|SUB TOTAL|THANK YOU|CHANGE|CASH|PURCHASE|ITEMS?|CASHIER|INVOICE|SAVINGS?)\b`)
+	commaAmount    = regexp.MustCompile(`\d,\d{2}(?:\s*\$)?(?:\s|$)`)
+	pointAmount    = regexp.MustCompile(`\d\.\d{2}(?:\s|$)`)
+)
+
+// DetectLocale guesses the receipt locale from French and English words and the decimal
+// separator used in the amounts, defaulting to en-CA
+func DetectLocale(lines []string) string {
+	french, english := 0, 0
+	for _, line := range lines {
+		french += len(frenchMarkers.FindAllString(line, -1)) + len(commaAmount.FindAllString(line, -1))
+		english += len(englishMarkers.FindAllString(line, -1)) + len(pointAmount.FindAllString(line, -1))
+		for _, word := range strings.Fields(strings.ToLower(line)) {
+			if month, ok := monthNames[strings.Trim(word, ".,")]; ok && month.french {
+				french++
+			}
+		}
+	}
+
+	if french > english {
+		return LocaleFrCA
+	}
+	return LocaleEnCA
+}
+
+// decimalSeparator returns the decimal separator of the locale
+func decimalSeparator(locale string) string {
+	if locale == LocaleFrCA {
+		return ","
+	}
+	return "."
+}
+
+var (
+	amountNoise  = regexp.MustCompile(`[$€£\s\x{00A0}\x{202F}]|\p{L}`)
+	amountDigits = regexp.MustCompile(`^[\d.,]+$`)
+)
+
+// ParseAmount parses an amount as printed on a receipt, e.g. "12,99 $", "$1,234.56", "1 234,56"
+// or "5.00-". When a single separator is followed by exactly three digits, the locale decides
+// whether it is a decimal or a thousands separator.
+func ParseAmount(text, locale string) (float64, bool) {
+	value := strings.TrimSpace(text)
+	negative := false
+	if strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")") {
+		negative = true
+		value = value[1 : len(value)-1]
+	}
+	value = amountNoise.ReplaceAllString(value, "")
+	if strings.HasPrefix(value, "-") || strings.HasSuffix(value, "-") {
+		negative = true
+		value = strings.Trim(value, "-")
+	}
+	if !amountDigits.MatchString(value) {
+		return 0, false
+	}
+
+	// Work out which separator, if any, marks the decimals
+	decimal := ""
+	lastDot, lastComma := strings.LastIndex(value, "."), strings.LastIndex(value, ",")
+	switch {
+	case lastDot >= 0 && lastComma >= 0:
+		decimal = "."
+		if lastComma > lastDot {
+			decimal = ","
+		}
+	case lastDot >= 0 || lastComma >= 0:
+		separator, index := ".", lastDot
+		if lastComma >= 0 {
+			separator, index = ",", lastComma
+		}
+		digitsAfter := len(value) - index - 1
+		if strings.Count(value, separator) == 1 && (digitsAfter != 3 || separator == decimalSeparator(locale)) {
+			decimal = separator
+		}
+	}
+
+	whole, fraction := value, ""
+	if decimal != "" {
+		index := strings.LastIndex(value, decimal)
+		whole, fraction = value[:index], value[index+1:]
+	}
+	whole = strings.NewReplacer(".", "", ",", "").Replace(whole)
+	if strings.ContainsAny(fraction, ".,") || (whole == "" && fraction == "") {
+		return 0, false
+	}
+
+	amount, err := strconv.ParseFloat(whole+"."+fraction+"0", 64)
+	if err != nil {
+		return 0, false
+	}
+	if negative {
+		amount = -amount
+	}
+	return amount, true
+}
+
+// monthName is a month as spelled on receipts
+type monthName struct {
+	month  time.Month
+	french bool
+}
+
+// monthNames maps English and French month names and abbreviations to their month
+var monthNames = map[string]monthName{
+	"january": {time.January, false}, "jan": {time.January, false},
+	"february": {time.February, false}, "feb": {time.February, false},
+	"march": {time.March, false}, "mar": {time.March, false},
+	"april": {time.April, false}, "apr": {time.April, false},
+	"may":  {time.May, false},
+	"june": {time.June, false}, "jun": {time.June, false},
+	"july": {time.July, false}, "jul": {time.July, false},
+	"august": {time.August, false}, "aug": {time.August, false},
+	"september": {time.September, false}, "sep": {time.September, false},
+	"october":  {time.October, false},
+	"november": {time.November, false},
+	"december": {time.December, false},
+	"oct":      {time.October, false}, "nov": {time.November, false}, "dec": {time.December, false}, "sept": {time.September, false},
+	"janvier": {time.January, true}, "janv": {time.January, true},
+	"février": {time.February, true}, "fevrier": {time.February, true}, "févr": {time.February, true}, "fevr": {time.February, true}, "fév": {time.February, true},
+	"mars":  {time.March, true},
+	"avril": {time.April, true}, "avr": {time.April, true},
+	"mai":     {time.May, true},
+	"juin":    {time.June, true},
+	"juillet": {time.July, true}, "juil": {time.July, true},
+	"août": {time.August, true}, "aout": {time.August, true},
+	"septembre": {time.September, true},
+	"octobre":   {time.October, true},
+	"novembre":  {time.November, true},
+	"décembre":  {time.December, true}, "decembre": {time.December, true}, "déc": {time.December, true},
+}
+
+var (
+	isoDatePattern      = regexp.MustCompile(`\b(\d{4})[-/.](\d{1,2})[-/.](\d{1,2})\b`)
+	numericDatePattern  = regexp.MustCompile(`\b(\d{1,2})[-/.](\d{1,2})[-/.](\d{4}|\d{2})\b`)
+	dayMonthNamePattern = regexp.MustCompile(`(?i)\b(\d{1,2})(?:er)?\s+([\p{L}]+)\.?,?\s+(\d{4})\b`)
+	monthNameDayPattern = regexp.MustCompile(`(?i)\b([\p{L}]+)\.?\s+(\d{1,2}),?\s+(\d{4})\b`)
+	clockPattern        = regexp.MustCompile(`(?i)\b(\d{1,2})\s*(?::|h)\s*(\d{2})(?:\s*:\s*(\d{2}))?(?:\s*([AP])\.?M\.?)?`)
+)
+
+// ParseDate parses a date as printed on a receipt, such as "2024-03-15", "15/03/2024",
+// "15 mars 2024" or "Mar 15, 2024". Numeric day and month are read in the locale's order
+// (day first for fr-CA, month first for en-CA) unless only the other order is valid.
+func ParseDate(text, locale string) (time.Time, bool) {
+	if match := isoDatePattern.FindStringSubmatch(text); match != nil {
+		return buildDate(match[1], match[2], match[3])
+	}
+
+	for _, match := range dayMonthNamePattern.FindAllStringSubmatch(text, -1) {
+		if month, ok := monthNames[strings.ToLower(match[2])]; ok {
+			return buildDate(match[3], strconv.Itoa(int(month.month)), match[1])
+		}
+	}
+	for _, match := range monthNameDayPattern.FindAllStringSubmatch(text, -1) {
+		if month, ok := monthNames[strings.ToLower(match[1])]; ok {
+			return buildDate(match[3], strconv.Itoa(int(month.month)), match[2])
+		}
+	}
+
+	if match := numericDatePattern.FindStringSubmatch(text); match != nil {
+		year := match[3]
+		if len(year) == 2 {
+			year = "20" + year
+		}
+		first, second := match[1], match[2]
+		day, month := second, first
+		if locale == LocaleFrCA {
+			day, month = first, second
+		}
+		if date, ok := buildDate(year, month, day); ok {
+			return date, true
+		}
+		return buildDate(year, day, month)
+	}
+
+	return time.Time{}, false
+}
+
+// buildDate returns the date when the parts make up a valid calendar day
+func buildDate(year, month, day string) (time.Time, bool) {
+	y, errYear := strconv.Atoi(year)
+	m, errMonth := strconv.Atoi(month)
+	d, errDay := strconv.Atoi(day)
+	if errYear != nil || errMonth != nil || errDay != nil || m < 1 || m > 12 || d < 1 {
+		return time.Time{}, false
+	}
+
+	date := time.Date(y, time.Month(m), d, 0, 0, 0, 0, time.UTC)
+	if date.Day() != d {
+		// e.g. February 30th rolled over into March
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+// ParseClockTime parses a time of day such as "14:32", "14 h 32" or "2:32 PM" into "15:04:05" form
+func ParseClockTime(text string) (string, bool) {
+	match := clockPattern.FindStringSubmatch(text)
+	if match == nil {
+		return "", false
+	}
+
+	hour, _ := strconv.Atoi(match[1])
+	minute, _ := strconv.Atoi(match[2])
+	second := 0
+	if match[3] != "" {
+		second, _ = strconv.Atoi(match[3])
+	}
+	switch strings.ToUpper(match[4]) {
+	case "P":
+		if hour < 12 {
+			hour += 12
+		}
+	case "A":
+		if hour == 12 {
+			hour = 0
+		}
+	}
+	if hour > 23 || minute > 59 || second > 59 {
+		return "", false
+	}
+	return fmt.Sprintf("%02d:%02d:%02d", hour, minute, second), true
+}
+
+// findDateInLines returns the first date printed in the receipt text
+func findDateInLines(lines []string, locale string) (time.Time, bool) {
+	for _, line := range lines {
+		if date, ok := ParseDate(line, locale); ok {
+			return date, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,193 @@
+package services
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// expectedReceipt is the part of a parsed receipt checked against a fixture's .expected.json
+type expectedReceipt struct {
+	Merchant        string  `json:"merchant"`
+	Locale          string  `json:"locale"`
+	Currency        string  `json:"currency"`
+	TransactionDate string  `json:"transactionDate"`
+	TransactionTime string  `json:"transactionTime"`
+	TotalAmount     float64 `json:"totalAmount"`
+	Subtotal        float64 `json:"subtotal"`
+	Tax             float64 `json:"tax"`
+	Discounts       float64 `json:"discounts"`
+	LineItems       []struct {
+		Name       string  `json:"name"`
+		TotalPrice float64 `json:"totalPrice"`
+	} `json:"lineItems"`
+	Taxes []TaxComponent `json:"taxes"`
+}
+
+func TestParseReceiptInformationFixtures(t *testing.T) {
+	tests := []struct {
+		fixture string
+		locale  string
+	}{
+		{"receipt_en_CA", ""},
+		{"receipt_fr_CA", ""},
+		{"receipt_fr_CA", "fr"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture+"/"+tt.locale, func(t *testing.T) {
+			var response map[string]interface{}
+			readFixture(t, tt.fixture+".json", &response)
+			var want expectedReceipt
+			readFixture(t, tt.fixture+".expected.json", &want)
+
+			result, err := ParseReceiptInformation(response, tt.locale)
+			if err != nil {
+				t.Fatalf("ParseReceiptInformation() error = %v", err)
+			}
+
+			// Round-trip through JSON so the result is compared on the same fields
+			encoded, err := json.Marshal(result)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got expectedReceipt
+			if err := json.Unmarshal(encoded, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("ParseReceiptInformation() =\n%+v\nwant\n%+v", got, want)
+			}
+		})
+	}
+}
+
+func readFixture(t *testing.T, name string, value interface{}) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		t.Fatalf("invalid fixture %s: %v", name, err)
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		text   string
+		locale string
+		want   float64
+		ok     bool
+	}{
+		{"12.99", LocaleEnCA, 12.99, true},
+		{"$1,234.56", LocaleEnCA, 1234.56, true},
+		{"12,99 $", LocaleFrCA, 12.99, true},
+		{"1 234,56", LocaleFrCA, 1234.56, true},
+		{"1.234,56", LocaleFrCA, 1234.56, true},
+		{"1,249", LocaleEnCA, 1249, true},
+		{"1,249", LocaleFrCA, 1.249, true},
+		{"1.249", LocaleEnCA, 1.249, true},
+		{"1.249", LocaleFrCA, 1249, true},
+		{"5.00-", LocaleEnCA, -5, true},
+		{"(3.50)", LocaleEnCA, -3.5, true},
+		{"-2,00", LocaleFrCA, -2, true},
+		{"7", LocaleEnCA, 7, true},
+		{"", LocaleEnCA, 0, false},
+		{"N/A", LocaleEnCA, 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := ParseAmount(tt.text, tt.locale)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("ParseAmount(%q, %s) = %v, %v; want %v, %v", tt.text, tt.locale, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		text   string
+		locale string
+		want   string
+	}{
+		{"2024-03-15", LocaleEnCA, "2024-03-15"},
+		{"2024/3/5", LocaleFrCA, "2024-03-05"},
+		{"03/04/2024", LocaleEnCA, "2024-03-04"},
+		{"03/04/2024", LocaleFrCA, "2024-04-03"},
+		{"15/03/2024", LocaleEnCA, "2024-03-15"},
+		{"03/15/24", LocaleFrCA, "2024-03-15"},
+		{"15 mars 2024", LocaleFrCA, "2024-03-15"},
+		{"1er février 2024", LocaleFrCA, "2024-02-01"},
+		{"Mar 15, 2024", LocaleEnCA, "2024-03-15"},
+		{"DATE: 15 MAR 2024 14:32", LocaleEnCA, "2024-03-15"},
+		{"30/02/2024", LocaleFrCA, ""},
+		{"TOTAL 12.99", LocaleEnCA, ""},
+	}
+
+	for _, tt := range tests {
+		date, ok := ParseDate(tt.text, tt.locale)
+		got := ""
+		if ok {
+			got = date.Format("2006-01-02")
+		}
+		if got != tt.want {
+			t.Errorf("ParseDate(%q, %s) = %q; want %q", tt.text, tt.locale, got, tt.want)
+		}
+	}
+}
+
+func TestParseClockTime(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"14:32", "14:32:00"},
+		{"14 h 32", "14:32:00"},
+		{"2:32 PM", "14:32:00"},
+		{"12:05 a.m.", "00:05:00"},
+		{"09:15:42", "09:15:42"},
+		{"TOTAL", ""},
+	}
+
+	for _, tt := range tests {
+		if got, _ := ParseClockTime(tt.text); got != tt.want {
+			t.Errorf("ParseClockTime(%q) = %q; want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestDetectLocale(t *testing.T) {
+	tests := []struct {
+		lines []string
+		want  string
+	}{
+		{[]string{"SOUS-TOTAL 12,99", "TPS 0,65", "TVQ 1,30", "MERCI"}, LocaleFrCA},
+		{[]string{"SUBTOTAL 12.99", "GST 0.65", "THANK YOU"}, LocaleEnCA},
+		{nil, LocaleEnCA},
+	}
+
+	for _, tt := range tests {
+		if got := DetectLocale(tt.lines); got != tt.want {
+			t.Errorf("DetectLocale(%q) = %s; want %s", tt.lines, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeLocale(t *testing.T) {
+	tests := map[string]string{
+		"fr":    LocaleFrCA,
+		"fr_CA": LocaleFrCA,
+		"EN-ca": LocaleEnCA,
+		"de":    "",
+		"":      "",
+	}
+
+	for hint, want := range tests {
+		if got := NormalizeLocale(hint); got != want {
+			t.Errorf("NormalizeLocale(%q) = %q; want %q", hint, got, want)
+		}
+	}
+}
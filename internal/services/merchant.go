@@ -0,0 +1,232 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+)
+
+// MerchantDetails holds the structured merchant information extracted from a receipt
+type MerchantDetails struct {
+	Name        string `json:"name"`
+	Address     string `json:"address,omitempty"` // Address as printed
+	Street      string `json:"street,omitempty"`
+	City        string `json:"city,omitempty"`
+	Province    string `json:"province,omitempty"`
+	PostalCode  string `json:"postalCode,omitempty"`
+	Phone       string `json:"phone,omitempty"`
+	StoreNumber string `json:"storeNumber,omitempty"`
+}
+
+// storeHeaderLines is how many lines from the top of the receipt are searched for the store number
+const storeHeaderLines = 10
+
+var (
+	storeNumberPattern = regexp.MustCompile(`(?i)\b(?:STORE|STR|MAGASIN|SUCC(?:URSALE)?|BRANCH|LOC(?:ATION)?)\s*(?:NO\.?|NUM(?:BER)?|#)?\s*:?\s*(\d{2,6})\b`)
+	storeHashPattern   = regexp.MustCompile(`#\s*(\d{2,6})\b`)
+	houseNumberPattern = regexp.MustCompile(`^\d+[A-Z]?\s+\pL`)
+	zipCodePattern     = regexp.MustCompile(`\b\d{5}(?:-\d{4})?\b`)
+	streetSuffixes     = regexp.MustCompile(`(?i)^(ST|STREET|AVE|AVENUE|RD|ROAD|BLVD|BOUL|BOULEVARD|DR|DRIVE|WAY|CRES|CRESCENT|CRT|COURT|HWY|HIGHWAY|PKWY|PARKWAY|LANE|LN|PL|PLACE|SQ|SQUARE|TERR|TRAIL|LINE|CIRCLE|CIR|GATE|ROW)\.?,?$`)
+	streetDirections   = regexp.MustCompile(`(?i)^(N|S|E|W|NE|NW|SE|SW|NORTH|SOUTH|EAST|WEST|OUEST|EST|NORD|SUD)\.?,?$`)
+	nonDigitPattern    = regexp.MustCompile(`\D`)
+)
+
+// storeSkipPattern finds the words of lines about payments, taxes or transactions, whose numbers
+// are not the store's. A number may follow directly, as in "REG01", but a longer word such as
+// "REGINA" is not one of them.
+var storeSkipPattern = regexp.MustCompile(`(?i)\b(?:GST|HST|TRANS(?:ACTION)?|TXN|AUTH(?:ORI[SZ]ATION)?|CARD|REG(?:ISTER)?|ORDER|INVOICE)(?:\d|\b)`)
+
+// parseMerchantDetails extracts the merchant name, address, phone number and store number
+func parseMerchantDetails(fields map[string]interface{}, lines []string) MerchantDetails {
+	details := MerchantDetails{Name: "Unknown"}
+
+	// Try valueString first, then the raw text
+	if merchant, ok := fields["MerchantName"].(map[string]interface{}); ok {
+		if name := fieldString(merchant); name != "" {
+			details.Name = name
+		}
+	}
+
+	if address, ok := fields["MerchantAddress"].(map[string]interface{}); ok {
+		details.Address = fieldString(address)
+		details.Street, details.City, details.Province, details.PostalCode = ParseAddress(details.Address)
+
+		// Newer analyzer versions return the address already broken down
+		if value, ok := address["valueAddress"].(map[string]interface{}); ok {
+			applyStructuredAddress(&details, value)
+		}
+	}
+
+	if phone, ok := fields["MerchantPhoneNumber"].(map[string]interface{}); ok {
+		number, _ := phone["valuePhoneNumber"].(string)
+		if number == "" {
+			number = fieldString(phone)
+		}
+		details.Phone = NormalizePhoneNumber(number)
+	}
+
+	// The store number is usually printed next to the name or in the receipt header
+	header := lines
+	if len(header) > storeHeaderLines {
+		header = header[:storeHeaderLines]
+	}
+	details.StoreNumber = ExtractStoreNumber(append([]string{details.Name}, header...), 1+addressLineIndex(header))
+
+	return details
+}
+
+// addressLineIndex returns the index of the first line of the printed address, or 0 when none
+// is recognized, so that only the lines above it are taken as the store's name
+func addressLineIndex(lines []string) int {
+	for i, line := range lines {
+		upper := strings.ToUpper(strings.TrimSpace(line))
+		if houseNumberPattern.MatchString(upper) || postalCodePattern.MatchString(upper) {
+			return i
+		}
+	}
+	return 0
+}
+
+// applyStructuredAddress fills the address parts from a structured valueAddress field
+func applyStructuredAddress(details *MerchantDetails, value map[string]interface{}) {
+	if street, ok := value["streetAddress"].(string); ok && street != "" {
+		details.Street = street
+	} else if road, ok := value["road"].(string); ok && road != "" {
+		house, _ := value["houseNumber"].(string)
+		details.Street = strings.TrimSpace(house + " " + road)
+	}
+	if city, ok := value["city"].(string); ok && city != "" {
+		details.City = city
+	}
+	if state, ok := value["state"].(string); ok && state != "" {
+		if province := InferProvince(state); province != "" {
+			details.Province = province
+		}
+	}
+	if postalCode, ok := value["postalCode"].(string); ok && postalCode != "" {
+		details.PostalCode = strings.ToUpper(postalCode)
+	}
+}
+
+// ParseAddress splits a printed address into street, city, province and postal code
+func ParseAddress(address string) (street, city, province, postalCode string) {
+	address = strings.TrimSpace(address)
+	if address == "" {
+		return "", "", "", ""
+	}
+
+	province = InferProvince(address)
+	rest := strings.ToUpper(address)
+
+	// Pull out the postal or ZIP code
+	if match := postalCodePattern.FindString(rest); match != "" {
+		postalCode = strings.ReplaceAll(match, " ", "")
+		postalCode = postalCode[:3] + " " + postalCode[3:]
+		rest = strings.Replace(rest, match, " ", 1)
+	} else if match := zipCodePattern.FindString(rest); match != "" {
+		postalCode = match
+		rest = strings.Replace(rest, match, " ", 1)
+	}
+
+	// Drop the province code or name, keeping only what comes before it
+	if province != "" {
+		if loc := provinceCodePattern.FindStringIndex(rest); loc != nil && loc[0] > 0 {
+			rest = rest[:loc[0]] + rest[loc[1]:]
+		}
+		for name, code := range provinceNames {
+			if code == province {
+				rest = strings.Replace(rest, name, " ", 1)
+			}
+		}
+	}
+
+	// Split on line breaks and commas first
+	parts := []string{}
+	for _, part := range strings.FieldsFunc(rest, func(r rune) bool { return r == '\n' || r == ',' }) {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) >= 2 {
+		city := parts[len(parts)-1]
+		if len(parts) >= 3 && len(city) == 2 {
+			// Trailing state code of a US address
+			city = parts[len(parts)-2]
+		}
+		return titleCase(parts[0]), titleCase(city), province, postalCode
+	}
+	if len(parts) == 0 {
+		return "", "", province, postalCode
+	}
+
+	// Single line: the street ends at its suffix ("ST", "AVE", ...) and any direction after it
+	words := strings.Fields(parts[0])
+	end := -1
+	for i, word := range words {
+		if i > 0 && streetSuffixes.MatchString(word) {
+			end = i
+			if i+1 < len(words) && streetDirections.MatchString(words[i+1]) {
+				end = i + 1
+			}
+		}
+	}
+	if end == -1 || end == len(words)-1 {
+		return titleCase(parts[0]), "", province, postalCode
+	}
+	return titleCase(strings.Join(words[:end+1], " ")), titleCase(strings.Join(words[end+1:], " ")), province, postalCode
+}
+
+// ExtractStoreNumber finds a store or branch number such as "STORE 1234". A bare "#1234" is only
+// taken from the first nameLines lines, the store name above the address: further down it is
+// usually a transaction, register or extension number.
+func ExtractStoreNumber(lines []string, nameLines int) string {
+	for i, line := range lines {
+		// Skip lines that are clearly about payments, taxes or transactions
+		if storeSkipPattern.MatchString(line) {
+			continue
+		}
+		match := storeNumberPattern.FindStringSubmatch(line)
+		if match == nil && i < nameLines {
+			match = storeHashPattern.FindStringSubmatch(line)
+		}
+		if match != nil {
+			if number := strings.TrimLeft(match[1], "0"); number != "" {
+				return number
+			}
+		}
+	}
+	return ""
+}
+
+// NormalizePhoneNumber formats North American numbers as NNN-NNN-NNNN
+func NormalizePhoneNumber(number string) string {
+	digits := nonDigitPattern.ReplaceAllString(number, "")
+	if len(digits) == 11 && digits[0] == '1' {
+		digits = digits[1:]
+	}
+	if len(digits) != 10 {
+		return strings.TrimSpace(number)
+	}
+	return digits[:3] + "-" + digits[3:6] + "-" + digits[6:]
+}
+
+// titleCase turns "123 MAIN ST W" into "123 Main St W"
+func titleCase(text string) string {
+	words := strings.Fields(strings.ToLower(text))
+	for i, word := range words {
+		if len(word) <= 2 && streetDirections.MatchString(word) {
+			words[i] = strings.ToUpper(word)
+			continue
+		}
+		// Capitalize each part of hyphenated names such as "Ste-Catherine"
+		parts := strings.Split(word, "-")
+		for j, part := range parts {
+			if part != "" {
+				runes := []rune(part)
+				runes[0] = []rune(strings.ToUpper(string(runes[0])))[0]
+				parts[j] = string(runes)
+			}
+		}
+		words[i] = strings.Join(parts, "-")
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,70 @@
+package services
+
+import "testing"
+
+func TestExtractStoreNumber(t *testing.T) {
+	tests := []struct {
+		name      string
+		lines     []string
+		nameLines int
+		want      string
+	}{
+		{"store keyword", []string{"WALMART", "STORE 01234", "123 MAIN ST"}, 1, "1234"},
+		{"bare # in the name", []string{"HOME HARDWARE #1127", "88 QUEEN ST W"}, 1, "1127"},
+		{"bare # below the address", []string{"METRO", "123 MAIN ST", "CASHIER #42"}, 1, ""},
+		{"French branch", []string{"PHARMAPRIX", "SUCCURSALE NO: 0312"}, 1, "312"},
+		{"register line skipped", []string{"SHOPPERS", "REG 03 STORE 1234"}, 1, ""},
+		{"register number written together", []string{"SHOPPERS", "REG01 STORE 1234", "STORE 88"}, 1, "88"},
+		{"transaction line skipped", []string{"SHOPPERS", "TRANS#5678 STORE 4321"}, 1, ""},
+		{"city starting with REG", []string{"SOBEYS", "REGINA STORE 1234"}, 1, "1234"},
+		{"neighbourhood starting with TRANS", []string{"SAFEWAY TRANSCONA #55"}, 1, "55"},
+		{"card line skipped", []string{"COSTCO", "CARD # 4512 STORE 503"}, 1, ""},
+		{"nothing", []string{"TIM HORTONS", "THANK YOU"}, 1, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExtractStoreNumber(tt.lines, tt.nameLines); got != tt.want {
+				t.Errorf("ExtractStoreNumber(%q) = %q; want %q", tt.lines, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		address                            string
+		street, city, province, postalCode string
+	}{
+		{"88 Queen St W, Toronto ON M5H 2M9", "88 Queen St W", "Toronto", "ON", "M5H 2M9"},
+		{"1250 rue Saint-Denis, Montréal QC H2X 3J6", "1250 Rue Saint-Denis", "Montréal", "QC", "H2X 3J6"},
+		{"123 MAIN ST VANCOUVER BC V6B1A1", "123 Main St", "Vancouver", "BC", "V6B 1A1"},
+		{"500 Elm Ave, Springfield, IL 62701", "500 Elm Ave", "Springfield", "", "62701"},
+		{"1 Ontario St, Montreal QC", "1 Ontario St", "Montreal", "QC", ""},
+		{"", "", "", "", ""},
+	}
+
+	for _, tt := range tests {
+		street, city, province, postalCode := ParseAddress(tt.address)
+		if street != tt.street || city != tt.city || province != tt.province || postalCode != tt.postalCode {
+			t.Errorf("ParseAddress(%q) = %q, %q, %q, %q; want %q, %q, %q, %q", tt.address,
+				street, city, province, postalCode, tt.street, tt.city, tt.province, tt.postalCode)
+		}
+	}
+}
+
+func TestNormalizePhoneNumber(t *testing.T) {
+	tests := map[string]string{
+		"(416) 555-0192":  "416-555-0192",
+		"+1 514 555 0148": "514-555-0148",
+		"15145550148":     "514-555-0148",
+		"555-0148":        "555-0148",
+		" ext 12 ":        "ext 12",
+	}
+
+	for number, want := range tests {
+		if got := NormalizePhoneNumber(number); got != want {
+			t.Errorf("NormalizePhoneNumber(%q) = %q; want %q", number, got, want)
+		}
+	}
+}
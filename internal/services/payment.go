@@ -0,0 +1,151 @@
+package services
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Payment methods
+const (
+	PaymentMethodCredit   = "credit"
+	PaymentMethodDebit    = "debit"
+	PaymentMethodCash     = "cash"
+	PaymentMethodGiftCard = "gift_card"
+)
+
+// PaymentDetails describes how a purchase was paid. Only the last four digits of a card are kept.
+type PaymentDetails struct {
+	Method       string  `json:"method,omitempty"`
+	CardBrand    string  `json:"cardBrand,omitempty"`
+	CardLastFour string  `json:"cardLastFour,omitempty"`
+	CashTendered float64 `json:"cashTendered,omitempty"`
+	ChangeDue    float64 `json:"changeDue,omitempty"`
+}
+
+// cardBrands maps the card names printed on receipts to a brand, checked in order
+var cardBrands = []struct {
+	pattern *regexp.Regexp
+	brand   string
+}{
+	{regexp.MustCompile(`(?i)\bVISA\b`), "VISA"},
+	{regexp.MustCompile(`(?i)\b(MASTER\s?CARD|MC|M/C)\b`), "MASTERCARD"},
+	{regexp.MustCompile(`(?i)\b(AMEX|AMERICAN\s+EXPRESS)\b`), "AMEX"},
+	{regexp.MustCompile(`(?i)\bDISCOVER\b`), "DISCOVER"},
+	{regexp.MustCompile(`(?i)\bUNION\s?PAY\b`), "UNIONPAY"},
+	{regexp.MustCompile(`(?i)\bJCB\b`), "JCB"},
+	{regexp.MustCompile(`(?i)\bINTERAC\b`), "INTERAC"},
+}
+
+var (
+	maskedCardPattern = regexp.MustCompile(`[*Xx#•]{4,}[\s-]*(\d{4})\b`)
+	endingInPattern   = regexp.MustCompile(`(?i)\b(?:ENDING(?:\s+IN)?|LAST\s+4|TERMINANT\s+PAR)\s*:?\s*(\d{4})\b`)
+	fullCardPattern   = regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+	debitPattern      = regexp.MustCompile(`(?i)\b(DEBIT|DÉBIT|INTERAC)\b`)
+	giftCardPattern   = regexp.MustCompile(`(?i)\b(GIFT\s?CARD|CARTE[- ]CADEAU)\b`)
+	cashPattern       = regexp.MustCompile(`(?i)\b(CASH|COMPTANT|ESPECES|ESPÈCES)\b`)
+	changePattern     = regexp.MustCompile(`(?i)\b(CHANGE(\s+DUE)?|MONNAIE|RENDU)\b`)
+	paymentAmount     = regexp.MustCompile(`-?\d+[.,]\d{2}\b`)
+	cardContextWords  = regexp.MustCompile(`(?i)\b(CARD|CARTE|ACCT|ACCOUNT|COMPTE|NUMBER|NO)\b`)
+)
+
+// ExtractPaymentDetails reads the tender section of the receipt text: card brand, masked
+// card number, cash tendered and change. A full card number is never kept, only its last four digits.
+func ExtractPaymentDetails(lines []string) PaymentDetails {
+	details := PaymentDetails{}
+	debit, giftCard := false, false
+
+	for _, line := range lines {
+		if details.CardBrand == "" {
+			for _, brand := range cardBrands {
+				if brand.pattern.MatchString(line) {
+					details.CardBrand = brand.brand
+					break
+				}
+			}
+		}
+		if debitPattern.MatchString(line) {
+			debit = true
+		}
+		if giftCardPattern.MatchString(line) {
+			giftCard = true
+		}
+
+		if details.CardLastFour == "" {
+			details.CardLastFour = extractLastFour(line)
+		}
+
+		// Change lines are checked first since "CASH CHANGE" lines mention both
+		if changePattern.MatchString(line) {
+			if amount, ok := lastPaymentAmount(line); ok {
+				details.ChangeDue = amount
+			}
+		} else if cashPattern.MatchString(line) && details.CashTendered == 0 {
+			if amount, ok := lastPaymentAmount(line); ok {
+				details.CashTendered = amount
+			}
+		}
+	}
+
+	switch {
+	case details.CardBrand == "INTERAC" || (debit && details.CardBrand == ""):
+		details.Method = PaymentMethodDebit
+	case details.CardBrand != "" || details.CardLastFour != "":
+		details.Method = PaymentMethodCredit
+		if debit {
+			// Visa Debit and Debit Mastercard
+			details.Method = PaymentMethodDebit
+		}
+	case giftCard:
+		details.Method = PaymentMethodGiftCard
+	case details.CashTendered > 0:
+		details.Method = PaymentMethodCash
+	}
+
+	return details
+}
+
+// extractLastFour returns the last four digits of a masked or full card number on the line
+func extractLastFour(line string) string {
+	if match := maskedCardPattern.FindStringSubmatch(line); match != nil {
+		return match[1]
+	}
+	if match := endingInPattern.FindStringSubmatch(line); match != nil {
+		return match[1]
+	}
+
+	// An unmasked number is only trusted next to a card label, and only its last four digits are kept
+	if cardContextWords.MatchString(line) {
+		if match := fullCardPattern.FindString(line); match != "" {
+			digits := nonDigitPattern.ReplaceAllString(match, "")
+			if len(digits) >= 13 {
+				return digits[len(digits)-4:]
+			}
+		}
+	}
+	return ""
+}
+
+// lastPaymentAmount returns the last amount printed on the line
+func lastPaymentAmount(line string) (float64, bool) {
+	amounts := paymentAmount.FindAllString(line, -1)
+	if len(amounts) == 0 {
+		return 0, false
+	}
+	amount, err := strconv.ParseFloat(strings.Replace(amounts[len(amounts)-1], ",", ".", 1), 64)
+	if err != nil {
+		return 0, false
+	}
+	return amount, true
+}
+
+// MaskCardNumbers replaces any full card number in the text with a masked one keeping the last four digits
+func MaskCardNumbers(text string) string {
+	return fullCardPattern.ReplaceAllStringFunc(text, func(match string) string {
+		digits := nonDigitPattern.ReplaceAllString(match, "")
+		if len(digits) < 13 {
+			return match
+		}
+		return strings.Repeat("*", len(digits)-4) + digits[len(digits)-4:]
+	})
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"math"
+	"regexp"
+	"strings"
+)
+
+var (
+	refundKeywords       = regexp.MustCompile(`(?i)\b(REFUND(ED)?|RETURN(ED|S)?|RETOURS?|REMBOURSEMENT|CREDIT\s+NOTE|NOTE\s+DE\s+CR[ÉE]DIT|MERCHANDISE\s+CREDIT)\b`)
+	refundPolicyWords    = regexp.MustCompile(`(?i)\b(POLICY|POLITIQUE|WITHIN|DAYS|JOURS|EXCHANGE|ÉCHANGE|ECHANGE|VISIT|CONDITIONS?|ACCEPTED|FINAL|NO\s+(REFUNDS?|RETURNS?))\b`) // Return policies on purchase receipts
+	receiptNumberPattern = regexp.MustCompile(`(?i)\b(?:RECEIPT|RCPT|TRANS(?:ACTION)?|TRX|INVOICE|FACTURE|RE[ÇC]U|TICKET|TRN)\b\s*(?:NO\.?|NUM(?:BER|[ÉE]RO)?|#)?\s*:?\s*#?\s*([A-Z0-9][A-Z0-9-]{3,})\b`)
+	originalReceiptWords = regexp.MustCompile(`(?i)\b(ORIG(INAL|INE)?|ORIG\.)\b`)
+	tenderReversalWords  = regexp.MustCompile(`(?i)\b(?:(?:REFUND(?:ED)?\s+(?:TO|TENDER|AMOUNT|TOTAL|DUE)|(?:AMOUNT|TOTAL)\s+REFUNDED|CREDITED\s+TO|(?:CASH|CARD|VISA|MASTERCARD|AMEX|DEBIT|INTERAC)\s+REFUND|RETURN\s+TOTAL|TOTAL\s+(?:DU\s+)?REMBOURSEMENT)\b|MONTANT\s+REMBOURS[ÉE]|REMBOURS[ÉE]E?\s+(?:SUR|À|A|PAR)\s)`) // The tender being paid back
+	receiptNumberDigits  = regexp.MustCompile(`\d`)
+)
+
+// DetectRefund reports whether the receipt is a return or refund slip. A negative total is enough;
+// with a positive one, purchase receipts also mention returns ("KEEP RECEIPT FOR RETURNS", "REFUND
+// DESK HOURS"), so refund wording that isn't part of a return policy must come with the tender
+// being paid back or a reference to the original receipt.
+func DetectRefund(total float64, lines []string) bool {
+	if total < 0 {
+		return true
+	}
+
+	header, reversal := false, false
+	for _, line := range lines {
+		if refundKeywords.MatchString(line) && !refundPolicyWords.MatchString(line) {
+			header = true
+		}
+		if tenderReversalWords.MatchString(line) {
+			reversal = true
+		}
+	}
+	if !header {
+		return false
+	}
+	if reversal {
+		return true
+	}
+	_, original := ExtractReceiptNumbers(lines)
+	return original != ""
+}
+
+// ExtractReceiptNumbers returns the receipt's own number and, on refund slips, the number
+// of the original purchase receipt printed next to "ORIG" or "ORIGINAL"
+func ExtractReceiptNumbers(lines []string) (string, string) {
+	number, original := "", ""
+	for _, line := range lines {
+		match := receiptNumberPattern.FindStringSubmatch(line)
+		if match == nil || !receiptNumberDigits.MatchString(match[1]) {
+			continue
+		}
+
+		if originalReceiptWords.MatchString(line) {
+			if original == "" {
+				original = strings.ToUpper(match[1])
+			}
+		} else if number == "" {
+			number = strings.ToUpper(match[1])
+		}
+	}
+	return number, original
+}
+
+// normalizeRefundAmounts stores a refund's amounts as positive values, since return slips
+// print them with either sign; the receipt type carries the direction instead
+func normalizeRefundAmounts(result *ReceiptParseResult) {
+	result.TotalAmount = math.Abs(result.TotalAmount)
+	result.Subtotal = math.Abs(result.Subtotal)
+	result.Tax = math.Abs(result.Tax)
+	for i := range result.LineItems {
+		item := &result.LineItems[i]
+		item.UnitPrice = math.Abs(item.UnitPrice)
+		item.TotalPrice = math.Abs(item.TotalPrice)
+		item.Quantity = math.Abs(item.Quantity)
+	}
+	for i := range result.Taxes {
+		result.Taxes[i].Amount = math.Abs(result.Taxes[i].Amount)
+	}
+}
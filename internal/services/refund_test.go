@@ -0,0 +1,51 @@
+package services
+
+import "testing"
+
+func TestDetectRefund(t *testing.T) {
+	tests := []struct {
+		name  string
+		total float64
+		lines []string
+		want  bool
+	}{
+		{"negative total", -12.99, []string{"WALMART", "TOTAL -12.99"}, true},
+		{"plain purchase", 12.99, []string{"WALMART", "TOTAL 12.99", "VISA 12.99"}, false},
+		{"refund to card", 12.99, []string{"WALMART", "*** REFUND ***", "TOTAL 12.99", "REFUND TO VISA 12.99"}, true},
+		{"return with original receipt", 25.00, []string{"CANADIAN TIRE", "RETURN", "ORIGINAL RECEIPT # 4471-0932", "TOTAL 25.00"}, true},
+		{"french refund", 8.50, []string{"PHARMAPRIX", "REMBOURSEMENT", "MONTANT REMBOURSÉ 8,50"}, true},
+		{"keep receipt for returns", 45.10, []string{"BEST BUY", "TOTAL 45.10", "KEEP RECEIPT FOR RETURNS"}, false},
+		{"refund desk hours", 19.99, []string{"IKEA", "TOTAL 19.99", "REFUND DESK HOURS 10-6"}, false},
+		{"return policy", 30.00, []string{"THE BAY", "RETURNS ACCEPTED WITHIN 30 DAYS", "TOTAL 30.00"}, false},
+		{"refund wording and a receipt number", 5.25, []string{"STAPLES", "NO REFUND WITHOUT RECEIPT", "RECEIPT # 88120", "TOTAL 5.25"}, false},
+		{"refund header alone", 14.00, []string{"SPORT CHEK", "RETURNS", "VISA 14.00"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectRefund(tt.total, tt.lines); got != tt.want {
+				t.Errorf("DetectRefund(%v, %q) = %v; want %v", tt.total, tt.lines, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractReceiptNumbers(t *testing.T) {
+	tests := []struct {
+		lines    []string
+		number   string
+		original string
+	}{
+		{[]string{"RECEIPT # 10442", "TOTAL 12.99"}, "10442", ""},
+		{[]string{"TRANS 2231-77", "ORIG RECEIPT: 1987-34"}, "2231-77", "1987-34"},
+		{[]string{"REÇU NO 55012"}, "55012", ""},
+		{[]string{"INVOICE ABCD"}, "", ""},
+	}
+
+	for _, tt := range tests {
+		number, original := ExtractReceiptNumbers(tt.lines)
+		if number != tt.number || original != tt.original {
+			t.Errorf("ExtractReceiptNumbers(%q) = %q, %q; want %q, %q", tt.lines, number, original, tt.number, tt.original)
+		}
+	}
+}
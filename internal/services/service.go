@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"io"
 	"math/rand"
-	"strconv"
 
 	"net/http"
 	"strings"
@@ -30,8 +29,20 @@ type ReceiptParseResult struct {
   TransactionDate  string          `json:"transactionDate"`
   TransactionTime  string          `json:"transactionTime"`
   Items            json.RawMessage `json:"items"`  // Storing as raw JSON
+  LineItems        []ReceiptLineItem `json:"lineItems"`
   Tax              float64         `json:"tax,omitempty"`
+  Subtotal         float64         `json:"subtotal,omitempty"`
+  Tip              float64         `json:"tip,omitempty"`
+  Taxes            []TaxComponent  `json:"taxes,omitempty"`
+  MerchantDetails  MerchantDetails `json:"merchantDetails"`
+  Currency         string          `json:"currency,omitempty"` // Empty when nothing on the receipt points to a currency
+  Locale           string          `json:"locale"`             // en-CA or fr-CA, used to read amounts and dates
+  Payment          PaymentDetails  `json:"payment"`
+  TextLines        []string        `json:"-"` // Raw OCR lines, used for details the analyzer doesn't extract
   Discounts        float64         `json:"discounts,omitempty"`
+  IsRefund         bool            `json:"isRefund"`
+  ReceiptNumber    string          `json:"receiptNumber,omitempty"`
+  OriginalReceiptNumber string     `json:"originalReceiptNumber,omitempty"` // Printed on refund slips
 }
 
 // struct for the custom vision client
@@ -119,7 +130,8 @@ func AnalyzeReceipt(imageBytes []byte) (map[string]interface{}, error) {
 	}
 
 	// Construct the Analyze Receipt endpoint URL
-	url := fmt.Sprintf("%s/formrecognizer/v2.1/prebuilt/receipt/analyze", endpoint)
+	// Text details are needed to read the tax lines printed on the receipt
+	url := fmt.Sprintf("%s/formrecognizer/v2.1/prebuilt/receipt/analyze?includeTextDetails=true", endpoint)
 
 	// Create the POST request
 	req, err := http.NewRequest("POST", url, bytes.NewReader(imageBytes))
@@ -285,8 +297,9 @@ func getPoll(operationLocation, key string) (map[string]interface{}, error) {
 // }
 
 
-// ParseReceiptInformation parses the receipt information and returns a ReceiptParseResult
-func ParseReceiptInformation(response map[string]interface{}) (*ReceiptParseResult, error) {
+// ParseReceiptInformation parses the receipt information and returns a ReceiptParseResult.
+// Amounts and dates are read in the given locale, detected from the receipt text when empty.
+func ParseReceiptInformation(response map[string]interface{}, locale string) (*ReceiptParseResult, error) {
 	// Initialize the result struct
 	receiptResult := &ReceiptParseResult{}
 
@@ -307,47 +320,21 @@ func ParseReceiptInformation(response map[string]interface{}) (*ReceiptParseResu
 		return nil, fmt.Errorf("failed to find fields in documentResults")
 	}
 
-	// Extract and assign the merchant name (if available)
-  if merchant, ok := fields["MerchantName"].(map[string]interface{}); ok {
-  var merchantText string
-  
-  // Try valueString first
-  if val, ok := merchant["valueString"].(string); ok {
-      merchantText = val
-  }
-  
-  // If valueString is empty, try text field
-  if merchantText == "" {
-      if val, ok := merchant["text"].(string); ok {
-          merchantText = val
-      }
-  }
-  
-  // Trim any trailing or leading whitespace
-  merchantText = strings.TrimSpace(merchantText)
-  
-  // Set merchant, default to "Unknown" if no text found
-  if merchantText == "" {
-      receiptResult.Merchant = "Unknown"
-  } else {
-      receiptResult.Merchant = merchantText
-  }
-  } else {
-    // If MerchantName field is not found at all, set to "Unknown"
-    receiptResult.Merchant = "Unknown"
+	// Extract the merchant name, address, phone number and store number
+  receiptResult.TextLines = extractTextLines(analyzeResult)
+  receiptResult.MerchantDetails = parseMerchantDetails(fields, receiptResult.TextLines)
+  receiptResult.Merchant = receiptResult.MerchantDetails.Name
+
+  // Use the locale hint, or detect it from the receipt text
+  receiptResult.Locale = NormalizeLocale(locale)
+  if receiptResult.Locale == "" {
+    receiptResult.Locale = DetectLocale(receiptResult.TextLines)
   }
-  // Extract and assign the merchant name (if available)
-	if merchant, ok := fields["MerchantName"].(map[string]interface{}); ok {
-		if merchantText, ok := merchant["valueString"].(string); ok && merchantText != "" {
-			receiptResult.Merchant = merchantText
-		} else {
-			receiptResult.Merchant = "Unknown" // Default value
-		}
-	}
 
 	// Extract and assign total amount (if available)
 	if total, ok := fields["Total"].(map[string]interface{}); ok {
-		if totalAmount, ok := total["valueNumber"].(float64); ok && totalAmount > 0 {
+		// Return slips may print a negative total
+		if totalAmount, ok := fieldNumber(total, receiptResult.Locale); ok && totalAmount != 0 {
 			receiptResult.TotalAmount = totalAmount
 		} else {
 			receiptResult.TotalAmount = 0.0 // Default value
@@ -372,13 +359,20 @@ func ParseReceiptInformation(response map[string]interface{}) (*ReceiptParseResu
     // Try valueDate first, then fallback to valueString
     if date, ok := transactionDate["valueDate"].(string); ok && date != "" {
         receiptResult.TransactionDate = date
-    } else if date, ok := transactionDate["valueString"].(string); ok && date != "" {
-        receiptResult.TransactionDate = date
+    } else if date, ok := ParseDate(fieldString(transactionDate), receiptResult.Locale); ok {
+        receiptResult.TransactionDate = date.Format("2006-01-02")
     }
   } else {
     fmt.Println("TransactionDate field not found or empty")
   }
 
+  // Fall back to the first date printed on the receipt
+  if receiptResult.TransactionDate == "" {
+    if date, ok := findDateInLines(receiptResult.TextLines, receiptResult.Locale); ok {
+      receiptResult.TransactionDate = date.Format("2006-01-02")
+    }
+  }
+
 
   // Extract and assign transaction time (if available)
   if transactionTime, ok := fields["TransactionTime"].(map[string]interface{}); ok {
@@ -386,7 +380,7 @@ func ParseReceiptInformation(response map[string]interface{}) (*ReceiptParseResu
     // Try valueTime first, then fallback to valueString
     if time, ok := transactionTime["valueTime"].(string); ok && time != "" {
         receiptResult.TransactionTime = time
-    } else if time, ok := transactionTime["valueString"].(string); ok && time != "" {
+    } else if time, ok := ParseClockTime(fieldString(transactionTime)); ok {
         receiptResult.TransactionTime = time
     }
   } else {
@@ -395,39 +389,63 @@ func ParseReceiptInformation(response map[string]interface{}) (*ReceiptParseResu
 
   // Extract and assign tax (if available)
   if tax, ok := fields["Tax"].(map[string]interface{}); ok {
-    // Try valueNumber first, then valueString converted to float
-    if taxAmount, ok := tax["valueNumber"].(float64); ok {
+    // Try valueNumber first, then the printed value read in the receipt locale
+    if taxAmount, ok := fieldNumber(tax, receiptResult.Locale); ok {
         receiptResult.Tax = taxAmount
-    } else if taxValueStr, ok := tax["valueString"].(string); ok {
-        if taxAmount, err := strconv.ParseFloat(taxValueStr, 64); err == nil {
-            receiptResult.Tax = taxAmount
-        }
     }
   }
 
+  // Detect the currency the receipt was paid in
+  receiptResult.Currency = DetectCurrency(fields, receiptResult.TextLines, receiptResult.MerchantDetails, receiptResult.Locale)
+
+  // Extract how the purchase was paid
+  receiptResult.Payment = ExtractPaymentDetails(receiptResult.TextLines)
+
+  // Break the tax down into its GST/HST/PST/QST components
+  receiptResult.Taxes = ExtractTaxBreakdown(receiptResult.TextLines, receiptResult.Tax, receiptResult.MerchantDetails.Province, receiptResult.Locale)
+  if receiptResult.Tax == 0 {
+    for _, component := range receiptResult.Taxes {
+      receiptResult.Tax += component.Amount
+    }
+    receiptResult.Tax = roundCents(receiptResult.Tax)
+  }
+
+  // Extract and assign subtotal and tip (if available)
+  if subtotal, ok := fields["Subtotal"].(map[string]interface{}); ok {
+    receiptResult.Subtotal, _ = fieldNumber(subtotal, receiptResult.Locale)
+  }
+  if tip, ok := fields["Tip"].(map[string]interface{}); ok {
+    receiptResult.Tip, _ = fieldNumber(tip, receiptResult.Locale)
+  }
+
   // Extract and assign discounts (if available)
   // Note: Many receipts don't have a direct "Discounts" field, so we might need to adjust this
   if discounts, ok := fields["Discounts"].(map[string]interface{}); ok {
-    // Try valueNumber first, then valueString converted to float
-    if discountAmount, ok := discounts["valueNumber"].(float64); ok {
+    // Try valueNumber first, then the printed value read in the receipt locale
+    if discountAmount, ok := fieldNumber(discounts, receiptResult.Locale); ok {
         receiptResult.Discounts = discountAmount
-    } else if discountValueStr, ok := discounts["valueString"].(string); ok {
-        if discountAmount, err := strconv.ParseFloat(discountValueStr, 64); err == nil {
-            receiptResult.Discounts = discountAmount
-        }
     }
   }
 
-	// Prepare items and store them as raw JSON
-	// Modify items extraction
+	// Extract the line items, keeping the raw JSON as a compatibility view
   if items, ok := fields["Items"].(map[string]interface{}); ok {
-    cleanedItems, err := cleanItems(items)
+    lineItems, err := parseLineItems(items, receiptResult.Locale)
     if err != nil {
-        return nil, fmt.Errorf("failed to clean items: %v", err)
+        return nil, fmt.Errorf("failed to parse items: %v", err)
     }
-    
+    receiptResult.LineItems = lineItems
+  }
+
+  // Detect return slips; their amounts are kept positive and the refund flag carries the sign
+  receiptResult.ReceiptNumber, receiptResult.OriginalReceiptNumber = ExtractReceiptNumbers(receiptResult.TextLines)
+  receiptResult.IsRefund = DetectRefund(receiptResult.TotalAmount, receiptResult.TextLines)
+  if receiptResult.IsRefund {
+    normalizeRefundAmounts(receiptResult)
+  }
+
+  if receiptResult.LineItems != nil {
     // Convert cleaned items to JSON
-    itemsJSON, err := json.Marshal(cleanedItems)
+    itemsJSON, err := json.Marshal(cleanItems(receiptResult.LineItems))
     if err != nil {
         return nil, fmt.Errorf("failed to serialize cleaned items to JSON: %v", err)
     }
@@ -437,55 +455,3 @@ func ParseReceiptInformation(response map[string]interface{}) (*ReceiptParseResu
 
 	return receiptResult, nil
 }
-
-
-func cleanItems(items map[string]interface{}) ([]map[string]interface{}, error) {
-  cleanedItems := []map[string]interface{}{}
-
-  // Check if items have the expected structure
-  valueArray, ok := items["valueArray"].([]interface{})
-  if !ok {
-      return nil, fmt.Errorf("invalid items structure")
-  }
-
-  for _, item := range valueArray {
-      itemMap, ok := item.(map[string]interface{})
-      if !ok {
-          continue
-      }
-
-      valueObject, ok := itemMap["valueObject"].(map[string]interface{})
-      if !ok {
-          continue
-      }
-
-      cleanedItem := map[string]interface{}{}
-
-      // Extract Name (using text or valueString)
-      if name, ok := valueObject["Name"].(map[string]interface{}); ok {
-          if nameText, ok := name["valueString"].(string); ok {
-              cleanedItem["name"] = nameText
-          } else if nameText, ok := name["text"].(string); ok {
-              cleanedItem["name"] = nameText
-          }
-      }
-
-      // Extract TotalPrice
-      if price, ok := valueObject["TotalPrice"].(map[string]interface{}); ok {
-          if priceValue, ok := price["valueNumber"].(float64); ok {
-              cleanedItem["totalPrice"] = priceValue
-          } else if priceText, ok := price["text"].(string); ok {
-              if parsedPrice, err := strconv.ParseFloat(priceText, 64); err == nil {
-                  cleanedItem["totalPrice"] = parsedPrice
-              }
-          }
-      }
-
-      // Only add the item if it has both name and price
-      if cleanedItem["name"] != nil && cleanedItem["totalPrice"] != nil {
-          cleanedItems = append(cleanedItems, cleanedItem)
-      }
-  }
-
-  return cleanedItems, nil
-}
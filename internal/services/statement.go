@@ -0,0 +1,303 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Statement file formats
+const (
+	StatementFormatCSV = "csv"
+	StatementFormatOFX = "ofx" // OFX 1.x (SGML) and 2.x (XML); QFX files are OFX
+)
+
+// StatementTransaction is one card or bank transaction read from a statement. Amount is
+// positive for purchases and negative for refunds and payments.
+type StatementTransaction struct {
+	PostedDate   time.Time `json:"posted_date"`
+	Amount       float64   `json:"amount"`
+	Description  string    `json:"description"`
+	Reference    string    `json:"reference"` // Bank transaction ID (FITID) when the statement has one
+	CardLastFour string    `json:"card_last_four"`
+}
+
+// CSVColumnMapping tells which CSV columns hold which transaction fields. Columns are given by
+// header name, or by 1-based position when the file has no header.
+type CSVColumnMapping struct {
+	Date        string `json:"date"`
+	Amount      string `json:"amount"` // A single signed amount column...
+	Debit       string `json:"debit"`  // ...or separate debit and credit columns
+	Credit      string `json:"credit"`
+	Description string `json:"description"`
+	Reference   string `json:"reference"`
+	CardNumber  string `json:"card_number"`
+	DateFormat  string `json:"date_format"` // YYYY-MM-DD, MM/DD/YYYY, DD/MM/YYYY or YYYYMMDD; guessed when empty
+	NoHeader    bool   `json:"no_header"`
+	// Bank accounts usually show purchases as negative amounts, credit cards as positive ones
+	PurchasesNegative bool   `json:"purchases_negative"`
+	Delimiter         string `json:"delimiter"` // Defaults to a comma
+	Locale            string `json:"locale"`    // Decides the decimal separator, en-CA by default
+}
+
+var csvDateLayouts = map[string]string{
+	"YYYY-MM-DD": "2006-01-02",
+	"MM/DD/YYYY": "01/02/2006",
+	"DD/MM/YYYY": "02/01/2006",
+	"YYYYMMDD":   "20060102",
+}
+
+var (
+	ofxTransactionStart = regexp.MustCompile(`(?i)<STMTTRN>`)
+	ofxTransactionEnd   = regexp.MustCompile(`(?i)</STMTTRN>|</BANKTRANLIST>`)
+	ofxFieldPattern     = regexp.MustCompile(`(?i)<([A-Z0-9.]+)>([^<\r\n]*)`)
+	ofxAccountPattern   = regexp.MustCompile(`(?i)<ACCTID>([^<\r\n]*)`)
+)
+
+// DetectStatementFormat picks the format from the file name, falling back to the content
+func DetectStatementFormat(fileName string, content []byte) string {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".ofx", ".qfx":
+		return StatementFormatOFX
+	case ".csv":
+		return StatementFormatCSV
+	}
+	if bytes.Contains(bytes.ToUpper(content[:min(len(content), 4096)]), []byte("<OFX>")) {
+		return StatementFormatOFX
+	}
+	return StatementFormatCSV
+}
+
+// ParseStatement reads the transactions of a statement file in the given format
+func ParseStatement(content []byte, format string, mapping CSVColumnMapping) ([]StatementTransaction, error) {
+	switch format {
+	case StatementFormatCSV:
+		return ParseCSVStatement(content, mapping)
+	case StatementFormatOFX, "qfx":
+		return ParseOFXStatement(content)
+	}
+	return nil, fmt.Errorf("unsupported statement format %q", format)
+}
+
+// ParseCSVStatement reads transactions from a CSV export using the column mapping
+func ParseCSVStatement(content []byte, mapping CSVColumnMapping) ([]StatementTransaction, error) {
+	if mapping.Date == "" || mapping.Description == "" || (mapping.Amount == "" && mapping.Debit == "" && mapping.Credit == "") {
+		return nil, errors.New("the column mapping needs date, description and either amount or debit/credit columns")
+	}
+	layout := ""
+	if mapping.DateFormat != "" {
+		var ok bool
+		if layout, ok = csvDateLayouts[strings.ToUpper(mapping.DateFormat)]; !ok {
+			return nil, fmt.Errorf("unsupported date_format %q", mapping.DateFormat)
+		}
+	}
+	locale := NormalizeLocale(mapping.Locale)
+	if locale == "" {
+		locale = LocaleEnCA
+	}
+
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	if mapping.Delimiter != "" {
+		reader.Comma = []rune(mapping.Delimiter)[0]
+	}
+
+	columns := map[string]int{}
+	if !mapping.NoHeader {
+		header, err := reader.Read()
+		if err != nil {
+			return nil, fmt.Errorf("error reading the CSV header: %w", err)
+		}
+		for i, name := range header {
+			columns[strings.ToLower(strings.TrimSpace(name))] = i
+		}
+	}
+	column := func(name string) (int, error) {
+		if name == "" {
+			return -1, nil
+		}
+		if mapping.NoHeader {
+			position, err := strconv.Atoi(name)
+			if err != nil || position < 1 {
+				return -1, fmt.Errorf("column %q must be a 1-based position when the file has no header", name)
+			}
+			return position - 1, nil
+		}
+		index, ok := columns[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return -1, fmt.Errorf("column %q is not in the CSV header", name)
+		}
+		return index, nil
+	}
+
+	indexes := map[string]int{}
+	for field, name := range map[string]string{
+		"date": mapping.Date, "amount": mapping.Amount, "debit": mapping.Debit, "credit": mapping.Credit,
+		"description": mapping.Description, "reference": mapping.Reference, "card_number": mapping.CardNumber,
+	} {
+		index, err := column(name)
+		if err != nil {
+			return nil, err
+		}
+		indexes[field] = index
+	}
+
+	transactions := []StatementTransaction{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading CSV row %d: %w", line, err)
+		}
+		value := func(field string) string {
+			if index := indexes[field]; index >= 0 && index < len(record) {
+				return strings.TrimSpace(record[index])
+			}
+			return ""
+		}
+		if strings.Join(record, "") == "" {
+			continue
+		}
+
+		var date time.Time
+		var ok bool
+		if layout != "" {
+			date, err = time.Parse(layout, value("date"))
+			ok = err == nil
+		} else {
+			date, ok = parseStatementDate(value("date"), locale)
+		}
+		if !ok {
+			return nil, fmt.Errorf("row %d: can't read the date %q", line, value("date"))
+		}
+
+		amount := 0.0
+		if indexes["amount"] >= 0 {
+			if amount, ok = ParseAmount(value("amount"), locale); !ok {
+				return nil, fmt.Errorf("row %d: can't read the amount %q", line, value("amount"))
+			}
+			if mapping.PurchasesNegative {
+				amount = -amount
+			}
+		} else {
+			debit, _ := ParseAmount(value("debit"), locale)
+			credit, _ := ParseAmount(value("credit"), locale)
+			amount = abs(debit) - abs(credit)
+		}
+
+		transactions = append(transactions, StatementTransaction{
+			PostedDate:   date,
+			Amount:       amount,
+			Description:  value("description"),
+			Reference:    value("reference"),
+			CardLastFour: lastFourDigits(value("card_number")),
+		})
+	}
+	return transactions, nil
+}
+
+// ParseOFXStatement reads the transactions of an OFX or QFX file, in either the SGML or XML flavour
+func ParseOFXStatement(content []byte) ([]StatementTransaction, error) {
+	text := string(content)
+	if !strings.Contains(strings.ToUpper(text), "<OFX>") {
+		return nil, errors.New("the file is not an OFX statement")
+	}
+
+	cardLastFour := ""
+	if account := ofxAccountPattern.FindStringSubmatch(text); account != nil {
+		cardLastFour = lastFourDigits(account[1])
+	}
+
+	transactions := []StatementTransaction{}
+	for _, block := range ofxTransactionBlocks(text) {
+		fields := map[string]string{}
+		for _, field := range ofxFieldPattern.FindAllStringSubmatch(block, -1) {
+			fields[strings.ToUpper(field[1])] = strings.TrimSpace(field[2])
+		}
+
+		date, ok := parseOFXDate(fields["DTPOSTED"])
+		if !ok {
+			return nil, fmt.Errorf("transaction %s: can't read the date %q", fields["FITID"], fields["DTPOSTED"])
+		}
+		amount, err := strconv.ParseFloat(strings.ReplaceAll(fields["TRNAMT"], ",", "."), 64)
+		if err != nil {
+			return nil, fmt.Errorf("transaction %s: can't read the amount %q", fields["FITID"], fields["TRNAMT"])
+		}
+		description := fields["NAME"]
+		if memo := fields["MEMO"]; memo != "" && !strings.Contains(description, memo) {
+			description = strings.TrimSpace(description + " " + memo)
+		}
+
+		transactions = append(transactions, StatementTransaction{
+			PostedDate:   date,
+			Amount:       -amount, // OFX amounts are from the account's point of view: purchases are debits
+			Description:  description,
+			Reference:    fields["FITID"],
+			CardLastFour: cardLastFour,
+		})
+	}
+	return transactions, nil
+}
+
+// ofxTransactionBlocks cuts out the content of each <STMTTRN> element. SGML files may leave the
+// elements unclosed, so a block also ends where the next one starts.
+func ofxTransactionBlocks(text string) []string {
+	starts := ofxTransactionStart.FindAllStringIndex(text, -1)
+	blocks := make([]string, 0, len(starts))
+	for i, start := range starts {
+		block := text[start[1]:]
+		if i+1 < len(starts) {
+			block = text[start[1]:starts[i+1][0]]
+		}
+		if end := ofxTransactionEnd.FindStringIndex(block); end != nil {
+			block = block[:end[0]]
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+// parseOFXDate reads an OFX date such as 20240315, 20240315120000 or 20240315120000.000[-5:EST]
+func parseOFXDate(value string) (time.Time, bool) {
+	if len(value) < 8 {
+		return time.Time{}, false
+	}
+	date, err := time.Parse("20060102", value[:8])
+	return date, err == nil
+}
+
+// parseStatementDate guesses the date format of a statement row
+func parseStatementDate(value, locale string) (time.Time, bool) {
+	for _, layout := range []string{"2006-01-02", "20060102", "2006/01/02"} {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date, true
+		}
+	}
+	return ParseDate(value, locale)
+}
+
+// lastFourDigits keeps the last four digits of a card or account number
+func lastFourDigits(number string) string {
+	digits := nonDigitPattern.ReplaceAllString(number, "")
+	if len(digits) < 4 {
+		return ""
+	}
+	return digits[len(digits)-4:]
+}
+
+func abs(value float64) float64 {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
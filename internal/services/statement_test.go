@@ -0,0 +1,243 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// statementRow is the part of a parsed transaction checked by the statement tests
+type statementRow struct {
+	Date        string
+	Amount      float64
+	Description string
+	Reference   string
+	CardLast4   string
+}
+
+func statementRows(transactions []StatementTransaction) []statementRow {
+	rows := make([]statementRow, len(transactions))
+	for i, transaction := range transactions {
+		rows[i] = statementRow{
+			Date:        transaction.PostedDate.Format("2006-01-02"),
+			Amount:      transaction.Amount,
+			Description: transaction.Description,
+			Reference:   transaction.Reference,
+			CardLast4:   transaction.CardLastFour,
+		}
+	}
+	return rows
+}
+
+func TestParseCSVStatement(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		mapping CSVColumnMapping
+		want    []statementRow
+		wantErr bool
+	}{
+		{
+			name:    "header with a signed amount",
+			content: "\xef\xbb\xbfDate,Description,Amount,Card\n2024-03-15,COSTCO WHOLESALE,123.45,4500 1234 5678 9012\n\n2024-03-16,COSTCO REFUND,-20.00,4500 1234 5678 9012\n",
+			mapping: CSVColumnMapping{Date: "date", Description: "description", Amount: "amount", CardNumber: "card"},
+			want: []statementRow{
+				{"2024-03-15", 123.45, "COSTCO WHOLESALE", "", "9012"},
+				{"2024-03-16", -20, "COSTCO REFUND", "", "9012"},
+			},
+		},
+		{
+			name:    "bank account with purchases negative",
+			content: "Posted,Payee,Amount,Id\n03/15/2024,METRO,-45.10,T1\n",
+			mapping: CSVColumnMapping{Date: "Posted", Description: "Payee", Amount: "Amount", Reference: "Id", DateFormat: "MM/DD/YYYY", PurchasesNegative: true},
+			want:    []statementRow{{"2024-03-15", 45.10, "METRO", "T1", ""}},
+		},
+		{
+			name:    "debit and credit columns",
+			content: "Date,Description,Debit,Credit\n2024-03-15,SAQ,30.00,\n2024-03-16,PAYMENT,,100.00\n",
+			mapping: CSVColumnMapping{Date: "Date", Description: "Description", Debit: "Debit", Credit: "Credit"},
+			want: []statementRow{
+				{"2024-03-15", 30, "SAQ", "", ""},
+				{"2024-03-16", -100, "PAYMENT", "", ""},
+			},
+		},
+		{
+			name:    "no header, semicolons and French amounts",
+			content: "15/03/2024;IGA;12,99\n",
+			mapping: CSVColumnMapping{Date: "1", Description: "2", Amount: "3", NoHeader: true, Delimiter: ";", DateFormat: "DD/MM/YYYY", Locale: "fr"},
+			want:    []statementRow{{"2024-03-15", 12.99, "IGA", "", ""}},
+		},
+		{
+			name:    "missing amount columns",
+			content: "Date,Description\n2024-03-15,METRO\n",
+			mapping: CSVColumnMapping{Date: "Date", Description: "Description"},
+			wantErr: true,
+		},
+		{
+			name:    "column not in the header",
+			content: "Date,Description,Amount\n2024-03-15,METRO,1.00\n",
+			mapping: CSVColumnMapping{Date: "Date", Description: "Payee", Amount: "Amount"},
+			wantErr: true,
+		},
+		{
+			name:    "position without a number",
+			content: "2024-03-15,METRO,1.00\n",
+			mapping: CSVColumnMapping{Date: "date", Description: "2", Amount: "3", NoHeader: true},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported date format",
+			content: "Date,Description,Amount\n2024-03-15,METRO,1.00\n",
+			mapping: CSVColumnMapping{Date: "Date", Description: "Description", Amount: "Amount", DateFormat: "DD.MM.YY"},
+			wantErr: true,
+		},
+		{
+			name:    "unreadable date",
+			content: "Date,Description,Amount\nyesterday,METRO,1.00\n",
+			mapping: CSVColumnMapping{Date: "Date", Description: "Description", Amount: "Amount"},
+			wantErr: true,
+		},
+		{
+			name:    "unreadable amount",
+			content: "Date,Description,Amount\n2024-03-15,METRO,N/A\n",
+			mapping: CSVColumnMapping{Date: "Date", Description: "Description", Amount: "Amount"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transactions, err := ParseCSVStatement([]byte(tt.content), tt.mapping)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseCSVStatement() = %+v; want an error", transactions)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseCSVStatement() error = %v", err)
+			}
+			if got := statementRows(transactions); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseCSVStatement() = %+v; want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseOFXStatement(t *testing.T) {
+	sgml := `OFXHEADER:100
+DATA:OFXSGML
+
+<OFX>
+<CREDITCARDMSGSRSV1><CCSTMTTRNRS><CCSTMTRS>
+<CCACCTFROM><ACCTID>4500123456789012
+<BANKTRANLIST>
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>20240315120000.000[-5:EST]
+<TRNAMT>-123.45
+<FITID>A1
+<NAME>COSTCO WHOLESALE
+<MEMO>LAVAL QC
+<STMTTRN>
+<TRNTYPE>CREDIT
+<DTPOSTED>20240316
+<TRNAMT>20,00
+<FITID>A2
+<NAME>COSTCO REFUND
+</BANKTRANLIST>
+</CCSTMTRS></CCSTMTTRNRS></CREDITCARDMSGSRSV1>
+</OFX>
+`
+	xml := `<?xml version="1.0"?>
+<OFX><BANKMSGSRSV1><STMTTRNRS><STMTRS>
+<BANKACCTFROM><ACCTID>00112233</ACCTID></BANKACCTFROM>
+<BANKTRANLIST>
+<STMTTRN><TRNTYPE>DEBIT</TRNTYPE><DTPOSTED>20240401</DTPOSTED><TRNAMT>-9.99</TRNAMT><FITID>B1</FITID><NAME>NETFLIX</NAME><MEMO>NETFLIX</MEMO></STMTTRN>
+</BANKTRANLIST>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1></OFX>
+`
+
+	tests := []struct {
+		name    string
+		content string
+		want    []statementRow
+		wantErr bool
+	}{
+		{
+			name:    "SGML with unclosed elements",
+			content: sgml,
+			want: []statementRow{
+				{"2024-03-15", 123.45, "COSTCO WHOLESALE LAVAL QC", "A1", "9012"},
+				{"2024-03-16", -20, "COSTCO REFUND", "A2", "9012"},
+			},
+		},
+		{
+			name:    "XML with a memo repeating the name",
+			content: xml,
+			want:    []statementRow{{"2024-04-01", 9.99, "NETFLIX", "B1", "2233"}},
+		},
+		{
+			name:    "not an OFX file",
+			content: "Date,Description,Amount\n",
+			wantErr: true,
+		},
+		{
+			name:    "unreadable date",
+			content: "<OFX><STMTTRN><DTPOSTED>2024<TRNAMT>-1.00<FITID>C1</STMTTRN></OFX>",
+			wantErr: true,
+		},
+		{
+			name:    "unreadable amount",
+			content: "<OFX><STMTTRN><DTPOSTED>20240315<TRNAMT>N/A<FITID>C1</STMTTRN></OFX>",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transactions, err := ParseOFXStatement([]byte(tt.content))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseOFXStatement() = %+v; want an error", transactions)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseOFXStatement() error = %v", err)
+			}
+			if got := statementRows(transactions); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseOFXStatement() = %+v; want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectStatementFormat(t *testing.T) {
+	tests := []struct {
+		fileName string
+		content  string
+		want     string
+	}{
+		{"march.QFX", "", StatementFormatOFX},
+		{"march.csv", "<OFX>", StatementFormatCSV},
+		{"export", "OFXHEADER:100\n<ofx>", StatementFormatOFX},
+		{"export", "Date,Amount", StatementFormatCSV},
+	}
+
+	for _, tt := range tests {
+		if got := DetectStatementFormat(tt.fileName, []byte(tt.content)); got != tt.want {
+			t.Errorf("DetectStatementFormat(%q) = %s; want %s", tt.fileName, got, tt.want)
+		}
+	}
+}
+
+func TestParseOFXDate(t *testing.T) {
+	date, ok := parseOFXDate("20240315120000.000[-5:EST]")
+	if !ok || !date.Equal(time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("parseOFXDate() = %v, %v; want 2024-03-15", date, ok)
+	}
+	if _, ok := parseOFXDate("202403"); ok {
+		t.Error("parseOFXDate(202403) is ok; want not ok")
+	}
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Canadian sales tax types
+const (
+	TaxTypeGST = "GST" // Federal goods and services tax (TPS in French)
+	TaxTypeHST = "HST" // Harmonized sales tax (TVH in French)
+	TaxTypePST = "PST" // Provincial sales tax (RST in Manitoba, TVP in French)
+	TaxTypeQST = "QST" // Quebec sales tax (TVQ in French)
+)
+
+// TaxComponent is a single sales tax line of a receipt
+type TaxComponent struct {
+	Type   string  `json:"type"`
+	Rate   float64 `json:"rate"` // Percentage, e.g. 13 for 13% HST
+	Amount float64 `json:"amount"`
+}
+
+// provinceTaxRates lists the sales taxes charged in each province and territory
+var provinceTaxRates = map[string][]TaxComponent{
+	"AB": {{Type: TaxTypeGST, Rate: 5}},
+	"BC": {{Type: TaxTypeGST, Rate: 5}, {Type: TaxTypePST, Rate: 7}},
+	"MB": {{Type: TaxTypeGST, Rate: 5}, {Type: TaxTypePST, Rate: 7}},
+	"NB": {{Type: TaxTypeHST, Rate: 15}},
+	"NL": {{Type: TaxTypeHST, Rate: 15}},
+	"NS": {{Type: TaxTypeHST, Rate: 14}},
+	"NT": {{Type: TaxTypeGST, Rate: 5}},
+	"NU": {{Type: TaxTypeGST, Rate: 5}},
+	"ON": {{Type: TaxTypeHST, Rate: 13}},
+	"PE": {{Type: TaxTypeHST, Rate: 15}},
+	"QC": {{Type: TaxTypeGST, Rate: 5}, {Type: TaxTypeQST, Rate: 9.975}},
+	"SK": {{Type: TaxTypeGST, Rate: 5}, {Type: TaxTypePST, Rate: 6}},
+	"YT": {{Type: TaxTypeGST, Rate: 5}},
+}
+
+// provinceNames maps the spelled-out province names to their two-letter codes
+var provinceNames = map[string]string{
+	"ALBERTA":                   "AB",
+	"BRITISH COLUMBIA":          "BC",
+	"COLOMBIE-BRITANNIQUE":      "BC",
+	"MANITOBA":                  "MB",
+	"NEW BRUNSWICK":             "NB",
+	"NOUVEAU-BRUNSWICK":         "NB",
+	"NEWFOUNDLAND":              "NL",
+	"NORTHWEST TERRITORIES":     "NT",
+	"NOVA SCOTIA":               "NS",
+	"NOUVELLE-ECOSSE":           "NS",
+	"NUNAVUT":                   "NU",
+	"ONTARIO":                   "ON",
+	"PRINCE EDWARD ISLAND":      "PE",
+	"QUEBEC":                    "QC",
+	"QUÉBEC":                    "QC",
+	"SASKATCHEWAN":              "SK",
+	"YUKON":                     "YT",
+	"ILE-DU-PRINCE-EDOUARD":     "PE",
+	"TERRITOIRES DU NORD-OUEST": "NT",
+}
+
+// postalCodeProvinces maps the first letter of a postal code to its province
+var postalCodeProvinces = map[byte]string{
+	'A': "NL", 'B': "NS", 'C': "PE", 'E': "NB",
+	'G': "QC", 'H': "QC", 'J': "QC",
+	'K': "ON", 'L': "ON", 'M': "ON", 'N': "ON", 'P': "ON",
+	'R': "MB", 'S': "SK", 'T': "AB", 'V': "BC", 'Y': "YT",
+}
+
+var (
+	postalCodePattern   = regexp.MustCompile(`\b([ABCEGHJ-NPRSTVXY])\d[ABCEGHJ-NPRSTV-Z] ?\d[ABCEGHJ-NPRSTV-Z]\d\b`)
+	provinceCodePattern = regexp.MustCompile(`\b(AB|BC|MB|NB|NL|NS|NT|NU|ON|PE|QC|PQ|SK|YT)\b`)
+	taxLabelPattern     = regexp.MustCompile(`(?i)\b(GST|TPS|HST|TVH|PST|RST|TVP|QST|TVQ)\b`)
+	taxRatePattern      = regexp.MustCompile(`(\d{1,2}(?:[.,]\d{1,3})?)\s*%`)
+	// An amount with two decimals, possibly with thousands separators: 0.65, 1,234.56 or 1 234,56
+	taxAmountPattern = regexp.MustCompile(`-?\d{1,3}(?:[ ,.\x{00A0}\x{202F}]\d{3})*[.,]\d{2}\b|-?\d+[.,]\d{2}\b`)
+)
+
+// taxLabels maps the English and French tax labels to their tax type
+var taxLabels = map[string]string{
+	"GST": TaxTypeGST, "TPS": TaxTypeGST,
+	"HST": TaxTypeHST, "TVH": TaxTypeHST,
+	"PST": TaxTypePST, "RST": TaxTypePST, "TVP": TaxTypePST,
+	"QST": TaxTypeQST, "TVQ": TaxTypeQST,
+}
+
+// InferProvince guesses the province from a Canadian address using its postal code, then the
+// province code or spelled-out name nearest the end, since a street can be named after another
+// province ("1 Ontario St, Montreal QC")
+func InferProvince(address string) string {
+	upper := strings.ToUpper(address)
+
+	// X covers two territories, so it is left to the other hints
+	if match := postalCodePattern.FindStringSubmatch(upper); match != nil {
+		if province, ok := postalCodeProvinces[match[1][0]]; ok {
+			return province
+		}
+	}
+
+	province, position := "", -1
+	if matches := provinceCodePattern.FindAllStringIndex(upper, -1); len(matches) > 0 {
+		last := matches[len(matches)-1]
+		province, position = upper[last[0]:last[1]], last[0]
+		if province == "PQ" {
+			province = "QC"
+		}
+	}
+	for name, code := range provinceNames {
+		if index := strings.LastIndex(upper, name); index > position {
+			province, position = code, index
+		}
+	}
+	return province
+}
+
+// ExtractTaxBreakdown parses the GST/HST/PST/QST lines of the receipt text. When the receipt
+// doesn't itemize its taxes, the total tax is split using the province's rates instead. Amounts
+// are read with the receipt's decimal separator.
+func ExtractTaxBreakdown(lines []string, totalTax float64, province, locale string) []TaxComponent {
+	components := []TaxComponent{}
+	seen := map[string]bool{}
+
+	for _, line := range lines {
+		labels := taxLabelPattern.FindAllString(line, -1)
+		if len(labels) == 0 {
+			continue
+		}
+
+		// The amount is the last two-decimal number on the line
+		amounts := taxAmountPattern.FindAllString(line, -1)
+		if len(amounts) == 0 {
+			continue
+		}
+		amount, ok := ParseAmount(amounts[len(amounts)-1], locale)
+		if !ok {
+			continue
+		}
+
+		rate := 0.0
+		if match := taxRatePattern.FindStringSubmatch(line); match != nil {
+			rate, _ = strconv.ParseFloat(strings.Replace(match[1], ",", ".", 1), 64)
+		}
+
+		taxType := resolveTaxType(labels, rate, province)
+		if seen[taxType] {
+			// Receipts often repeat the tax lines in a summary block
+			continue
+		}
+		if rate == 0 {
+			rate = provinceRate(province, taxType)
+		}
+
+		seen[taxType] = true
+		components = append(components, TaxComponent{Type: taxType, Rate: rate, Amount: amount})
+	}
+
+	if len(components) > 0 || totalTax == 0 {
+		return components
+	}
+
+	// Split the single tax amount across the province's taxes in proportion to their rates
+	rates, ok := provinceTaxRates[province]
+	if !ok {
+		return components
+	}
+	rateSum := 0.0
+	for _, rate := range rates {
+		rateSum += rate.Rate
+	}
+	allocated := 0.0
+	for i, rate := range rates {
+		amount := roundCents(totalTax * rate.Rate / rateSum)
+		if i == len(rates)-1 {
+			// Give the rounding remainder to the last component
+			amount = roundCents(totalTax - allocated)
+		}
+		allocated += amount
+		components = append(components, TaxComponent{Type: rate.Type, Rate: rate.Rate, Amount: amount})
+	}
+	return components
+}
+
+// resolveTaxType picks the tax type for a line, handling combined labels such as "GST/HST"
+func resolveTaxType(labels []string, rate float64, province string) string {
+	types := map[string]bool{}
+	for _, label := range labels {
+		types[taxLabels[strings.ToUpper(label)]] = true
+	}
+
+	if types[TaxTypeGST] && types[TaxTypeHST] {
+		// A combined GST/HST line is plain GST at 5%, or in provinces without HST
+		if rate == 5 || (rate == 0 && provinceRate(province, TaxTypeHST) == 0 && province != "") {
+			return TaxTypeGST
+		}
+		return TaxTypeHST
+	}
+	return taxLabels[strings.ToUpper(labels[0])]
+}
+
+// provinceRate returns the rate of the given tax in the province, or zero when unknown
+func provinceRate(province, taxType string) float64 {
+	for _, rate := range provinceTaxRates[province] {
+		if rate.Type == taxType {
+			return rate.Rate
+		}
+	}
+	return 0
+}
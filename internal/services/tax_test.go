@@ -0,0 +1,79 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractTaxBreakdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		lines    []string
+		totalTax float64
+		province string
+		locale   string
+		want     []TaxComponent
+	}{
+		{
+			name:     "HST with a thousands separator",
+			lines:    []string{"SUBTOTAL 9,496.62", "HST 13% 1,234.56", "TOTAL 10,731.18"},
+			province: "ON",
+			locale:   LocaleEnCA,
+			want:     []TaxComponent{{Type: TaxTypeHST, Rate: 13, Amount: 1234.56}},
+		},
+		{
+			name:     "French lines with a space as thousands separator",
+			lines:    []string{"SOUS-TOTAL 12 345,67", "TPS 5 % 617,28", "TVQ 9,975 % 1 231,48", "TOTAL 14 194,43"},
+			province: "QC",
+			locale:   LocaleFrCA,
+			want: []TaxComponent{
+				{Type: TaxTypeGST, Rate: 5, Amount: 617.28},
+				{Type: TaxTypeQST, Rate: 9.975, Amount: 1231.48},
+			},
+		},
+		{
+			name:     "rate from the province and a repeated summary line",
+			lines:    []string{"GST 0.65", "PST 0.91", "TAX SUMMARY", "GST 0.65"},
+			province: "BC",
+			locale:   LocaleEnCA,
+			want: []TaxComponent{
+				{Type: TaxTypeGST, Rate: 5, Amount: 0.65},
+				{Type: TaxTypePST, Rate: 7, Amount: 0.91},
+			},
+		},
+		{
+			name:     "combined GST/HST label at 5%",
+			lines:    []string{"GST/HST 5% 2.50"},
+			province: "AB",
+			locale:   LocaleEnCA,
+			want:     []TaxComponent{{Type: TaxTypeGST, Rate: 5, Amount: 2.50}},
+		},
+		{
+			name:     "total tax split by the province's rates",
+			lines:    []string{"TAXES 14.98"},
+			totalTax: 14.98,
+			province: "QC",
+			locale:   LocaleFrCA,
+			want: []TaxComponent{
+				{Type: TaxTypeGST, Rate: 5, Amount: 5},
+				{Type: TaxTypeQST, Rate: 9.975, Amount: 9.98},
+			},
+		},
+		{
+			name:     "nothing to go on",
+			lines:    []string{"TAXES 1.00"},
+			totalTax: 1,
+			locale:   LocaleEnCA,
+			want:     []TaxComponent{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ExtractTaxBreakdown(tt.lines, tt.totalTax, tt.province, tt.locale)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ExtractTaxBreakdown() = %+v; want %+v", got, tt.want)
+			}
+		})
+	}
+}
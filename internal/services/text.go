@@ -0,0 +1,35 @@
+package services
+
+import "strings"
+
+// extractTextLines returns the raw OCR text lines of every page in reading order
+func extractTextLines(analyzeResult map[string]interface{}) []string {
+	lines := []string{}
+
+	readResults, ok := analyzeResult["readResults"].([]interface{})
+	if !ok {
+		return lines
+	}
+
+	for _, page := range readResults {
+		pageMap, ok := page.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		pageLines, ok := pageMap["lines"].([]interface{})
+		if !ok {
+			continue
+		}
+		for _, line := range pageLines {
+			lineMap, ok := line.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if text, ok := lineMap["text"].(string); ok && strings.TrimSpace(text) != "" {
+				lines = append(lines, strings.TrimSpace(text))
+			}
+		}
+	}
+
+	return lines
+}
@@ -23,6 +23,14 @@ type Pagination struct {
 	TotalPages int `json:"total_pages"`
 }
 
+// CursorPagination represents pagination information when paging by cursor, which has no page number
+type CursorPagination struct {
+	TotalCount int    `json:"total_count"`
+	PerPage    int    `json:"per_page"`
+	TotalPages int    `json:"total_pages"`
+	NextCursor string `json:"next_cursor,omitempty"` // Left out on the last page
+}
+
 // SendResponse creates and sends a standardized JSON response
 func SendResponse(context *gin.Context, status int, message string, data interface{}, errors interface{}) {
 	context.JSON(status, APIResponse{
@@ -33,6 +41,17 @@ func SendResponse(context *gin.Context, status int, message string, data interfa
 	})
 }
 
+// SendPaginatedResponse sends a standardized JSON response for one page of a list, with a Pagination
+// or a CursorPagination
+func SendPaginatedResponse(context *gin.Context, status int, message string, data interface{}, pagination interface{}) {
+	context.JSON(status, APIResponse{
+		Status:     status,
+		Message:    message,
+		Data:       data,
+		Pagination: pagination,
+	})
+}
+
 // CalculatePagination returns pagination details based on the total count, page, and limit
 func CalculatePagination(totalCount, page, limit int) Pagination {
 	// Prevent zero or negative values for limit
@@ -56,6 +75,16 @@ func CalculatePagination(totalCount, page, limit int) Pagination {
 	}
 }
 
+// WithCursor turns the pagination into the one of a page reached by cursor
+func (p Pagination) WithCursor(nextCursor string) CursorPagination {
+	return CursorPagination{
+		TotalCount: p.TotalCount,
+		PerPage:    p.PerPage,
+		TotalPages: p.TotalPages,
+		NextCursor: nextCursor,
+	}
+}
+
 // ParseQueryInt parses an integer query parameter from the context and returns a default value if parsing fails.
 func ParseQueryInt(c *gin.Context, key string, defaultValue int) int {
 	// Retrieve the query parameter as a string